@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/export"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+	"github.com/joluc/icebreaker-exporter/pkg/storage"
+)
+
+// runExport implements the export subcommand. It renders the tracks
+// persisted under -storage.path as GPX or KML, e.g.
+//
+//	icebreaker-exporter export -storage.path /var/lib/icebreaker -o fleet.kml
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("icebreaker-exporter export", flag.ContinueOnError)
+	storagePath := fs.String("storage.path", "", "Storage directory of the exporter to read the tracks from")
+	format := fs.String("format", "", "Output format: gpx or kml (default: from the -o extension, else gpx)")
+	mmsis := fs.String("mmsi", "", "Comma separated MMSIs to export (default: all vessels)")
+	since := fs.Duration("since", 0, "Only export points reported within this duration before now (0 exports everything)")
+	output := fs.String("o", "-", "Output file, - for stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *storagePath == "" {
+		return errors.New("-storage.path is required")
+	}
+
+	if *format == "" {
+		*format = "gpx"
+		if ext := strings.TrimPrefix(filepath.Ext(*output), "."); ext == "kml" {
+			*format = ext
+		}
+	}
+	var write func(io.Writer, []export.Track) error
+	switch *format {
+	case "gpx":
+		write = export.WriteGPX
+	case "kml":
+		write = export.WriteKML
+	default:
+		return fmt.Errorf("format must be gpx or kml, got %q", *format)
+	}
+
+	state, err := storage.Load(*storagePath)
+	if err != nil {
+		return fmt.Errorf("load storage: %w", err)
+	}
+
+	points := state.Tracks
+	if *mmsis != "" {
+		points = map[string][]models.TrackPoint{}
+		for _, mmsi := range strings.Split(*mmsis, ",") {
+			mmsi = strings.TrimSpace(mmsi)
+			points[mmsi] = state.Tracks[mmsi]
+		}
+	}
+	var from time.Time
+	if *since > 0 {
+		from = time.Now().Add(-*since)
+	}
+	tracks := export.Tracks(state.Snapshot.Positions, points, from)
+
+	if *output == "-" {
+		return write(os.Stdout, tracks)
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := write(f, tracks); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/joluc/icebreaker-exporter/pkg/config"
 	"github.com/joluc/icebreaker-exporter/pkg/exporter"
+	"github.com/joluc/icebreaker-exporter/pkg/nmea"
 )
 
 func main() {
@@ -16,34 +21,89 @@ func main() {
 	logger := slog.Default()
 	slog.SetDefault(logger)
 
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		err := runExport(os.Args[2:])
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		if err != nil {
+			slog.Error("export failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cfg, err := config.ParseFlags()
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
 		slog.Error("failed to parse flags", "error", err)
 		os.Exit(1)
 	}
 
-	if cfg.RefreshInterval <= 0 {
-		slog.Error("refresh-interval must be > 0")
+	if err := cfg.Validate(); err != nil {
+		slog.Error("invalid configuration", "error", err)
 		os.Exit(1)
 	}
-	if cfg.RequestTimeout <= 0 {
-		slog.Error("request-timeout must be > 0")
-		os.Exit(1)
+
+	exp := exporter.New(cfg)
+	if cfg.StoragePath != "" {
+		if err := exp.UseStorage(cfg.StoragePath); err != nil {
+			slog.Error("failed to load storage", "path", cfg.StoragePath, "error", err)
+			os.Exit(1)
+		}
 	}
 
-	if len(cfg.TargetNames) == 0 {
-		slog.Error("at least one vessel name must be configured")
-		os.Exit(1)
+	ctx := context.Background()
+
+	if cfg.NMEAFile != "" {
+		if err := nmea.ReadFile(cfg.NMEAFile, exp.HandleAISReport); err != nil {
+			slog.Error("failed to read nmea file", "path", cfg.NMEAFile, "error", err)
+			os.Exit(1)
+		}
+	}
+	if cfg.NMEATCPAddress != "" {
+		go func() {
+			if err := nmea.ListenTCP(ctx, cfg.NMEATCPAddress, exp.HandleAISReport); err != nil {
+				slog.Error("nmea tcp listener stopped", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+	if cfg.NMEAUDPAddress != "" {
+		go func() {
+			if err := nmea.ListenUDP(ctx, cfg.NMEAUDPAddress, exp.HandleAISReport); err != nil {
+				slog.Error("nmea udp listener stopped", "error", err)
+				os.Exit(1)
+			}
+		}()
 	}
 
-	exp := exporter.New(cfg)
+	if cfg.MQTTURL != "" {
+		go exp.StreamLoop(ctx)
+	} else {
+		go exp.RefreshLoop(ctx)
+	}
 
-	ctx := context.Background()
-	go exp.RefreshLoop(ctx)
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			_ = exp.Reload()
+		}
+	}()
 
 	mux := http.NewServeMux()
 	mux.HandleFunc(cfg.MetricsPath, exp.MetricsHandler)
 	mux.HandleFunc("/healthz", exp.HealthHandler)
+	mux.HandleFunc("/-/reload", exp.ReloadHandler)
+	mux.HandleFunc("GET /api/v1/vessels", exp.VesselsHandler)
+	mux.HandleFunc("GET /api/v1/vessels.geojson", exp.VesselsGeoJSONHandler)
+	mux.HandleFunc("GET /api/v1/stream", exp.StreamHandler)
+	mux.HandleFunc("GET /api/v1/vessels/{mmsi}/track", exp.TrackHandler)
+	mux.HandleFunc("GET /api/v1/assists", exp.AssistsHandler)
+	mux.HandleFunc("GET /export/{file}", exp.ExportHandler)
 	mux.HandleFunc("/", exp.RootHandler())
 
 	srv := &http.Server{
@@ -2,4 +2,6 @@ module github.com/joluc/icebreaker-exporter
 
 go 1.26
 
+require gopkg.in/yaml.v3 v3.0.1
+
 require golang.org/dl v0.0.0-20260210192738-6a105f684182 // indirect
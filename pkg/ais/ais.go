@@ -0,0 +1,150 @@
+// Package ais holds definitions from ITU-R M.1371 (the AIS specification)
+// that are shared by every position source.
+package ais
+
+import "time"
+
+// Raw values that the specification reserves for "not available".
+const (
+	HeadingNotAvailable    = 511
+	SpeedNotAvailable      = 102.3 // knots
+	CourseNotAvailable     = 360.0 // degrees
+	RateOfTurnNotAvailable = -128
+)
+
+// Speed returns a pointer to a valid speed over ground in knots, or nil when
+// the value is the "not available" sentinel or out of range.
+func Speed(knots float64) *float64 {
+	if knots < 0 || knots >= SpeedNotAvailable {
+		return nil
+	}
+	return &knots
+}
+
+// Course returns a pointer to a valid course over ground in degrees, or nil
+// for 360 ("not available") and out of range values.
+func Course(degrees float64) *float64 {
+	if degrees < 0 || degrees >= CourseNotAvailable {
+		return nil
+	}
+	return &degrees
+}
+
+// Heading returns a pointer to a valid true heading in degrees, or nil for
+// 511 ("not available") and other values outside 0-359.
+func Heading(degrees float64) *float64 {
+	if degrees < 0 || degrees >= 360 {
+		return nil
+	}
+	return &degrees
+}
+
+// RateOfTurn returns a pointer to the rate of turn, or nil for -128 ("not
+// available") and values outside the encodable range.
+func RateOfTurn(rot float64) *float64 {
+	if rot <= RateOfTurnNotAvailable || rot > 127 {
+		return nil
+	}
+	return &rot
+}
+
+// NavigationStatus returns a pointer to a navigation status code, or nil for
+// values outside 0-15. Code 15 ("not defined") is a real value and is kept.
+func NavigationStatus(code int) *int {
+	if code < 0 || code > 15 {
+		return nil
+	}
+	return &code
+}
+
+var navigationStatusText = [16]string{
+	"Under way using engine",
+	"At anchor",
+	"Not under command",
+	"Restricted manoeuvrability",
+	"Constrained by draught",
+	"Moored",
+	"Aground",
+	"Engaged in fishing",
+	"Under way sailing",
+	"Reserved for HSC",
+	"Reserved for WIG",
+	"Towing astern",
+	"Pushing ahead or towing alongside",
+	"Reserved",
+	"AIS-SART, MOB or EPIRB active",
+	"Not defined",
+}
+
+// NavigationStatusText returns the ITU-R M.1371 meaning of a navigation
+// status code, or "Unknown" for values outside 0-15.
+func NavigationStatusText(code int) string {
+	if code < 0 || code > 15 {
+		return "Unknown"
+	}
+	return navigationStatusText[code]
+}
+
+// NavigationStates holds a label-friendly name for every navigation status
+// code, indexed by code.
+var NavigationStates = [16]string{
+	"under_way_using_engine",
+	"at_anchor",
+	"not_under_command",
+	"restricted_manoeuvrability",
+	"constrained_by_draught",
+	"moored",
+	"aground",
+	"engaged_in_fishing",
+	"under_way_sailing",
+	"reserved_hsc",
+	"reserved_wig",
+	"towing_astern",
+	"pushing_ahead_or_towing_alongside",
+	"reserved",
+	"ais_sart_active",
+	"not_defined",
+}
+
+// ETA decodes the packed estimated time of arrival used by message type 5
+// and Digitraffic (month in bits 19-16, day in 15-11, hour in 10-6, minute
+// in 5-0, UTC). AIS does not carry the year, so the occurrence closest to
+// ref is chosen. The zero time is returned when month or day is not
+// available.
+func ETA(packed int, ref time.Time) time.Time {
+	month := packed >> 16 & 0xf
+	day := packed >> 11 & 0x1f
+	hour := packed >> 6 & 0x1f
+	minute := packed & 0x3f
+	if month < 1 || month > 12 || day < 1 {
+		return time.Time{}
+	}
+	// Hour 24 and minute 60 mean "not available".
+	if hour > 23 {
+		hour, minute = 0, 0
+	}
+	if minute > 59 {
+		minute = 0
+	}
+
+	ref = ref.UTC()
+	var best time.Time
+	for year := ref.Year() - 1; year <= ref.Year()+1; year++ {
+		t := time.Date(year, time.Month(month), day, hour, minute, 0, 0, time.UTC)
+		if t.Day() != day {
+			// Day does not exist in that month, e.g. 30 February.
+			continue
+		}
+		if best.IsZero() || t.Sub(ref).Abs() < best.Sub(ref).Abs() {
+			best = t
+		}
+	}
+	return best
+}
+
+// Dimensions returns the overall length and beam in metres from the
+// distances of the position reference point to bow (a), stern (b), port (c)
+// and starboard (d). Zero means not available.
+func Dimensions(a, b, c, d int) (length, beam float64) {
+	return float64(max(a, 0) + max(b, 0)), float64(max(c, 0) + max(d, 0))
+}
@@ -0,0 +1,89 @@
+package ais
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSentinels(t *testing.T) {
+	tests := []struct {
+		name      string
+		fn        func(float64) *float64
+		input     float64
+		available bool
+	}{
+		{"speed zero", Speed, 0, true},
+		{"speed max", Speed, 102.2, true},
+		{"speed not available", Speed, 102.3, false},
+		{"speed negative", Speed, -1, false},
+		{"course zero", Course, 0, true},
+		{"course not available", Course, 360, false},
+		{"heading north", Heading, 0, true},
+		{"heading 359", Heading, 359, true},
+		{"heading not available", Heading, 511, false},
+		{"heading out of range", Heading, 400, false},
+		{"rot zero", RateOfTurn, 0, true},
+		{"rot max left", RateOfTurn, -127, true},
+		{"rot not available", RateOfTurn, -128, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.fn(tt.input)
+			if (got != nil) != tt.available {
+				t.Fatalf("got %v, want available=%v", got, tt.available)
+			}
+			if got != nil && *got != tt.input {
+				t.Errorf("got %v, want %v", *got, tt.input)
+			}
+		})
+	}
+}
+
+func TestNavigationStatus(t *testing.T) {
+	if got := NavigationStatus(0); got == nil || *got != 0 {
+		t.Errorf("NavigationStatus(0) = %v", got)
+	}
+	if got := NavigationStatus(15); got == nil || *got != 15 {
+		t.Errorf("NavigationStatus(15) = %v", got)
+	}
+	if got := NavigationStatus(16); got != nil {
+		t.Errorf("NavigationStatus(16) = %v, want nil", *got)
+	}
+}
+
+func TestNavigationStates(t *testing.T) {
+	if NavigationStates[1] != "at_anchor" || NavigationStates[5] != "moored" || NavigationStates[15] != "not_defined" {
+		t.Errorf("unexpected state names %q", NavigationStates)
+	}
+}
+
+func TestETA(t *testing.T) {
+	ref := time.Date(2024, 12, 20, 0, 0, 0, 0, time.UTC)
+	pack := func(month, day, hour, minute int) int { return month<<16 | day<<11 | hour<<6 | minute }
+	tests := []struct {
+		name   string
+		packed int
+		want   time.Time
+	}{
+		{"same year", pack(12, 24, 14, 30), time.Date(2024, 12, 24, 14, 30, 0, 0, time.UTC)},
+		{"rolls into next year", pack(1, 3, 6, 0), time.Date(2025, 1, 3, 6, 0, 0, 0, time.UTC)},
+		{"hour not available", pack(12, 24, 24, 60), time.Date(2024, 12, 24, 0, 0, 0, 0, time.UTC)},
+		{"month not available", pack(0, 24, 14, 30), time.Time{}},
+		{"day not available", pack(12, 0, 14, 30), time.Time{}},
+		{"zero", 0, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ETA(tt.packed, ref); !got.Equal(tt.want) {
+				t.Errorf("ETA() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDimensions(t *testing.T) {
+	length, beam := Dimensions(70, 29, 12, 12)
+	if length != 99 || beam != 24 {
+		t.Errorf("Dimensions() = %v, %v; want 99, 24", length, beam)
+	}
+}
@@ -0,0 +1,137 @@
+package ais
+
+import (
+	_ "embed"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// UnknownCountry is the country code used when an MMSI carries no known MID.
+const UnknownCountry = "Unknown"
+
+//go:embed mid.tsv
+var midTable string
+
+// Country is the flag state a Maritime Identification Digits (MID) value is
+// allocated to.
+type Country struct {
+	Alpha2 string // ISO 3166-1 alpha-2 code
+	Name   string
+}
+
+var mids = sync.OnceValue(func() map[int]Country {
+	out := make(map[int]Country, 300)
+	for _, line := range strings.Split(midTable, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			panic("ais: malformed MID table line: " + line)
+		}
+		mid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			panic("ais: malformed MID table line: " + line)
+		}
+		out[mid] = Country{Alpha2: fields[1], Name: fields[2]}
+	}
+	return out
+})
+
+// LookupMID returns the country a MID is allocated to.
+func LookupMID(mid int) (Country, bool) {
+	c, ok := mids()[mid]
+	return c, ok
+}
+
+// StationKind classifies an MMSI by its ITU-R M.585 format.
+type StationKind int
+
+const (
+	StationInvalid     StationKind = iota
+	StationShip                    // MIDxxxxxx
+	StationGroup                   // 0MIDxxxxx, group call to ships
+	StationCoast                   // 00MIDxxxx
+	StationSARAircraft             // 111MIDxxx
+	StationAtoN                    // 99MIDxxxx, aid to navigation
+	StationCraft                   // 98MIDxxxx, craft associated with a parent ship
+	StationHandheld                // 8MIDxxxxx, handheld VHF
+	StationDistress                // 970xxxxxx AIS-SART, 972xxxxxx MOB, 974xxxxxx EPIRB-AIS
+)
+
+func (k StationKind) String() string {
+	switch k {
+	case StationShip:
+		return "ship"
+	case StationGroup:
+		return "group"
+	case StationCoast:
+		return "coast"
+	case StationSARAircraft:
+		return "sar_aircraft"
+	case StationAtoN:
+		return "aton"
+	case StationCraft:
+		return "craft"
+	case StationHandheld:
+		return "handheld"
+	case StationDistress:
+		return "distress"
+	default:
+		return "invalid"
+	}
+}
+
+// ParseMMSI returns the station kind of a nine-digit MMSI and the MID it
+// embeds. mid is 0 for kinds that carry none (distress devices) and for
+// malformed MMSIs.
+func ParseMMSI(mmsi string) (kind StationKind, mid int) {
+	if len(mmsi) != 9 || strings.Trim(mmsi, "0123456789") != "" {
+		return StationInvalid, 0
+	}
+	digits := func(start int) int {
+		v, _ := strconv.Atoi(mmsi[start : start+3])
+		return v
+	}
+
+	switch {
+	case strings.HasPrefix(mmsi, "00"):
+		return StationCoast, digits(2)
+	case mmsi[0] == '0':
+		return StationGroup, digits(1)
+	case strings.HasPrefix(mmsi, "111"):
+		return StationSARAircraft, digits(3)
+	case strings.HasPrefix(mmsi, "99"):
+		return StationAtoN, digits(2)
+	case strings.HasPrefix(mmsi, "98"):
+		return StationCraft, digits(2)
+	case strings.HasPrefix(mmsi, "970"), strings.HasPrefix(mmsi, "972"), strings.HasPrefix(mmsi, "974"):
+		return StationDistress, 0
+	case mmsi[0] == '8':
+		return StationHandheld, digits(1)
+	case mmsi[0] >= '2' && mmsi[0] <= '7':
+		return StationShip, digits(0)
+	default:
+		return StationInvalid, 0
+	}
+}
+
+// CountryOf returns the flag state of an MMSI, taking the special MMSI
+// forms into account.
+func CountryOf(mmsi string) (Country, bool) {
+	_, mid := ParseMMSI(mmsi)
+	if mid == 0 {
+		return Country{}, false
+	}
+	return LookupMID(mid)
+}
+
+// CountryCode returns the ISO alpha-2 code of the flag state of an MMSI, or
+// UnknownCountry.
+func CountryCode(mmsi string) string {
+	if c, ok := CountryOf(mmsi); ok {
+		return c.Alpha2
+	}
+	return UnknownCountry
+}
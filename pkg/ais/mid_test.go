@@ -0,0 +1,54 @@
+package ais
+
+import "testing"
+
+func TestParseMMSI(t *testing.T) {
+	tests := []struct {
+		mmsi    string
+		kind    StationKind
+		mid     int
+		country string
+	}{
+		{"230124000", StationShip, 230, "FI"},
+		{"265010000", StationShip, 265, "SE"},
+		{"257021000", StationShip, 257, "NO"},
+		{"219012000", StationShip, 219, "DK"},
+		{"276001000", StationShip, 276, "EE"},
+		{"023012300", StationGroup, 230, "FI"},
+		{"002300010", StationCoast, 230, "FI"},
+		{"111230123", StationSARAircraft, 230, "FI"},
+		{"992301234", StationAtoN, 230, "FI"},
+		{"982651234", StationCraft, 265, "SE"},
+		{"823012345", StationHandheld, 230, "FI"},
+		{"970012345", StationDistress, 0, UnknownCountry},
+		{"974012345", StationDistress, 0, UnknownCountry},
+		{"999999999", StationAtoN, 999, UnknownCountry},
+		{"123456", StationInvalid, 0, UnknownCountry},
+		{"23012400A", StationInvalid, 0, UnknownCountry},
+		{"100000000", StationInvalid, 0, UnknownCountry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mmsi, func(t *testing.T) {
+			kind, mid := ParseMMSI(tt.mmsi)
+			if kind != tt.kind || mid != tt.mid {
+				t.Errorf("ParseMMSI() = %s, %d; want %s, %d", kind, mid, tt.kind, tt.mid)
+			}
+			if got := CountryCode(tt.mmsi); got != tt.country {
+				t.Errorf("CountryCode() = %q, want %q", got, tt.country)
+			}
+		})
+	}
+}
+
+func TestLookupMID(t *testing.T) {
+	c, ok := LookupMID(230)
+	if !ok || c.Alpha2 != "FI" || c.Name != "Finland" {
+		t.Errorf("LookupMID(230) = %+v, %v", c, ok)
+	}
+	if _, ok := LookupMID(217); ok {
+		t.Error("expected unallocated MID 217 to be unknown")
+	}
+	if n := len(mids()); n < 280 {
+		t.Errorf("expected the full MID table, got %d entries", n)
+	}
+}
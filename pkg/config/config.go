@@ -1,14 +1,33 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"os"
+	"slices"
 	"strings"
 	"time"
 )
 
+// Payload parsers for the Digitraffic REST endpoints.
+const (
+	ParserTyped     = "typed"
+	ParserHeuristic = "heuristic"
+)
+
+// Strategies for fetching locations from Digitraffic.
+const (
+	FetchFull     = "full"
+	FetchTargeted = "targeted"
+)
+
 const DefaultVessels = "OTSO,KONTIO,POLARIS,URHO,SISU,VOIMA,FENNICA,NORDICA,ALE,ATLE,FREJ,ODEN,YMER,IDUN,KRONPRINS HAAKON,SVALBARD"
 
 type Config struct {
+	// Args are the command line arguments the configuration was parsed
+	// from. Reloads parse them, and the config file they name, again.
+	Args            []string
 	ListenAddress   string
 	MetricsPath     string
 	VesselsURL      string
@@ -16,43 +35,248 @@ type Config struct {
 	DigitrafficUser string
 	RefreshInterval time.Duration
 	RequestTimeout  time.Duration
-	TargetNames     map[string]struct{}
+	// ConfigFile is the optional YAML file the settings and vessels were
+	// loaded from.
+	ConfigFile string
+	// Vessels are the tracked vessel definitions, from -vessel-names or the
+	// config file; Targets matches AIS data against them.
+	Vessels []Vessel
+	Targets *Targets
+	// TargetNames holds the normalized names of Vessels.
+	TargetNames map[string]struct{}
+	// Zones are the geofences of the config file.
+	Zones []Zone
+	// SpoofingPoints are the known GNSS spoofing points of the config file.
+	SpoofingPoints []SpoofingPoint
+	// KeepLastPlausible replaces implausible position reports with the
+	// vessel's last plausible one instead of only flagging them.
+	KeepLastPlausible bool
+	// AssistEnabled keeps the locations of all vessels, not just the
+	// targets, to detect merchant vessels following an icebreaker within
+	// AssistRadius nautical miles for at least AssistMinDuration.
+	AssistEnabled     bool
+	AssistRadius      float64
+	AssistMinDuration time.Duration
+	// PairDistances exports the distance between every two icebreakers
+	// unless there are more than MaxPairs pairs.
+	PairDistances bool
+	MaxPairs      int
+	Parser        string
+	FetchStrategy string
+	// FetchConcurrency bounds the parallel per-vessel requests of the
+	// targeted strategy.
+	FetchConcurrency int
+	// ResolveInterval is how long resolved name to MMSI mappings are reused
+	// by the targeted strategy, and how often streaming mode refreshes to
+	// find vessels to subscribe to.
+	ResolveInterval time.Duration
+	// IncrementalRefresh makes the typed full strategy request only the
+	// changes since the previous refresh.
+	IncrementalRefresh bool
+	// RetryMaxAttempts, RetryBaseDelay and RetryMaxDelay configure retries
+	// of transient Digitraffic failures.
+	RetryMaxAttempts int
+	RetryBaseDelay   time.Duration
+	RetryMaxDelay    time.Duration
+	// BreakerThreshold consecutive failures open the circuit breaker for
+	// BreakerCooldown; zero disables the breaker.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// HistoryRetention and HistoryMaxPoints bound the recorded track of
+	// each vessel; zero disables the history.
+	HistoryRetention time.Duration
+	HistoryMaxPoints int
+	// StoragePath is the directory of the on-disk state; empty keeps the
+	// state in memory only.
+	StoragePath string
+	// WebTileURL is the {z}/{x}/{y} map tile template of the web UI; empty
+	// draws the bundled coastline instead. WebTileAttribution is shown
+	// with the tiles.
+	WebTileURL         string
+	WebTileAttribution string
+	MQTTURL            string
+	NMEATCPAddress     string
+	NMEAUDPAddress     string
+	NMEAFile           string
 }
 
+// ParseFlags parses the command line arguments of the process.
 func ParseFlags() (Config, error) {
-	listenAddress := flag.String("listen-address", ":9877", "Address the exporter listens on")
-	metricsPath := flag.String("metrics-path", "/metrics", "Path to expose Prometheus metrics")
-	vesselsURL := flag.String("vessels-url", "https://meri.digitraffic.fi/api/ais/v1/vessels", "Digitraffic AIS vessels endpoint")
-	locationsURL := flag.String("locations-url", "https://meri.digitraffic.fi/api/ais/v1/locations", "Digitraffic AIS locations endpoint")
-	digitrafficUser := flag.String("digitraffic-user", "icebreaker-exporter/1.0", "Value for the Digitraffic-User request header")
-	refreshInterval := flag.Duration("refresh-interval", 2*time.Minute, "How often to refresh vessel positions")
-	requestTimeout := flag.Duration("request-timeout", 20*time.Second, "Timeout for each Digitraffic request")
-	targetVessels := flag.String("vessel-names", DefaultVessels, "Comma separated list of vessel names to export")
-	flag.Parse()
+	return Parse(os.Args[1:])
+}
+
+// Parse builds the configuration from command line arguments and, when
+// -config.file is given, the settings and vessels in that file. Flags set on
+// the command line take precedence over the file.
+func Parse(args []string) (Config, error) {
+	fs := flag.NewFlagSet("icebreaker-exporter", flag.ContinueOnError)
+	configFile := fs.String("config.file", "", "YAML file with settings and per-vessel definitions; command line flags override it")
+	listenAddress := fs.String("listen-address", ":9877", "Address the exporter listens on")
+	metricsPath := fs.String("metrics-path", "/metrics", "Path to expose Prometheus metrics")
+	vesselsURL := fs.String("vessels-url", "https://meri.digitraffic.fi/api/ais/v1/vessels", "Digitraffic AIS vessels endpoint")
+	locationsURL := fs.String("locations-url", "https://meri.digitraffic.fi/api/ais/v1/locations", "Digitraffic AIS locations endpoint")
+	digitrafficUser := fs.String("digitraffic-user", "icebreaker-exporter/1.0", "Value for the Digitraffic-User request header")
+	refreshInterval := fs.Duration("refresh-interval", 2*time.Minute, "How often to refresh vessel positions")
+	requestTimeout := fs.Duration("request-timeout", 20*time.Second, "Timeout for each Digitraffic request")
+	targetVessels := fs.String("vessel-names", DefaultVessels, "Comma separated list of vessel names to export")
+	parser := fs.String("parser", ParserTyped, "Digitraffic payload parser: typed (AIS v1 schema) or heuristic (schema-agnostic fallback)")
+	fetchStrategy := fs.String("fetch-strategy", FetchFull, "How locations are fetched: full (entire locations list) or targeted (one request per resolved MMSI)")
+	fetchConcurrency := fs.Int("fetch-concurrency", 4, "Maximum parallel per-vessel requests for the targeted fetch strategy")
+	resolveInterval := fs.Duration("resolve-interval", time.Hour, "How long the targeted fetch strategy reuses name to MMSI mappings before resolving them again, and how often streaming mode refreshes to find new vessels (0 disables)")
+	incrementalRefresh := fs.Bool("incremental-refresh", true, "Request only locations changed since the previous refresh and skip unchanged vessel lists (typed parser, full fetch strategy)")
+	retryMaxAttempts := fs.Int("retry-max-attempts", 3, "Attempts per Digitraffic request before giving up on transient failures (network errors, 429, 5xx)")
+	retryBaseDelay := fs.Duration("retry-base-delay", time.Second, "Delay before the first retry; doubles per attempt with jitter. Retry-After on 429/503 takes precedence")
+	retryMaxDelay := fs.Duration("retry-max-delay", 10*time.Second, "Upper bound for the exponential retry delay and for Retry-After")
+	breakerThreshold := fs.Int("breaker-threshold", 5, "Consecutive failed Digitraffic requests that open the circuit breaker (0 disables)")
+	breakerCooldown := fs.Duration("breaker-cooldown", 5*time.Minute, "How long the circuit breaker stays open before a probe request is allowed")
+	historyRetention := fs.Duration("history-retention", 24*time.Hour, "How long recorded track points are kept per vessel (0 disables the history)")
+	historyMaxPoints := fs.Int("history-max-points", 2880, "Maximum recorded track points per vessel (0 disables the history)")
+	storagePath := fs.String("storage.path", "", "Directory to persist positions, track history and resolved MMSIs across restarts (empty disables)")
+	webTileURL := fs.String("web.tile-url", "", "Map tile URL template for the web UI, e.g. https://tiles.example.org/{z}/{x}/{y}.png (empty draws the bundled coastline)")
+	webTileAttribution := fs.String("web.tile-attribution", "", "Attribution shown with the map tiles of the web UI")
+	keepLastPlausible := fs.Bool("plausibility.keep-last", false, "Keep the last plausible position of a vessel in place of implausible reports (impossible speed, on land, spoofing) instead of only flagging them")
+	assistEnabled := fs.Bool("assist.enabled", false, "Keep the locations of all vessels to detect merchant vessels assisted by an icebreaker (full fetch strategy)")
+	assistRadius := fs.Float64("assist.radius", 2, "Distance in nautical miles behind an icebreaker within which a merchant vessel with a similar course and speed counts as assisted")
+	assistMinDuration := fs.Duration("assist.min-duration", 10*time.Minute, "How long a merchant vessel has to follow an icebreaker before it counts as assisted")
+	pairDistances := fs.Bool("metrics.pair-distances", false, "Export the distance between every two icebreakers as icebreaker_pair_distance_nautical_miles")
+	maxPairs := fs.Int("metrics.max-pairs", 500, "Maximum number of icebreaker_pair_distance_nautical_miles series; above it none are exported")
+	mqttURL := fs.String("mqtt-url", "", "Digitraffic MQTT WebSocket URL for streaming updates, e.g. wss://meri.digitraffic.fi:443/mqtt (empty disables streaming)")
+	nmeaTCPAddress := fs.String("nmea-tcp-address", "", "Address to accept raw AIVDM/AIVDO sentences over TCP (empty disables)")
+	nmeaUDPAddress := fs.String("nmea-udp-address", "", "Address to accept raw AIVDM/AIVDO sentences over UDP (empty disables)")
+	nmeaFile := fs.String("nmea-file", "", "File of recorded AIVDM/AIVDO sentences to load at startup")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	var file File
+	if *configFile != "" {
+		var err error
+		if file, err = LoadFile(*configFile); err != nil {
+			return Config{}, err
+		}
+		if err := file.applySettings(fs); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", *configFile, err)
+		}
+	}
+
+	vessels := file.Vessels
+	if isSet(fs, "vessel-names") || len(vessels) == 0 {
+		vessels = ParseVesselNames(*targetVessels)
+	}
 
 	cfg := Config{
-		ListenAddress:   *listenAddress,
-		MetricsPath:     *metricsPath,
-		VesselsURL:      *vesselsURL,
-		LocationsURL:    *locationsURL,
-		DigitrafficUser: *digitrafficUser,
-		RefreshInterval: *refreshInterval,
-		RequestTimeout:  *requestTimeout,
-		TargetNames:     ParseTargetNames(*targetVessels),
+		Args:               slices.Clone(args),
+		ConfigFile:         *configFile,
+		ListenAddress:      *listenAddress,
+		MetricsPath:        *metricsPath,
+		VesselsURL:         *vesselsURL,
+		LocationsURL:       *locationsURL,
+		DigitrafficUser:    *digitrafficUser,
+		RefreshInterval:    *refreshInterval,
+		RequestTimeout:     *requestTimeout,
+		Vessels:            vessels,
+		Targets:            NewTargets(vessels),
+		TargetNames:        targetNames(vessels),
+		Zones:              file.zones,
+		SpoofingPoints:     file.SpoofingPoints,
+		KeepLastPlausible:  *keepLastPlausible,
+		AssistEnabled:      *assistEnabled,
+		AssistRadius:       *assistRadius,
+		AssistMinDuration:  *assistMinDuration,
+		PairDistances:      *pairDistances,
+		MaxPairs:           *maxPairs,
+		Parser:             *parser,
+		FetchStrategy:      *fetchStrategy,
+		FetchConcurrency:   *fetchConcurrency,
+		ResolveInterval:    *resolveInterval,
+		IncrementalRefresh: *incrementalRefresh,
+		RetryMaxAttempts:   *retryMaxAttempts,
+		RetryBaseDelay:     *retryBaseDelay,
+		RetryMaxDelay:      *retryMaxDelay,
+		BreakerThreshold:   *breakerThreshold,
+		BreakerCooldown:    *breakerCooldown,
+		HistoryRetention:   *historyRetention,
+		HistoryMaxPoints:   *historyMaxPoints,
+		StoragePath:        *storagePath,
+		WebTileURL:         *webTileURL,
+		WebTileAttribution: *webTileAttribution,
+		MQTTURL:            *mqttURL,
+		NMEATCPAddress:     *nmeaTCPAddress,
+		NMEAUDPAddress:     *nmeaUDPAddress,
+		NMEAFile:           *nmeaFile,
 	}
 	return cfg, nil
 }
 
-func ParseTargetNames(value string) map[string]struct{} {
-	out := make(map[string]struct{})
-	for _, item := range strings.Split(value, ",") {
-		norm := NormalizeName(item)
-		if norm == "" {
-			continue
+// Validate reports settings the exporter cannot run with.
+func (c Config) Validate() error {
+	if c.RefreshInterval <= 0 {
+		return errors.New("refresh-interval must be > 0")
+	}
+	if c.RequestTimeout <= 0 {
+		return errors.New("request-timeout must be > 0")
+	}
+	if c.RetryMaxAttempts <= 0 {
+		return errors.New("retry-max-attempts must be > 0")
+	}
+	if c.RetryBaseDelay < 0 || c.RetryMaxDelay < c.RetryBaseDelay {
+		return errors.New("retry-base-delay must be >= 0 and retry-max-delay >= retry-base-delay")
+	}
+	if c.BreakerThreshold < 0 {
+		return errors.New("breaker-threshold must be >= 0")
+	}
+	if c.BreakerThreshold > 0 && c.BreakerCooldown <= 0 {
+		return errors.New("breaker-cooldown must be > 0")
+	}
+	if c.HistoryRetention < 0 {
+		return errors.New("history-retention must be >= 0")
+	}
+	if c.HistoryMaxPoints < 0 {
+		return errors.New("history-max-points must be >= 0")
+	}
+	if c.Parser != ParserTyped && c.Parser != ParserHeuristic {
+		return fmt.Errorf("parser must be typed or heuristic, got %q", c.Parser)
+	}
+	switch c.FetchStrategy {
+	case FetchFull:
+	case FetchTargeted:
+		if c.Parser != ParserTyped {
+			return errors.New("the targeted fetch strategy requires the typed parser")
+		}
+		if c.FetchConcurrency <= 0 {
+			return errors.New("fetch-concurrency must be > 0")
+		}
+	default:
+		return fmt.Errorf("fetch-strategy must be full or targeted, got %q", c.FetchStrategy)
+	}
+	if c.MaxPairs < 0 {
+		return errors.New("metrics.max-pairs must be >= 0")
+	}
+	if c.AssistEnabled {
+		if c.FetchStrategy != FetchFull {
+			return errors.New("assist detection requires the full fetch strategy")
+		}
+		if c.AssistRadius <= 0 {
+			return errors.New("assist.radius must be > 0")
+		}
+		if c.AssistMinDuration < 0 {
+			return errors.New("assist.min-duration must be >= 0")
 		}
-		out[norm] = struct{}{}
 	}
-	return out
+	if c.Targets.Len() == 0 {
+		return errors.New("at least one vessel must be configured")
+	}
+	return nil
+}
+
+func isSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
 func NormalizeName(name string) string {
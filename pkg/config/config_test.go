@@ -53,3 +53,40 @@ func TestNormalizeName(t *testing.T) {
 		t.Errorf("NormalizeName() = %v, want OTSO", got)
 	}
 }
+
+func TestValidate(t *testing.T) {
+	valid, err := Parse(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("expected defaults to be valid, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"refresh interval", func(c *Config) { c.RefreshInterval = 0 }},
+		{"retry attempts", func(c *Config) { c.RetryMaxAttempts = 0 }},
+		{"retry delays", func(c *Config) { c.RetryMaxDelay = c.RetryBaseDelay / 2 }},
+		{"breaker threshold", func(c *Config) { c.BreakerThreshold = -1 }},
+		{"breaker cooldown", func(c *Config) { c.BreakerCooldown = 0 }},
+		{"parser", func(c *Config) { c.Parser = "magic" }},
+		{"targeted heuristic", func(c *Config) { c.FetchStrategy, c.Parser = FetchTargeted, ParserHeuristic }},
+		{"fetch strategy", func(c *Config) { c.FetchStrategy = "some" }},
+		{"no vessels", func(c *Config) { c.Targets = NewTargets(nil) }},
+		{"targeted assist", func(c *Config) { c.FetchStrategy, c.AssistEnabled = FetchTargeted, true }},
+		{"assist radius", func(c *Config) { c.AssistEnabled, c.AssistRadius = true, 0 }},
+		{"max pairs", func(c *Config) { c.MaxPairs = -1 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.modify(&cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// File is the layout of the -config.file YAML document.
+type File struct {
+	// Settings holds flag values keyed by flag name, e.g.
+	// refresh-interval: 5m. Flags given on the command line win.
+	Settings       map[string]any   `yaml:"settings"`
+	Vessels        []Vessel         `yaml:"vessels"`
+	Zones          []ZoneDefinition `yaml:"zones"`
+	SpoofingPoints []SpoofingPoint  `yaml:"spoofing_points"`
+
+	// zones are the loaded Zones.
+	zones []Zone
+}
+
+// LoadFile reads and validates a config file.
+func LoadFile(path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+
+	var file File
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return File{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateVessels(file.Vessels); err != nil {
+		return File{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateSpoofingPoints(file.SpoofingPoints); err != nil {
+		return File{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if file.zones, err = loadZones(file.Zones, filepath.Dir(path)); err != nil {
+		return File{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return file, nil
+}
+
+// applySettings sets the flags named in Settings unless they were given on
+// the command line.
+func (f File) applySettings(fs *flag.FlagSet) error {
+	explicit := map[string]struct{}{}
+	fs.Visit(func(fl *flag.Flag) { explicit[fl.Name] = struct{}{} })
+
+	for _, name := range slices.Sorted(maps.Keys(f.Settings)) {
+		if name == "config.file" || fs.Lookup(name) == nil {
+			return fmt.Errorf("unknown setting %q", name)
+		}
+		if _, ok := explicit[name]; ok {
+			continue
+		}
+		value := f.Settings[name]
+		switch value.(type) {
+		case map[string]any, []any, nil:
+			return fmt.Errorf("setting %q: expected a scalar value", name)
+		}
+		if err := fs.Set(name, fmt.Sprint(value)); err != nil {
+			return fmt.Errorf("setting %q: %w", name, err)
+		}
+	}
+	return nil
+}
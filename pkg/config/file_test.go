@@ -0,0 +1,151 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestParseConfigFile(t *testing.T) {
+	path := writeConfig(t, `
+settings:
+  refresh-interval: 5m
+  fetch-concurrency: 8
+  incremental-refresh: false
+vessels:
+  - name: Otso
+    mmsi: 230252000
+    operator: Arctia
+    fleet: finnish
+    labels:
+      region: bothnian_bay
+  - name: Ymer
+    imo: 7324372
+`)
+
+	cfg, err := Parse([]string{"-config.file", path, "-fetch-concurrency", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RefreshInterval != 5*time.Minute || cfg.IncrementalRefresh {
+		t.Errorf("expected settings from the file, got %+v", cfg)
+	}
+	if cfg.FetchConcurrency != 2 {
+		t.Errorf("expected the command line to override the file, got fetch concurrency %d", cfg.FetchConcurrency)
+	}
+	if len(cfg.Vessels) != 2 || cfg.Vessels[0].MMSI != "230252000" || cfg.Vessels[0].Labels["region"] != "bothnian_bay" || cfg.Vessels[1].IMO != 7324372 {
+		t.Errorf("unexpected vessels %+v", cfg.Vessels)
+	}
+
+	// -vessel-names replaces the vessels of the file.
+	cfg, err = Parse([]string{"-config.file", path, "-vessel-names", "URHO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Vessels) != 1 || cfg.Vessels[0].Name != "URHO" {
+		t.Errorf("expected -vessel-names to win, got %+v", cfg.Vessels)
+	}
+	if _, ok := cfg.TargetNames["URHO"]; !ok || len(cfg.TargetNames) != 1 {
+		t.Errorf("expected TargetNames to follow -vessel-names, got %v", cfg.TargetNames)
+	}
+}
+
+func TestParseConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown field", "vessel:\n  - name: Otso\n", "field vessel not found"},
+		{"unknown setting", "settings:\n  refresh: 5m\n", `unknown setting "refresh"`},
+		{"invalid setting", "settings:\n  refresh-interval: soon\n", `setting "refresh-interval"`},
+		{"empty vessel", "vessels:\n  - operator: Arctia\n", "one of name, mmsi or imo is required"},
+		{"bad mmsi", "vessels:\n  - mmsi: 1234\n", "not nine digits"},
+		{"duplicate mmsi", "vessels:\n  - mmsi: 230252000\n  - mmsi: 230252000\n", "duplicate mmsi"},
+		{"reserved label", "vessels:\n  - name: Otso\n    labels:\n      mmsi: x\n", "reserved"},
+		{"invalid label", "vessels:\n  - name: Otso\n    labels:\n      ice-class: x\n", "invalid label name"},
+		{"zone without shape", "zones:\n  - name: Kemi\n", "one of polygon or file is required"},
+		{"zone without name", "zones:\n  - polygon: [[[24, 65], [25, 65], [25, 66]]]\n", "name is required"},
+		{"degenerate zone", "zones:\n  - name: Kemi\n    polygon: [[[24, 65], [25, 65]]]\n", "three distinct points"},
+		{"duplicate zone", "zones:\n  - name: Kemi\n    polygon: [[[24, 65], [25, 65], [25, 66]]]\n  - name: Kemi\n    polygon: [[[24, 65], [25, 65], [25, 66]]]\n", "duplicate zone"},
+		{"missing zone file", "zones:\n  - file: missing.geojson\n", "missing.geojson"},
+		{"spoofing point latitude", "spoofing_points:\n  - latitude: 95\n    longitude: 30\n", "latitude 95 out of range"},
+		{"negative spoofing radius", "spoofing_points:\n  - latitude: 59.8\n    longitude: 30.26\n    radius: -1\n", "radius must be >= 0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]string{"-config.file", writeConfig(t, tt.content)})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestParseConfigFileSpoofingPoints(t *testing.T) {
+	path := writeConfig(t, `
+spoofing_points:
+  - name: Pulkovo
+    latitude: 59.80
+    longitude: 30.26
+  - latitude: 54.89
+    longitude: 20.59
+    radius: 3
+`)
+	cfg, err := Parse([]string{"-config.file", path, "-plausibility.keep-last"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.KeepLastPlausible {
+		t.Error("expected -plausibility.keep-last to be set")
+	}
+	if len(cfg.SpoofingPoints) != 2 || cfg.SpoofingPoints[0].Radius != DefaultSpoofingRadius || cfg.SpoofingPoints[1].Radius != 3 {
+		t.Errorf("unexpected spoofing points %+v", cfg.SpoofingPoints)
+	}
+}
+
+func TestParseConfigFileZones(t *testing.T) {
+	path := writeConfig(t, `
+zones:
+  - name: Kemi approach
+    polygon:
+      - [[24.2, 65.5], [24.8, 65.5], [24.8, 65.8], [24.2, 65.8]]
+      - [[24.5, 65.7], [24.6, 65.7], [24.6, 65.8]]
+  - file: basins.geojson
+  - name: Fairways
+    file: basins.geojson
+`)
+	basins := `{"type":"FeatureCollection","features":[
+		{"type":"Feature","properties":{"name":"Bay of Bothnia"},"geometry":{"type":"Polygon","coordinates":[[[21,63.5],[25.5,63.5],[25.5,66],[21,66],[21,63.5]]]}},
+		{"type":"Feature","properties":{"name":"Gulf of Finland"},"geometry":{"type":"Polygon","coordinates":[[[22.5,59.2],[30.5,59.2],[30.5,60.8],[22.5,60.8],[22.5,59.2]]]}}
+	]}`
+	if err := os.WriteFile(filepath.Join(filepath.Dir(path), "basins.geojson"), []byte(basins), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Parse([]string{"-config.file", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, z := range cfg.Zones {
+		names = append(names, z.Name)
+	}
+	if got := strings.Join(names, ","); got != "Kemi approach,Bay of Bothnia,Gulf of Finland,Fairways" {
+		t.Fatalf("unexpected zones %s", got)
+	}
+	if len(cfg.Zones[0].Shape[0]) != 2 || len(cfg.Zones[3].Shape) != 2 {
+		t.Errorf("unexpected shapes %+v", cfg.Zones)
+	}
+}
@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"math"
+)
+
+// DefaultSpoofingRadius is the radius of a spoofing point that does not set
+// one, in nautical miles.
+const DefaultSpoofingRadius = 1
+
+// SpoofingPoint is a place GNSS spoofing is known to move ships to. Reports
+// within Radius nautical miles of it are implausible.
+type SpoofingPoint struct {
+	Name      string  `yaml:"name"`
+	Latitude  float64 `yaml:"latitude"`
+	Longitude float64 `yaml:"longitude"`
+	Radius    float64 `yaml:"radius"`
+}
+
+// validateSpoofingPoints checks the points of a config file and fills in
+// the default radius.
+func validateSpoofingPoints(points []SpoofingPoint) error {
+	for i := range points {
+		p := &points[i]
+		switch {
+		case math.Abs(p.Latitude) > 90:
+			return fmt.Errorf("spoofing point %d: latitude %g out of range", i+1, p.Latitude)
+		case math.Abs(p.Longitude) > 180:
+			return fmt.Errorf("spoofing point %d: longitude %g out of range", i+1, p.Longitude)
+		case p.Radius < 0:
+			return fmt.Errorf("spoofing point %d: radius must be >= 0", i+1)
+		case p.Radius == 0:
+			p.Radius = DefaultSpoofingRadius
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Vessel is one tracked vessel definition.
+type Vessel struct {
+	Name string `yaml:"name"`
+	// MMSI and IMO pin the definition to one vessel; other vessels with the
+	// same name are ignored.
+	MMSI     string `yaml:"mmsi"`
+	IMO      int    `yaml:"imo"`
+	Operator string `yaml:"operator"`
+	Fleet    string `yaml:"fleet"`
+	// Labels are attached to every per-vessel series.
+	Labels map[string]string `yaml:"labels"`
+}
+
+// reservedLabels are label names the exporter sets itself.
+var reservedLabels = map[string]struct{}{
+	"vessel_name": {}, "mmsi": {}, "country": {}, "operator": {}, "fleet": {},
+	"country_name": {}, "imo": {}, "callsign": {}, "ship_type": {}, "destination": {},
+	"state": {}, "zone": {}, "sea_area": {}, "port": {}, "locode": {}, "nearest": {}, "nearest_mmsi": {}, "reason": {}, "job": {}, "instance": {},
+}
+
+var labelName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// ParseVesselNames turns a comma separated list of names into name-only
+// vessel definitions.
+func ParseVesselNames(value string) []Vessel {
+	var out []Vessel
+	seen := map[string]struct{}{}
+	for _, item := range strings.Split(value, ",") {
+		norm := NormalizeName(item)
+		if norm == "" {
+			continue
+		}
+		if _, ok := seen[norm]; ok {
+			continue
+		}
+		seen[norm] = struct{}{}
+		out = append(out, Vessel{Name: norm})
+	}
+	return out
+}
+
+// ParseTargetNames turns a comma separated list of names into a set of
+// normalized names.
+func ParseTargetNames(value string) map[string]struct{} {
+	return targetNames(ParseVesselNames(value))
+}
+
+func targetNames(vessels []Vessel) map[string]struct{} {
+	out := make(map[string]struct{}, len(vessels))
+	for _, v := range vessels {
+		if norm := NormalizeName(v.Name); norm != "" {
+			out[norm] = struct{}{}
+		}
+	}
+	return out
+}
+
+// validateVessels checks the definitions of a config file.
+func validateVessels(vessels []Vessel) error {
+	mmsis := map[string]struct{}{}
+	imos := map[int]struct{}{}
+	for i, v := range vessels {
+		if strings.TrimSpace(v.Name) == "" && v.MMSI == "" && v.IMO == 0 {
+			return fmt.Errorf("vessel %d: one of name, mmsi or imo is required", i+1)
+		}
+		if v.MMSI != "" {
+			if _, err := strconv.Atoi(v.MMSI); err != nil || len(v.MMSI) != 9 {
+				return fmt.Errorf("vessel %d: mmsi %q is not nine digits", i+1, v.MMSI)
+			}
+			if _, dup := mmsis[v.MMSI]; dup {
+				return fmt.Errorf("vessel %d: duplicate mmsi %s", i+1, v.MMSI)
+			}
+			mmsis[v.MMSI] = struct{}{}
+		}
+		if v.IMO != 0 {
+			if v.IMO < 1000000 || v.IMO > 9999999 {
+				return fmt.Errorf("vessel %d: imo %d is not seven digits", i+1, v.IMO)
+			}
+			if _, dup := imos[v.IMO]; dup {
+				return fmt.Errorf("vessel %d: duplicate imo %d", i+1, v.IMO)
+			}
+			imos[v.IMO] = struct{}{}
+		}
+		for name := range v.Labels {
+			if !labelName.MatchString(name) || strings.HasPrefix(name, "__") {
+				return fmt.Errorf("vessel %d: invalid label name %q", i+1, name)
+			}
+			if _, reserved := reservedLabels[name]; reserved {
+				return fmt.Errorf("vessel %d: label name %q is reserved", i+1, name)
+			}
+		}
+	}
+	return nil
+}
+
+// Targets matches AIS vessels against the vessel definitions.
+type Targets struct {
+	vessels []Vessel
+	byMMSI  map[string]int
+	byIMO   map[int]int
+	byName  map[string]int
+}
+
+func NewTargets(vessels []Vessel) *Targets {
+	t := &Targets{
+		vessels: vessels,
+		byMMSI:  map[string]int{},
+		byIMO:   map[int]int{},
+		byName:  map[string]int{},
+	}
+	for i, v := range vessels {
+		if v.MMSI != "" {
+			t.byMMSI[v.MMSI] = i
+		}
+		if v.IMO != 0 {
+			t.byIMO[v.IMO] = i
+		}
+		if v.MMSI == "" && v.IMO == 0 {
+			t.byName[NormalizeName(v.Name)] = i
+		}
+	}
+	return t
+}
+
+// Match returns the definition a vessel belongs to. Definitions with an MMSI
+// or IMO only match that vessel; name-only definitions match any vessel of
+// that name. imo may be 0 when unknown.
+func (t *Targets) Match(mmsi, name string, imo int) (Vessel, bool) {
+	if t == nil {
+		return Vessel{}, false
+	}
+	if i, ok := t.byMMSI[mmsi]; ok && mmsi != "" {
+		return t.vessels[i], true
+	}
+	if i, ok := t.byIMO[imo]; ok && imo != 0 {
+		return t.vessels[i], true
+	}
+	if i, ok := t.byName[NormalizeName(name)]; ok {
+		return t.vessels[i], true
+	}
+	return Vessel{}, false
+}
+
+// MMSIs returns the MMSIs pinned by the definitions.
+func (t *Targets) MMSIs() []string {
+	if t == nil {
+		return nil
+	}
+	out := make([]string, 0, len(t.byMMSI))
+	for _, v := range t.vessels {
+		if v.MMSI != "" {
+			out = append(out, v.MMSI)
+		}
+	}
+	return out
+}
+
+// Len returns the number of vessel definitions.
+func (t *Targets) Len() int {
+	if t == nil {
+		return 0
+	}
+	return len(t.vessels)
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTargetsMatch(t *testing.T) {
+	targets := NewTargets([]Vessel{
+		{Name: "OTSO", MMSI: "230252000", Operator: "Arctia"},
+		{Name: "YMER", IMO: 7324372},
+		{Name: "URHO"},
+	})
+
+	tests := []struct {
+		name  string
+		mmsi  string
+		vname string
+		imo   int
+		want  string
+		ok    bool
+	}{
+		{"pinned mmsi", "230252000", "Otso", 0, "OTSO", true},
+		{"same name, other mmsi", "230999999", "Otso", 0, "", false},
+		{"pinned imo", "265547250", "Ymer", 7324372, "YMER", true},
+		{"same name, other imo", "265000000", "Ymer", 9999999, "", false},
+		{"name only", "230111000", " urho ", 0, "URHO", true},
+		{"unknown", "230111000", "KONTIO", 0, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := targets.Match(tt.mmsi, tt.vname, tt.imo)
+			if ok != tt.ok || got.Name != tt.want {
+				t.Errorf("Match() = %+v, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	if got := targets.MMSIs(); len(got) != 1 || got[0] != "230252000" {
+		t.Errorf("MMSIs() = %v", got)
+	}
+	var none *Targets
+	if _, ok := none.Match("230252000", "OTSO", 0); ok || none.Len() != 0 {
+		t.Error("expected a nil Targets to match nothing")
+	}
+}
+
+func TestParseVesselNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{
+			name:     "single",
+			input:    "OTSO",
+			expected: []string{"OTSO"},
+		},
+		{
+			name:     "with spaces and mixed case",
+			input:    " Otso, KONTIO , urho ",
+			expected: []string{"OTSO", "KONTIO", "URHO"},
+		},
+		{
+			name:     "empty items",
+			input:    "OTSO,,KONTIO,",
+			expected: []string{"OTSO", "KONTIO"},
+		},
+		{
+			name:     "duplicates",
+			input:    "Otso,KONTIO,otso",
+			expected: []string{"OTSO", "KONTIO"},
+		},
+		{
+			name:  "empty string",
+			input: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range ParseVesselNames(tt.input) {
+				if v.MMSI != "" || v.IMO != 0 {
+					t.Errorf("expected a name-only definition, got %+v", v)
+				}
+				got = append(got, v.Name)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ParseVesselNames() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
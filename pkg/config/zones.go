@@ -0,0 +1,104 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+)
+
+// Zone is a named geofence.
+type Zone struct {
+	Name  string
+	Shape geo.MultiPolygon
+}
+
+// ZoneDefinition is a zone of the config file. Polygon holds GeoJSON style
+// rings of [longitude, latitude] pairs, the outer ring first and then its
+// holes. File names a GeoJSON document, relative to the config file; without
+// a name, each of its features becomes a zone named by its "name" property.
+type ZoneDefinition struct {
+	Name    string        `yaml:"name"`
+	Polygon [][][]float64 `yaml:"polygon"`
+	File    string        `yaml:"file"`
+}
+
+// loadZones builds the zones of a config file in dir.
+func loadZones(defs []ZoneDefinition, dir string) ([]Zone, error) {
+	var zones []Zone
+	seen := map[string]struct{}{}
+	add := func(z Zone) error {
+		if strings.TrimSpace(z.Name) == "" {
+			return errors.New("name is required")
+		}
+		if _, dup := seen[z.Name]; dup {
+			return fmt.Errorf("duplicate zone %q", z.Name)
+		}
+		seen[z.Name] = struct{}{}
+		zones = append(zones, z)
+		return nil
+	}
+
+	for i, def := range defs {
+		var err error
+		switch {
+		case def.File != "" && def.Polygon != nil:
+			err = errors.New("polygon and file are mutually exclusive")
+		case def.Polygon != nil:
+			var poly geo.Polygon
+			if poly, err = geo.PolygonFromCoordinates(def.Polygon); err == nil {
+				err = add(Zone{Name: def.Name, Shape: geo.MultiPolygon{poly}})
+			}
+		case def.File != "":
+			err = loadZoneFile(def, dir, add)
+		default:
+			err = errors.New("one of polygon or file is required")
+		}
+		if err != nil {
+			if def.Name != "" {
+				return nil, fmt.Errorf("zone %q: %w", def.Name, err)
+			}
+			return nil, fmt.Errorf("zone %d: %w", i+1, err)
+		}
+	}
+	return zones, nil
+}
+
+// loadZoneFile adds the zones of a GeoJSON file: one zone with all
+// polygons of the file if def is named, one per feature otherwise.
+func loadZoneFile(def ZoneDefinition, dir string, add func(Zone) error) error {
+	path := def.File
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	features, err := geo.DecodeGeoJSON(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", def.File, err)
+	}
+	if len(features) == 0 {
+		return fmt.Errorf("%s: no polygons", def.File)
+	}
+
+	if def.Name != "" {
+		var shape geo.MultiPolygon
+		for _, feature := range features {
+			shape = append(shape, feature.Shape...)
+		}
+		return add(Zone{Name: def.Name, Shape: shape})
+	}
+	for i, feature := range features {
+		if err := add(Zone{Name: feature.Name(), Shape: feature.Shape}); err != nil {
+			return fmt.Errorf("%s: feature %d: %w", def.File, i+1, err)
+		}
+	}
+	return nil
+}
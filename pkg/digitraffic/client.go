@@ -0,0 +1,270 @@
+// Package digitraffic is a typed client for the Digitraffic marine AIS v1
+// REST API (https://meri.digitraffic.fi/api/ais/v1).
+package digitraffic
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrNotModified is returned by conditional requests when the endpoint
+// answered 304 Not Modified since the previous successful request.
+var ErrNotModified = errors.New("digitraffic: not modified")
+
+// SchemaError reports a payload that does not match the documented AIS v1
+// schema, e.g. after an upstream API change.
+type SchemaError struct {
+	Endpoint string
+	Reason   string
+}
+
+func (e *SchemaError) Error() string {
+	return fmt.Sprintf("digitraffic: unexpected schema from %s: %s", e.Endpoint, e.Reason)
+}
+
+// StatusError is returned for non-200 responses.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status %s: %s", e.Status, e.Body)
+}
+
+type Client struct {
+	HTTP         *http.Client
+	VesselsURL   string
+	LocationsURL string
+	// User is sent as the Digitraffic-User header.
+	User string
+	// Retry is applied to every request. Breaker is optional.
+	Retry   RetryPolicy
+	Breaker *Breaker
+
+	mu         sync.Mutex
+	validators map[string]validator
+
+	bytes   atomic.Uint64
+	records atomic.Uint64
+	retries atomic.Uint64
+}
+
+// validator holds the cache validators of the last 200 reply of an endpoint.
+type validator struct {
+	etag         string
+	lastModified string
+}
+
+// Transferred returns the total number of response bytes read from the wire
+// (compressed, if the server used gzip) and payload records decoded.
+func (c *Client) Transferred() (bytes, records uint64) {
+	return c.bytes.Load(), c.records.Load()
+}
+
+// get performs a GET request and returns the response body of a 200 reply
+// along with its validators. The caller must close the body. Responses are
+// requested gzip-compressed. A non-empty validatorKey makes the request
+// conditional: the validators stored under that key by saveValidator are
+// sent and ErrNotModified is returned for a 304.
+func (c *Client) get(ctx context.Context, endpoint, validatorKey string) (io.ReadCloser, validator, error) {
+	conditional := validatorKey != ""
+	resp, err := c.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Accept-Encoding", "gzip")
+		if c.User != "" {
+			req.Header.Set("Digitraffic-User", c.User)
+		}
+		if conditional {
+			c.mu.Lock()
+			v := c.validators[validatorKey]
+			c.mu.Unlock()
+			if v.etag != "" {
+				req.Header.Set("If-None-Match", v.etag)
+			}
+			if v.lastModified != "" {
+				req.Header.Set("If-Modified-Since", v.lastModified)
+			}
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, validator{}, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotModified:
+		resp.Body.Close()
+		if conditional {
+			return nil, validator{}, ErrNotModified
+		}
+		fallthrough
+	default:
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, validator{}, &StatusError{StatusCode: resp.StatusCode, Status: resp.Status, Body: strings.TrimSpace(string(body))}
+	}
+
+	v := validator{etag: resp.Header.Get("ETag"), lastModified: resp.Header.Get("Last-Modified")}
+	counted := &countingReader{r: resp.Body, n: &c.bytes}
+	if !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return readCloser{counted, resp.Body}, v, nil
+	}
+	zr, err := gzip.NewReader(counted)
+	if err != nil {
+		resp.Body.Close()
+		return nil, validator{}, fmt.Errorf("gzip: %w", err)
+	}
+	return readCloser{zr, resp.Body}, v, nil
+}
+
+// saveValidator stores the validators of a reply under validatorKey once
+// its payload was fully decoded. Saving them earlier would turn the next
+// request into a 304 for a payload that was never applied.
+func (c *Client) saveValidator(validatorKey string, v validator) {
+	if validatorKey == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.validators == nil {
+		c.validators = map[string]validator{}
+	}
+	c.validators[validatorKey] = v
+}
+
+// do sends the request built by newReq, retrying transient failures
+// according to c.Retry and reporting outcomes to c.Breaker. The response of
+// the last attempt is returned even if its status is an error.
+func (c *Client) do(ctx context.Context, newReq func() (*http.Request, error)) (*http.Response, error) {
+	attempts := max(c.Retry.MaxAttempts, 1)
+	for attempt := 1; ; attempt++ {
+		// Build the request first: a half-open breaker that let it through
+		// waits for its outcome.
+		req, err := newReq()
+		if err != nil {
+			return nil, err
+		}
+		if c.Breaker != nil && !c.Breaker.Allow() {
+			return nil, ErrCircuitOpen
+		}
+
+		resp, err := c.HTTP.Do(req)
+		var (
+			wait    time.Duration
+			waitSet bool
+		)
+		switch {
+		case err != nil:
+			// A request abandoned by the caller says nothing about the
+			// health of Digitraffic.
+			if ctx.Err() != nil {
+				if c.Breaker != nil {
+					c.Breaker.Release()
+				}
+				return nil, err
+			}
+			c.breakerFailure()
+			if attempt >= attempts {
+				return nil, err
+			}
+		case retryable(resp.StatusCode):
+			c.breakerFailure()
+			if attempt >= attempts {
+				return resp, nil
+			}
+			wait, waitSet = retryAfter(resp, time.Now())
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		default:
+			if c.Breaker != nil {
+				c.Breaker.Success()
+			}
+			return resp, nil
+		}
+
+		switch {
+		case !waitSet:
+			wait = c.Retry.backoff(attempt)
+		case c.Retry.MaxDelay > 0:
+			wait = min(wait, c.Retry.MaxDelay)
+		}
+		c.retries.Add(1)
+		if err := sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) breakerFailure() {
+	if c.Breaker != nil {
+		c.Breaker.Failure()
+	}
+}
+
+// Retries returns the total number of retried requests.
+func (c *Client) Retries() uint64 {
+	return c.retries.Load()
+}
+
+// countingReader adds the number of bytes read to n.
+type countingReader struct {
+	r io.Reader
+	n *atomic.Uint64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n.Add(uint64(n))
+	return n, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// FetchGeneric decodes an arbitrary JSON document with numbers preserved as
+// json.Number. It backs the schema-agnostic heuristic parser.
+func (c *Client) FetchGeneric(ctx context.Context, endpoint string) (any, error) {
+	body, _, err := c.get(ctx, endpoint, "")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	dec.UseNumber()
+	var payload any
+	if err := dec.Decode(&payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// expectDelim consumes the next token and checks that it is delim.
+func expectDelim(dec *json.Decoder, delim json.Delim, endpoint, where string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != delim {
+		return &SchemaError{Endpoint: endpoint, Reason: fmt.Sprintf("expected %q at %s, got %v", delim, where, tok)}
+	}
+	return nil
+}
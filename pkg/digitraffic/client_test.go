@@ -0,0 +1,261 @@
+package digitraffic
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+const (
+	vesselsPayload = `[
+		{"mmsi":230124000,"name":"OTSO","shipType":52,"referencePointA":60,"referencePointB":39,"referencePointC":12,"referencePointD":12,"callSign":"OHMN","imo":8914428,"draught":80,"eta":754432,"timestamp":1700000000000,"destination":"KEMI"},
+		{"mmsi":265010000,"name":"ODEN","shipType":52,"timestamp":1700000000000},
+		{"mmsi":111111111,"name":"RANDOM","timestamp":1700000000000}
+	]`
+	locationsPayload = `{
+		"type":"FeatureCollection",
+		"dataUpdatedTime":"2023-11-14T22:13:20Z",
+		"features":[
+			{"mmsi":230124000,"type":"Feature","geometry":{"type":"Point","coordinates":[24.9,65.7]},
+			 "properties":{"mmsi":230124000,"sog":0.0,"cog":360.0,"navStat":5,"rot":-128,"posAcc":true,"raim":false,"heading":511,"timestamp":30,"timestampExternal":1700000000123}},
+			{"mmsi":111111111,"type":"Feature","geometry":{"type":"Point","coordinates":[10,10]},
+			 "properties":{"mmsi":111111111,"sog":12.0,"timestampExternal":1700000000000}}
+		]
+	}`
+)
+
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	return &Client{
+		HTTP:         srv.Client(),
+		VesselsURL:   srv.URL + "/vessels",
+		LocationsURL: srv.URL + "/locations",
+		User:         "test/1.0",
+	}
+}
+
+func TestFetchVessels(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Digitraffic-User") != "test/1.0" {
+			t.Errorf("missing Digitraffic-User header")
+		}
+		_, _ = io.WriteString(w, vesselsPayload)
+	})
+
+	vessels, err := c.FetchVessels(context.Background(), func(v Vessel) bool { return v.Name != "RANDOM" })
+	if err != nil {
+		t.Fatalf("FetchVessels() error = %v", err)
+	}
+	if len(vessels) != 2 {
+		t.Fatalf("expected 2 vessels, got %d", len(vessels))
+	}
+	meta := vessels[0].Metadata()
+	if meta.MMSI != "230124000" || meta.Name != "OTSO" || meta.Updated.UnixMilli() != 1700000000000 {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+	// eta 754432 packs 11-16 12:00 UTC.
+	if meta.IMO != 8914428 || meta.CallSign != "OHMN" || meta.ShipType != 52 || meta.Destination != "KEMI" ||
+		meta.Draught != 8 || meta.Length != 99 || meta.Beam != 24 || !meta.ETA.Equal(time.Date(2023, 11, 16, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected static data %+v", meta.StaticData)
+	}
+}
+
+func TestFetchLocations(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, locationsPayload)
+	})
+
+	locs, err := c.FetchLocations(context.Background(), func(mmsi string) bool { return mmsi == "230124000" })
+	if err != nil {
+		t.Fatalf("FetchLocations() error = %v", err)
+	}
+	if len(locs.Features) != 1 {
+		t.Fatalf("expected 1 feature, got %d", len(locs.Features))
+	}
+	if locs.DataUpdatedTime.Unix() != 1700000000 {
+		t.Errorf("unexpected dataUpdatedTime %v", locs.DataUpdatedTime)
+	}
+	if len(locs.Sightings) != 2 || locs.Sightings[1] != (models.LocationRecord{MMSI: "111111111", Longitude: 10, Latitude: 10}) {
+		t.Errorf("expected a sighting of every feature, got %+v", locs.Sightings)
+	}
+
+	rec := locs.Features[0].Location()
+	if rec.MMSI != "230124000" || rec.Latitude != 65.7 || rec.Longitude != 24.9 || rec.Timestamp != 1700000000 {
+		t.Errorf("unexpected location %+v", rec)
+	}
+	if rec.SpeedOverGround == nil || *rec.SpeedOverGround != 0 {
+		t.Errorf("expected real SOG=0, got %v", rec.SpeedOverGround)
+	}
+	if rec.CourseOverGround != nil || rec.Heading != nil || rec.RateOfTurn != nil {
+		t.Errorf("expected sentinels to be dropped, got %+v", rec)
+	}
+	if rec.NavigationStatus == nil || *rec.NavigationStatus != 5 {
+		t.Errorf("expected NavStat=5, got %v", rec.NavigationStatus)
+	}
+}
+
+func TestFetchSchemaDrift(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		fetch   func(*Client) error
+	}{
+		{
+			name:    "vessels not an array",
+			payload: `{"vessels":[]}`,
+			fetch: func(c *Client) error {
+				_, err := c.FetchVessels(context.Background(), nil)
+				return err
+			},
+		},
+		{
+			name:    "vessel mmsi as object",
+			payload: `[{"mmsi":{"value":1},"name":"OTSO"}]`,
+			fetch: func(c *Client) error {
+				_, err := c.FetchVessels(context.Background(), nil)
+				return err
+			},
+		},
+		{
+			name:    "locations not a feature collection",
+			payload: `{"type":"Feature","features":[]}`,
+			fetch: func(c *Client) error {
+				_, err := c.FetchLocations(context.Background(), nil)
+				return err
+			},
+		},
+		{
+			name:    "locations without features",
+			payload: `{"type":"FeatureCollection"}`,
+			fetch: func(c *Client) error {
+				_, err := c.FetchLocations(context.Background(), nil)
+				return err
+			},
+		},
+		{
+			name:    "feature geometry changed",
+			payload: `{"type":"FeatureCollection","features":[{"mmsi":1,"type":"Feature","geometry":{"type":"LineString","coordinates":[[1,2],[3,4]]}}]}`,
+			fetch: func(c *Client) error {
+				_, err := c.FetchLocations(context.Background(), nil)
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = io.WriteString(w, tt.payload)
+			})
+			var schemaErr *SchemaError
+			if err := tt.fetch(c); !errors.As(err, &schemaErr) {
+				t.Errorf("expected SchemaError, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFetchStatusError(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "upstream down", http.StatusBadGateway)
+	})
+	if _, err := c.FetchVessels(context.Background(), nil); err == nil {
+		t.Fatal("expected error for 502 response")
+	}
+}
+
+func TestFetchVesselsConditionalGzip(t *testing.T) {
+	var calls int
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			t.Errorf("expected Accept-Encoding gzip, got %q", r.Header.Get("Accept-Encoding"))
+		}
+		if calls > 1 {
+			if r.Header.Get("If-None-Match") != `"v1"` || r.Header.Get("If-Modified-Since") != "Tue, 14 Nov 2023 22:13:20 GMT" {
+				t.Errorf("missing validators, got %v", r.Header)
+			}
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Tue, 14 Nov 2023 22:13:20 GMT")
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		_, _ = io.WriteString(zw, vesselsPayload)
+		_ = zw.Close()
+	})
+
+	vessels, err := c.FetchVesselsIfModified(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("FetchVesselsIfModified() error = %v", err)
+	}
+	if len(vessels) != 3 {
+		t.Fatalf("expected 3 vessels, got %d", len(vessels))
+	}
+	bytes, records := c.Transferred()
+	if bytes == 0 || bytes >= uint64(len(vesselsPayload)) || records != 3 {
+		t.Errorf("unexpected transfer stats bytes=%d records=%d", bytes, records)
+	}
+
+	if _, err := c.FetchVesselsIfModified(context.Background(), nil); !errors.Is(err, ErrNotModified) {
+		t.Fatalf("expected ErrNotModified, got %v", err)
+	}
+}
+
+func TestFetchVesselsBrokenBodyKeepsNoValidators(t *testing.T) {
+	var calls int
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		if calls == 1 {
+			_, _ = io.WriteString(w, vesselsPayload[:len(vesselsPayload)/2])
+			return
+		}
+		_, _ = io.WriteString(w, vesselsPayload)
+	})
+
+	if _, err := c.FetchVesselsIfModified(context.Background(), nil); err == nil {
+		t.Fatal("expected error for truncated payload")
+	}
+	vessels, err := c.FetchVesselsIfModified(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("expected a full fetch after the broken payload, got %v", err)
+	}
+	if len(vessels) != 3 {
+		t.Fatalf("expected 3 vessels, got %d", len(vessels))
+	}
+	if _, err := c.FetchVesselsIfModified(context.Background(), nil); !errors.Is(err, ErrNotModified) {
+		t.Fatalf("expected ErrNotModified once the payload decoded, got %v", err)
+	}
+}
+
+func TestFetchLocationsFrom(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("from"); got != "1700000000000" {
+			t.Errorf("expected from=1700000000000, got %q", got)
+		}
+		_, _ = io.WriteString(w, locationsPayload)
+	})
+
+	locs, err := c.FetchLocationsFrom(context.Background(), time.UnixMilli(1700000000000), nil)
+	if err != nil {
+		t.Fatalf("FetchLocationsFrom() error = %v", err)
+	}
+	if len(locs.Features) != 2 {
+		t.Errorf("expected 2 features, got %d", len(locs.Features))
+	}
+}
@@ -0,0 +1,260 @@
+package digitraffic
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/ais"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// Feature is one GeoJSON feature of the /locations FeatureCollection.
+type Feature struct {
+	MMSI       int                `json:"mmsi"`
+	Type       string             `json:"type"`
+	Geometry   Geometry           `json:"geometry"`
+	Properties LocationProperties `json:"properties"`
+}
+
+type Geometry struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"` // [lon, lat]
+}
+
+// LocationProperties holds the AIS position report fields. Pointer fields
+// are nil when Digitraffic omits them.
+type LocationProperties struct {
+	MMSI    int      `json:"mmsi"`
+	SOG     *float64 `json:"sog"`
+	COG     *float64 `json:"cog"`
+	NavStat *int     `json:"navStat"`
+	ROT     *float64 `json:"rot"`
+	PosAcc  bool     `json:"posAcc"`
+	RAIM    bool     `json:"raim"`
+	Heading *float64 `json:"heading"`
+	// Timestamp is the UTC second (0-59) from the AIS message itself.
+	Timestamp int `json:"timestamp"`
+	// TimestampExternal is when the report was received, in epoch millis.
+	TimestampExternal int64 `json:"timestampExternal"`
+}
+
+// Locations is the decoded /locations payload, restricted to the features
+// that were kept. Sightings holds the MMSI and coordinates of every feature,
+// kept or not, for checks that look at the whole fleet.
+type Locations struct {
+	DataUpdatedTime time.Time
+	Features        []Feature
+	Sightings       []models.LocationRecord
+}
+
+// Location converts the feature to the exporter's model, dropping AIS
+// "not available" sentinels.
+func (f Feature) Location() models.LocationRecord {
+	rec := models.LocationRecord{
+		MMSI:             strconv.Itoa(f.MMSI),
+		Longitude:        f.Geometry.Coordinates[0],
+		Latitude:         f.Geometry.Coordinates[1],
+		SpeedOverGround:  optional(f.Properties.SOG, ais.Speed),
+		CourseOverGround: optional(f.Properties.COG, ais.Course),
+		Heading:          optional(f.Properties.Heading, ais.Heading),
+		RateOfTurn:       optional(f.Properties.ROT, ais.RateOfTurn),
+	}
+	if f.Properties.NavStat != nil {
+		rec.NavigationStatus = ais.NavigationStatus(*f.Properties.NavStat)
+	}
+	if f.Properties.TimestampExternal > 0 {
+		rec.Timestamp = f.Properties.TimestampExternal / 1000
+	}
+	return rec
+}
+
+// FetchLocations streams the /locations FeatureCollection. Features are
+// only fully decoded when keep accepts their MMSI; a nil keep accepts all.
+func (c *Client) FetchLocations(ctx context.Context, keep func(mmsi string) bool) (Locations, error) {
+	return c.fetchLocations(ctx, c.LocationsURL, keep, "")
+}
+
+// FetchLocationsFrom requests only the locations received after from, as a
+// conditional request. It returns ErrNotModified when nothing changed since
+// the previous call.
+func (c *Client) FetchLocationsFrom(ctx context.Context, from time.Time, keep func(mmsi string) bool) (Locations, error) {
+	u, err := url.Parse(c.LocationsURL)
+	if err != nil {
+		return Locations{}, err
+	}
+	q := u.Query()
+	q.Set("from", strconv.FormatInt(from.UnixMilli(), 10))
+	u.RawQuery = q.Encode()
+
+	// Validators are keyed on the base URL rather than on the ever-changing
+	// from parameter.
+	return c.fetchLocations(ctx, u.String(), keep, c.LocationsURL)
+}
+
+// FetchLocation requests the latest location of a single vessel via the
+// mmsi query parameter. found is false when Digitraffic has no position for
+// the MMSI.
+func (c *Client) FetchLocation(ctx context.Context, mmsi string) (feature Feature, found bool, err error) {
+	u, err := url.Parse(c.LocationsURL)
+	if err != nil {
+		return Feature{}, false, err
+	}
+	q := u.Query()
+	q.Set("mmsi", mmsi)
+	u.RawQuery = q.Encode()
+
+	locs, err := c.fetchLocations(ctx, u.String(), func(m string) bool { return m == mmsi }, "")
+	if err != nil {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			return Feature{}, false, nil
+		}
+		return Feature{}, false, err
+	}
+	if len(locs.Features) == 0 {
+		return Feature{}, false, nil
+	}
+	return locs.Features[0], true, nil
+}
+
+func (c *Client) fetchLocations(ctx context.Context, endpoint string, keep func(mmsi string) bool, validatorKey string) (Locations, error) {
+	body, v, err := c.get(ctx, endpoint, validatorKey)
+	if err != nil {
+		return Locations{}, err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	if err := expectDelim(dec, '{', endpoint, "start of locations payload"); err != nil {
+		return Locations{}, err
+	}
+
+	var (
+		out          Locations
+		seenType     bool
+		seenFeatures bool
+	)
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return Locations{}, err
+		}
+		key, _ := tok.(string)
+
+		switch key {
+		case "type":
+			var typ string
+			if err := dec.Decode(&typ); err != nil {
+				return Locations{}, &SchemaError{Endpoint: endpoint, Reason: "type: " + err.Error()}
+			}
+			if typ != "FeatureCollection" {
+				return Locations{}, &SchemaError{Endpoint: endpoint, Reason: fmt.Sprintf("expected FeatureCollection, got %q", typ)}
+			}
+			seenType = true
+		case "dataUpdatedTime":
+			var ts string
+			if err := dec.Decode(&ts); err != nil {
+				return Locations{}, &SchemaError{Endpoint: endpoint, Reason: "dataUpdatedTime: " + err.Error()}
+			}
+			if parsed, err := time.Parse(time.RFC3339, ts); err == nil {
+				out.DataUpdatedTime = parsed
+			}
+		case "features":
+			features, sightings, total, err := decodeFeatures(dec, endpoint, keep)
+			if err != nil {
+				return Locations{}, err
+			}
+			c.records.Add(uint64(total))
+			out.Features, out.Sightings = features, sightings
+			seenFeatures = true
+		default:
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return Locations{}, err
+			}
+		}
+	}
+
+	if err := expectDelim(dec, '}', endpoint, "end of locations payload"); err != nil {
+		return Locations{}, err
+	}
+	if !seenType || !seenFeatures {
+		return Locations{}, &SchemaError{Endpoint: endpoint, Reason: "missing type or features"}
+	}
+	c.saveValidator(validatorKey, v)
+	return out, nil
+}
+
+// featureProbe extracts just the MMSI and coordinates so unwanted features
+// are never fully materialised. The coordinates stay raw: a feature that is
+// not a Point only fails the payload when it is kept.
+type featureProbe struct {
+	MMSI     int `json:"mmsi"`
+	Geometry struct {
+		Coordinates json.RawMessage `json:"coordinates"`
+	} `json:"geometry"`
+}
+
+// decodeFeatures returns the kept features, the sightings of all features
+// and the number of features in the payload.
+func decodeFeatures(dec *json.Decoder, endpoint string, keep func(string) bool) ([]Feature, []models.LocationRecord, int, error) {
+	if err := expectDelim(dec, '[', endpoint, "start of features"); err != nil {
+		return nil, nil, 0, err
+	}
+
+	var (
+		out       []Feature
+		sightings []models.LocationRecord
+		total     int
+	)
+	for dec.More() {
+		total++
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, nil, 0, err
+		}
+
+		var probe featureProbe
+		if err := json.Unmarshal(raw, &probe); err != nil {
+			return nil, nil, 0, &SchemaError{Endpoint: endpoint, Reason: "feature: " + err.Error()}
+		}
+		if probe.MMSI <= 0 {
+			return nil, nil, 0, &SchemaError{Endpoint: endpoint, Reason: "feature without mmsi"}
+		}
+		mmsi := strconv.Itoa(probe.MMSI)
+		var coords []float64
+		if json.Unmarshal(probe.Geometry.Coordinates, &coords) == nil && len(coords) >= 2 {
+			sightings = append(sightings, models.LocationRecord{MMSI: mmsi, Longitude: coords[0], Latitude: coords[1]})
+		}
+		if keep != nil && !keep(mmsi) {
+			continue
+		}
+
+		var f Feature
+		if err := json.Unmarshal(raw, &f); err != nil {
+			return nil, nil, 0, &SchemaError{Endpoint: endpoint, Reason: "feature: " + err.Error()}
+		}
+		if f.Type != "Feature" || f.Geometry.Type != "Point" || len(f.Geometry.Coordinates) < 2 {
+			return nil, nil, 0, &SchemaError{Endpoint: endpoint, Reason: fmt.Sprintf("feature %d is not a GeoJSON Point", f.MMSI)}
+		}
+		out = append(out, f)
+	}
+
+	if err := expectDelim(dec, ']', endpoint, "end of features"); err != nil {
+		return nil, nil, 0, err
+	}
+	return out, sightings, total, nil
+}
+
+func optional(v *float64, normalize func(float64) *float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	return normalize(*v)
+}
@@ -0,0 +1,50 @@
+package digitraffic
+
+import (
+	"github.com/joluc/icebreaker-exporter/pkg/ais"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// MQTT topics published by Digitraffic for each vessel.
+const (
+	TopicPrefix    = "vessels-v2/"
+	LocationSuffix = "/location"
+	MetadataSuffix = "/metadata"
+)
+
+// StreamLocation is the payload published on vessels-v2/<mmsi>/location.
+type StreamLocation struct {
+	Time    int64    `json:"time"` // epoch seconds
+	SOG     *float64 `json:"sog"`
+	COG     *float64 `json:"cog"`
+	NavStat *int     `json:"navStat"`
+	ROT     *float64 `json:"rot"`
+	PosAcc  bool     `json:"posAcc"`
+	RAIM    bool     `json:"raim"`
+	Heading *float64 `json:"heading"`
+	Lon     float64  `json:"lon"`
+	Lat     float64  `json:"lat"`
+}
+
+// StreamMetadata is the payload published on vessels-v2/<mmsi>/metadata. It
+// carries the same fields as a /vessels entry.
+type StreamMetadata = Vessel
+
+// Location converts the message to the exporter's model; the MMSI comes from
+// the topic.
+func (m StreamLocation) Location(mmsi string) models.LocationRecord {
+	rec := models.LocationRecord{
+		MMSI:             mmsi,
+		Latitude:         m.Lat,
+		Longitude:        m.Lon,
+		Timestamp:        m.Time,
+		SpeedOverGround:  optional(m.SOG, ais.Speed),
+		CourseOverGround: optional(m.COG, ais.Course),
+		Heading:          optional(m.Heading, ais.Heading),
+		RateOfTurn:       optional(m.ROT, ais.RateOfTurn),
+	}
+	if m.NavStat != nil {
+		rec.NavigationStatus = ais.NavigationStatus(*m.NavStat)
+	}
+	return rec
+}
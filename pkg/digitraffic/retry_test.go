@@ -0,0 +1,241 @@
+package digitraffic
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestFetchRetriesTransientFailures(t *testing.T) {
+	var calls int
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		default:
+			_, _ = io.WriteString(w, vesselsPayload)
+		}
+	})
+	c.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+	vessels, err := c.FetchVessels(context.Background(), nil)
+	if err != nil {
+		t.Fatalf("FetchVessels() error = %v", err)
+	}
+	if len(vessels) != 3 || calls != 3 || c.Retries() != 2 {
+		t.Errorf("expected success after 2 retries, got %d vessels, %d calls, %d retries", len(vessels), calls, c.Retries())
+	}
+}
+
+func TestFetchGivesUpAfterMaxAttempts(t *testing.T) {
+	var calls int
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	c.Retry = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}
+
+	_, err := c.FetchVessels(context.Background(), nil)
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 StatusError, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 attempts, got %d", calls)
+	}
+}
+
+func TestFetchDoesNotRetryClientErrors(t *testing.T) {
+	var calls int
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		http.Error(w, "bad request", http.StatusBadRequest)
+	})
+	c.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+
+	if _, err := c.FetchVessels(context.Background(), nil); err == nil {
+		t.Fatal("expected error for 400 response")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 attempt, got %d", calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		status int
+		header string
+		want   time.Duration
+		ok     bool
+	}{
+		{http.StatusTooManyRequests, "7", 7 * time.Second, true},
+		{http.StatusServiceUnavailable, "Mon, 01 Jan 2024 12:00:30 GMT", 30 * time.Second, true},
+		{http.StatusServiceUnavailable, "", 0, false},
+		{http.StatusBadGateway, "7", 0, false},
+		{http.StatusTooManyRequests, "soon", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.status, Header: http.Header{}}
+		if tt.header != "" {
+			resp.Header.Set("Retry-After", tt.header)
+		}
+		got, ok := retryAfter(resp, now)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("retryAfter(%d, %q) = %v, %v; want %v, %v", tt.status, tt.header, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for n, want := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		for i := 0; i < 20; i++ {
+			if got := p.backoff(n); got < want/2 || got > want {
+				t.Errorf("backoff(%d) = %v, want within [%v, %v]", n, got, want/2, want)
+			}
+		}
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return now }
+
+	b.Failure()
+	if b.State() != BreakerClosed || !b.Allow() {
+		t.Fatalf("expected breaker to stay closed below threshold, got %s", b.State())
+	}
+	b.Failure()
+	if b.State() != BreakerOpen || b.Allow() {
+		t.Fatalf("expected breaker to open at threshold, got %s", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	if !b.Allow() || b.State() != BreakerHalfOpen {
+		t.Fatalf("expected a half-open probe after cooldown, got %s", b.State())
+	}
+	if b.Allow() {
+		t.Error("expected only one probe while half-open")
+	}
+	b.Failure()
+	if b.State() != BreakerOpen {
+		t.Fatalf("expected failed probe to reopen breaker, got %s", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	b.Allow()
+	b.Success()
+	if b.State() != BreakerClosed || !b.Allow() {
+		t.Errorf("expected successful probe to close breaker, got %s", b.State())
+	}
+}
+
+func TestFetchCircuitOpen(t *testing.T) {
+	var calls int
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	})
+	c.Breaker = NewBreaker(1, time.Hour)
+
+	if _, err := c.FetchVessels(context.Background(), nil); err == nil {
+		t.Fatal("expected error for 502 response")
+	}
+	if _, err := c.FetchVessels(context.Background(), nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected the open breaker to short-circuit, got %d calls", calls)
+	}
+}
+
+func TestFetchHalfOpenInvalidRequest(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	var calls int
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		_, _ = io.WriteString(w, `[]`)
+	})
+	c.Breaker = NewBreaker(1, time.Minute)
+	c.Breaker.now = func() time.Time { return now }
+	c.Breaker.Failure()
+	now = now.Add(time.Minute)
+
+	// A request that cannot be built must not use up the half-open probe.
+	vesselsURL := c.VesselsURL
+	c.VesselsURL = "://invalid"
+	if _, err := c.FetchVessels(context.Background(), nil); err == nil || errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected a request error, got %v", err)
+	}
+	c.VesselsURL = vesselsURL
+	if _, err := c.FetchVessels(context.Background(), nil); err != nil {
+		t.Fatalf("expected the probe to be sent, got %v", err)
+	}
+	if calls != 1 || c.Breaker.State() != BreakerClosed {
+		t.Errorf("expected the probe to close the breaker, got %d calls and %s", calls, c.Breaker.State())
+	}
+}
+
+func TestFetchCancelledIsNotABreakerFailure(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls int
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			cancel()
+			<-r.Context().Done()
+			return
+		}
+		_, _ = io.WriteString(w, `[]`)
+	})
+	c.Retry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	c.Breaker = NewBreaker(1, time.Minute)
+	c.Breaker.now = func() time.Time { return now }
+	c.Breaker.Failure()
+	now = now.Add(time.Minute)
+
+	if _, err := c.FetchVessels(ctx, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if c.Breaker.State() != BreakerHalfOpen || calls != 1 {
+		t.Fatalf("expected a cancelled probe to leave the breaker half-open without retries, got %s after %d calls", c.Breaker.State(), calls)
+	}
+	if _, err := c.FetchVessels(context.Background(), nil); err != nil {
+		t.Fatalf("expected a new probe after the cancelled one, got %v", err)
+	}
+	if c.Breaker.State() != BreakerClosed {
+		t.Errorf("expected the probe to close the breaker, got %s", c.Breaker.State())
+	}
+}
+
+func TestFetchCapsRetryAfter(t *testing.T) {
+	var calls int
+	c := newTestClient(t, func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "3600")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		_, _ = io.WriteString(w, vesselsPayload)
+	})
+	c.Retry = RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+	start := time.Now()
+	if _, err := c.FetchVessels(context.Background(), nil); err != nil {
+		t.Fatalf("FetchVessels() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Retry-After to be capped at MaxDelay, waited %v", elapsed)
+	}
+}
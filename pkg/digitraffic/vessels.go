@@ -0,0 +1,103 @@
+package digitraffic
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/ais"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// Vessel is one entry of the /vessels endpoint (AIS static and voyage data).
+type Vessel struct {
+	MMSI            int    `json:"mmsi"`
+	Name            string `json:"name"`
+	ShipType        int    `json:"shipType"`
+	ReferencePointA int    `json:"referencePointA"`
+	ReferencePointB int    `json:"referencePointB"`
+	ReferencePointC int    `json:"referencePointC"`
+	ReferencePointD int    `json:"referencePointD"`
+	PosType         int    `json:"posType"`
+	Draught         int    `json:"draught"` // decimetres
+	IMO             int    `json:"imo"`
+	CallSign        string `json:"callSign"`
+	ETA             int    `json:"eta"` // AIS packed month/day/hour/minute
+	Timestamp       int64  `json:"timestamp"`
+	Destination     string `json:"destination"`
+}
+
+// Metadata converts the vessel to the exporter's model, including its static
+// and voyage data. Country is inferred from the MMSI.
+func (v Vessel) Metadata() models.VesselMetadata {
+	meta := models.VesselMetadata{
+		MMSI:    strconv.Itoa(v.MMSI),
+		Name:    strings.TrimSpace(v.Name),
+		Country: ais.CountryCode(strconv.Itoa(v.MMSI)),
+		StaticData: models.StaticData{
+			IMO:         v.IMO,
+			CallSign:    strings.TrimSpace(v.CallSign),
+			ShipType:    v.ShipType,
+			Destination: strings.TrimSpace(v.Destination),
+			Draught:     float64(v.Draught) / 10,
+		},
+	}
+	meta.Length, meta.Beam = ais.Dimensions(v.ReferencePointA, v.ReferencePointB, v.ReferencePointC, v.ReferencePointD)
+
+	ref := time.Now()
+	if v.Timestamp > 0 {
+		meta.Updated = time.UnixMilli(v.Timestamp)
+		ref = meta.Updated
+	}
+	meta.ETA = ais.ETA(v.ETA, ref)
+	return meta
+}
+
+// FetchVessels streams the /vessels array and returns the entries accepted
+// by keep. A nil keep accepts everything.
+func (c *Client) FetchVessels(ctx context.Context, keep func(Vessel) bool) ([]Vessel, error) {
+	return c.fetchVessels(ctx, keep, "")
+}
+
+// FetchVesselsIfModified is FetchVessels as a conditional request. It
+// returns ErrNotModified when the list did not change since the previous
+// call.
+func (c *Client) FetchVesselsIfModified(ctx context.Context, keep func(Vessel) bool) ([]Vessel, error) {
+	return c.fetchVessels(ctx, keep, c.VesselsURL)
+}
+
+func (c *Client) fetchVessels(ctx context.Context, keep func(Vessel) bool, validatorKey string) ([]Vessel, error) {
+	body, v, err := c.get(ctx, c.VesselsURL, validatorKey)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	if err := expectDelim(dec, '[', c.VesselsURL, "start of vessels payload"); err != nil {
+		return nil, err
+	}
+
+	var out []Vessel
+	for dec.More() {
+		var v Vessel
+		if err := dec.Decode(&v); err != nil {
+			return nil, &SchemaError{Endpoint: c.VesselsURL, Reason: err.Error()}
+		}
+		if v.MMSI <= 0 {
+			return nil, &SchemaError{Endpoint: c.VesselsURL, Reason: "vessel without mmsi"}
+		}
+		c.records.Add(1)
+		if keep == nil || keep(v) {
+			out = append(out, v)
+		}
+	}
+
+	if err := expectDelim(dec, ']', c.VesselsURL, "end of vessels payload"); err != nil {
+		return nil, err
+	}
+	c.saveValidator(validatorKey, v)
+	return out, nil
+}
@@ -0,0 +1,76 @@
+// Package export renders recorded vessel tracks as GPX 1.1 (for chart
+// plotters such as OpenCPN) and KML 2.2 (for Google Earth) documents.
+package export
+
+import (
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/ais"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// Track is the recorded track of one vessel, oldest point first.
+type Track struct {
+	MMSI    string
+	Name    string
+	Country string
+	Points  []models.TrackPoint
+}
+
+// title names the track after the vessel, falling back to its MMSI.
+func (t Track) title() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	return t.MMSI
+}
+
+func timestamp(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
+
+func round(v float64, decimals int) float64 {
+	p := math.Pow(10, float64(decimals))
+	return math.Round(v*p) / p
+}
+
+// Tracks builds the tracks of the recorded points reported at or after
+// since, named after the matching positions. Points must be oldest first;
+// repeated reports are skipped. Tracks are ordered by vessel name and MMSI.
+func Tracks(positions []models.IcebreakerPosition, points map[string][]models.TrackPoint, since time.Time) []Track {
+	byMMSI := make(map[string]models.IcebreakerPosition, len(positions))
+	for _, pos := range positions {
+		byMMSI[pos.MMSI] = pos
+	}
+
+	var out []Track
+	for mmsi, recorded := range points {
+		pos := byMMSI[mmsi]
+		t := Track{MMSI: mmsi, Name: pos.Name, Country: pos.Country}
+		if t.Country == "" {
+			t.Country = ais.CountryCode(mmsi)
+		}
+		for _, p := range recorded {
+			if p.Timestamp < since.Unix() {
+				continue
+			}
+			if n := len(t.Points); n > 0 && p.Timestamp <= t.Points[n-1].Timestamp {
+				continue
+			}
+			t.Points = append(t.Points, p)
+		}
+		if len(t.Points) > 0 {
+			out = append(out, t)
+		}
+	}
+	slices.SortFunc(out, func(a, b Track) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.MMSI, b.MMSI)
+	})
+	return out
+}
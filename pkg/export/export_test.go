@@ -0,0 +1,104 @@
+package export
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func testTracks() []Track {
+	return []Track{{
+		MMSI:    "230252000",
+		Name:    "OTSO",
+		Country: "FI",
+		Points: []models.TrackPoint{
+			{Latitude: 65.0, Longitude: 25.2, Timestamp: 1700000000, SpeedOverGround: ptr(10.0), CourseOverGround: ptr(45.0), NavigationStatus: ptr(0)},
+			{Latitude: 65.1, Longitude: 25.3, Timestamp: 1700000600, NavigationStatus: ptr(5)},
+		},
+	}}
+}
+
+func TestWriteGPX(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteGPX(&b, testTracks()); err != nil {
+		t.Fatal(err)
+	}
+
+	var doc struct {
+		Tracks []struct {
+			Name   string `xml:"name"`
+			Points []struct {
+				Lat    float64 `xml:"lat,attr"`
+				Time   string  `xml:"time"`
+				Speed  float64 `xml:"extensions>TrackPointExtension>speed"`
+				Course float64 `xml:"extensions>TrackPointExtension>course"`
+			} `xml:"trkseg>trkpt"`
+		} `xml:"trk"`
+	}
+	if err := xml.Unmarshal(b.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid GPX: %v\n%s", err, b.String())
+	}
+	if len(doc.Tracks) != 1 || doc.Tracks[0].Name != "OTSO" || len(doc.Tracks[0].Points) != 2 {
+		t.Fatalf("unexpected GPX:\n%s", b.String())
+	}
+	p := doc.Tracks[0].Points[0]
+	if p.Lat != 65.0 || p.Time != "2023-11-14T22:13:20Z" || p.Speed != 5.14 || p.Course != 45 {
+		t.Errorf("unexpected first point %+v", p)
+	}
+	if !strings.Contains(b.String(), `xmlns:gpxtpx="`+tpxNamespace+`"`) {
+		t.Error("expected the TrackPointExtension namespace to be declared")
+	}
+}
+
+func TestWriteKML(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteKML(&b, testTracks()); err != nil {
+		t.Fatal(err)
+	}
+	if err := xml.Unmarshal(b.Bytes(), new(struct{})); err != nil {
+		t.Fatalf("invalid KML: %v", err)
+	}
+	for _, want := range []string{
+		`<Style id="country-FI">`,
+		`<Style id="status-0">`,
+		`<Style id="status-5">`,
+		`<styleUrl>#country-FI</styleUrl>`,
+		`<coordinates>25.200000,65.000000 25.300000,65.100000</coordinates>`,
+		`<when>2023-11-14T22:23:20Z</when>`,
+		`<Data name="speed_knots">`,
+		`<value>Moored</value>`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("expected %q in KML:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestTracks(t *testing.T) {
+	positions := []models.IcebreakerPosition{{Name: "URHO", MMSI: "230111000", Country: "FI"}}
+	points := map[string][]models.TrackPoint{
+		"230111000": {{Timestamp: 100}, {Timestamp: 200}, {Timestamp: 200}, {Timestamp: 150}, {Timestamp: 300}},
+		"265547250": {{Timestamp: 250}},
+		"230252000": {{Timestamp: 50}},
+	}
+
+	tracks := Tracks(positions, points, time.Unix(150, 0))
+	if len(tracks) != 2 {
+		t.Fatalf("expected 2 tracks, got %+v", tracks)
+	}
+	// Unnamed vessels sort first and get their country from the MMSI.
+	if tracks[0].MMSI != "265547250" || tracks[0].Country != "SE" || tracks[0].title() != "265547250" {
+		t.Errorf("unexpected first track %+v", tracks[0])
+	}
+	if got := tracks[1]; got.Name != "URHO" || len(got.Points) != 2 || got.Points[0].Timestamp != 200 || got.Points[1].Timestamp != 300 {
+		t.Errorf("unexpected URHO track %+v", got)
+	}
+}
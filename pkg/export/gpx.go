@@ -0,0 +1,93 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+const (
+	gpxNamespace = "http://www.topografix.com/GPX/1/1"
+	// Garmin's TrackPointExtension carries speed and course; OpenCPN and
+	// most other GPX readers understand it.
+	tpxNamespace = "http://www.garmin.com/xmlschemas/TrackPointExtension/v2"
+
+	knotsToMetersPerSecond = 1852.0 / 3600
+)
+
+type gpxDocument struct {
+	XMLName xml.Name   `xml:"gpx"`
+	Version string     `xml:"version,attr"`
+	Creator string     `xml:"creator,attr"`
+	XMLNS   string     `xml:"xmlns,attr"`
+	TPX     string     `xml:"xmlns:gpxtpx,attr"`
+	Tracks  []gpxTrack `xml:"trk"`
+}
+
+type gpxTrack struct {
+	Name    string     `xml:"name"`
+	Desc    string     `xml:"desc,omitempty"`
+	Segment gpxSegment `xml:"trkseg"`
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpxPoint struct {
+	Lat        float64        `xml:"lat,attr"`
+	Lon        float64        `xml:"lon,attr"`
+	Time       string         `xml:"time"`
+	Extensions *gpxExtensions `xml:"extensions,omitempty"`
+}
+
+type gpxExtensions struct {
+	TrackPoint gpxTrackPointExtension `xml:"gpxtpx:TrackPointExtension"`
+}
+
+type gpxTrackPointExtension struct {
+	Speed  *float64 `xml:"gpxtpx:speed,omitempty"`  // metres per second
+	Course *float64 `xml:"gpxtpx:course,omitempty"` // degrees
+}
+
+// WriteGPX writes the tracks as a GPX 1.1 document with one trk per vessel.
+// Speed over ground and course over ground are written as Garmin
+// TrackPointExtension elements.
+func WriteGPX(w io.Writer, tracks []Track) error {
+	doc := gpxDocument{
+		Version: "1.1",
+		Creator: "icebreaker-exporter",
+		XMLNS:   gpxNamespace,
+		TPX:     tpxNamespace,
+	}
+	for _, t := range tracks {
+		trk := gpxTrack{Name: t.title(), Desc: "MMSI " + t.MMSI}
+		for _, p := range t.Points {
+			pt := gpxPoint{Lat: p.Latitude, Lon: p.Longitude, Time: timestamp(p.Timestamp)}
+			if p.SpeedOverGround != nil || p.CourseOverGround != nil {
+				var ext gpxTrackPointExtension
+				if p.SpeedOverGround != nil {
+					speed := round(*p.SpeedOverGround*knotsToMetersPerSecond, 2)
+					ext.Speed = &speed
+				}
+				ext.Course = p.CourseOverGround
+				pt.Extensions = &gpxExtensions{TrackPoint: ext}
+			}
+			trk.Segment.Points = append(trk.Segment.Points, pt)
+		}
+		doc.Tracks = append(doc.Tracks, trk)
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
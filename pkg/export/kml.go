@@ -0,0 +1,210 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/joluc/icebreaker-exporter/pkg/ais"
+)
+
+const kmlNamespace = "http://www.opengis.net/kml/2.2"
+
+// KML colours are aabbggrr.
+var countryColors = map[string]string{
+	"FI": "ff803500", // blue
+	"SE": "ff02ccfe", // yellow
+	"NO": "ff2f0cba", // red
+	"EE": "ffce7200",
+	"DK": "ff2e10c8",
+	"DE": "ff000000",
+	"RU": "ffa73900",
+}
+
+// fallbackColors are assigned to other countries by hash.
+var fallbackColors = []string{"ff00a5ff", "ff800080", "ff008080", "ff4b0082", "ff2f6b55", "ff8b008b"}
+
+func countryColor(country string) string {
+	if c, ok := countryColors[country]; ok {
+		return c
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(country))
+	return fallbackColors[h.Sum32()%uint32(len(fallbackColors))]
+}
+
+func statusColor(status int) string {
+	switch status {
+	case 0, 8: // under way
+		return "ff00c000"
+	case 1, 5: // at anchor, moored
+		return "ff909090"
+	case 2, 6, 14: // not under command, aground, emergency
+		return "ff0000ff"
+	case 3, 4, 11, 12: // restricted, constrained, towing, pushing
+		return "ff00a5ff"
+	default:
+		return "ffffffff"
+	}
+}
+
+type kmlDocument struct {
+	XMLName xml.Name    `xml:"kml"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	Name    string      `xml:"Document>name"`
+	Styles  []kmlStyle  `xml:"Document>Style"`
+	Folders []kmlFolder `xml:"Document>Folder"`
+}
+
+type kmlStyle struct {
+	ID    string         `xml:"id,attr"`
+	Line  *kmlLineStyle  `xml:"LineStyle,omitempty"`
+	Icon  *kmlIconStyle  `xml:"IconStyle,omitempty"`
+	Label *kmlLabelStyle `xml:"LabelStyle,omitempty"`
+}
+
+type kmlLineStyle struct {
+	Color string `xml:"color"`
+	Width int    `xml:"width"`
+}
+
+type kmlIconStyle struct {
+	Color string  `xml:"color"`
+	Scale float64 `xml:"scale"`
+	Href  string  `xml:"Icon>href"`
+}
+
+type kmlLabelStyle struct {
+	Scale float64 `xml:"scale"`
+}
+
+type kmlFolder struct {
+	Name       string         `xml:"name"`
+	Placemarks []kmlPlacemark `xml:"Placemark"`
+}
+
+type kmlPlacemark struct {
+	Name        string           `xml:"name,omitempty"`
+	Description string           `xml:"description,omitempty"`
+	TimeStamp   *kmlTimeStamp    `xml:"TimeStamp,omitempty"`
+	StyleURL    string           `xml:"styleUrl"`
+	Extended    *kmlExtendedData `xml:"ExtendedData,omitempty"`
+	Line        *kmlGeometry     `xml:"LineString,omitempty"`
+	Point       *kmlGeometry     `xml:"Point,omitempty"`
+}
+
+type kmlTimeStamp struct {
+	When string `xml:"when"`
+}
+
+type kmlExtendedData struct {
+	Data []kmlData `xml:"Data"`
+}
+
+type kmlData struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value"`
+}
+
+type kmlGeometry struct {
+	Tessellate int    `xml:"tessellate,omitempty"`
+	Coords     string `xml:"coordinates"`
+}
+
+// WriteKML writes the tracks as a KML 2.2 document with one folder per
+// vessel. The track line is styled per country, and every recorded position
+// is a time-stamped point styled per navigation status, carrying speed and
+// course as extended data.
+func WriteKML(w io.Writer, tracks []Track) error {
+	doc := kmlDocument{XMLNS: kmlNamespace, Name: "Icebreaker tracks"}
+	countries := map[string]struct{}{}
+	statuses := map[string]int{}
+
+	for _, t := range tracks {
+		folder := kmlFolder{Name: t.title()}
+		countries[t.Country] = struct{}{}
+
+		coords := make([]string, 0, len(t.Points))
+		for _, p := range t.Points {
+			coords = append(coords, coordinate(p.Longitude, p.Latitude))
+		}
+		if len(coords) >= 2 {
+			folder.Placemarks = append(folder.Placemarks, kmlPlacemark{
+				Name:     t.title() + " track",
+				StyleURL: "#country-" + countryStyleID(t.Country),
+				Line:     &kmlGeometry{Tessellate: 1, Coords: strings.Join(coords, " ")},
+			})
+		}
+
+		for i, p := range t.Points {
+			styleID, status := "unknown", "Unknown"
+			data := []kmlData{{Name: "mmsi", Value: t.MMSI}}
+			if p.NavigationStatus != nil {
+				styleID = strconv.Itoa(*p.NavigationStatus)
+				status = ais.NavigationStatusText(*p.NavigationStatus)
+				statuses[styleID] = *p.NavigationStatus
+				data = append(data, kmlData{Name: "navigation_status", Value: status})
+			} else {
+				statuses[styleID] = -1
+			}
+			desc := fmt.Sprintf("%s, %s", t.title(), status)
+			if p.SpeedOverGround != nil {
+				data = append(data, kmlData{Name: "speed_knots", Value: strconv.FormatFloat(*p.SpeedOverGround, 'f', 1, 64)})
+				desc += fmt.Sprintf(", %.1f kn", *p.SpeedOverGround)
+			}
+			if p.CourseOverGround != nil {
+				data = append(data, kmlData{Name: "course_degrees", Value: strconv.FormatFloat(*p.CourseOverGround, 'f', 1, 64)})
+				desc += fmt.Sprintf(", %.0f°", *p.CourseOverGround)
+			}
+			pm := kmlPlacemark{
+				Description: desc,
+				TimeStamp:   &kmlTimeStamp{When: timestamp(p.Timestamp)},
+				StyleURL:    "#status-" + styleID,
+				Extended:    &kmlExtendedData{Data: data},
+				Point:       &kmlGeometry{Coords: coords[i]},
+			}
+			if i == len(t.Points)-1 {
+				pm.Name = t.title()
+			}
+			folder.Placemarks = append(folder.Placemarks, pm)
+		}
+		doc.Folders = append(doc.Folders, folder)
+	}
+
+	for _, country := range slices.Sorted(maps.Keys(countries)) {
+		doc.Styles = append(doc.Styles, kmlStyle{
+			ID:   "country-" + countryStyleID(country),
+			Line: &kmlLineStyle{Color: countryColor(country), Width: 3},
+		})
+	}
+	for _, id := range slices.Sorted(maps.Keys(statuses)) {
+		doc.Styles = append(doc.Styles, kmlStyle{
+			ID: "status-" + id,
+			Icon: &kmlIconStyle{
+				Color: statusColor(statuses[id]),
+				Scale: 0.6,
+				Href:  "http://maps.google.com/mapfiles/kml/shapes/shaded_dot.png",
+			},
+			// Only the latest position, which carries the vessel name, is
+			// labelled.
+			Label: &kmlLabelStyle{Scale: 0.8},
+		})
+	}
+	return writeXML(w, doc)
+}
+
+func countryStyleID(country string) string {
+	if country == "" {
+		return "unknown"
+	}
+	return country
+}
+
+func coordinate(lon, lat float64) string {
+	return strconv.FormatFloat(lon, 'f', 6, 64) + "," + strconv.FormatFloat(lat, 'f', 6, 64)
+}
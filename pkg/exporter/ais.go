@@ -0,0 +1,124 @@
+package exporter
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+	"github.com/joluc/icebreaker-exporter/pkg/nmea"
+)
+
+// localMaxAge drops the records of a vessel the local AIS sources have not
+// heard from for that long.
+const localMaxAge = 30 * time.Minute
+
+// aisCache keeps the latest records received from local AIS sources so they
+// can be merged with the Digitraffic data on every refresh.
+type aisCache struct {
+	mu        sync.Mutex
+	vessels   map[string]models.VesselMetadata
+	locations map[string]models.LocationRecord
+	// heard is the time of the latest report of each vessel, or when it was
+	// received if the report carries no time.
+	heard map[string]time.Time
+	now   func() time.Time
+}
+
+func newAISCache() *aisCache {
+	return &aisCache{
+		vessels:   map[string]models.VesselMetadata{},
+		locations: map[string]models.LocationRecord{},
+		heard:     map[string]time.Time{},
+		now:       time.Now,
+	}
+}
+
+// addVessel stores v, keeping previously reported fields that v lacks, such
+// as the name when v came from a type 24 part B report.
+func (c *aisCache) addVessel(v models.VesselMetadata) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if current, ok := c.vessels[v.MMSI]; ok {
+		v.StaticData = current.StaticData.Merge(v.StaticData)
+		if v.Name == "" {
+			v.Name = current.Name
+		}
+	}
+	c.vessels[v.MMSI] = v
+	heard := v.Updated
+	if heard.IsZero() {
+		heard = c.now()
+	}
+	if heard.After(c.heard[v.MMSI]) {
+		c.heard[v.MMSI] = heard
+	}
+}
+
+func (c *aisCache) addLocation(loc models.LocationRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if current, ok := c.locations[loc.MMSI]; ok && current.Timestamp > loc.Timestamp {
+		return
+	}
+	c.locations[loc.MMSI] = loc
+	if heard := time.Unix(loc.Timestamp, 0); heard.After(c.heard[loc.MMSI]) {
+		c.heard[loc.MMSI] = heard
+	}
+}
+
+// records returns the cached records after dropping those of vessels not
+// heard from within localMaxAge.
+func (c *aisCache) records() ([]models.VesselMetadata, []models.LocationRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	oldest := c.now().Add(-localMaxAge)
+	for mmsi, heard := range c.heard {
+		if heard.Before(oldest) {
+			delete(c.heard, mmsi)
+			delete(c.vessels, mmsi)
+			delete(c.locations, mmsi)
+		}
+	}
+
+	vessels := make([]models.VesselMetadata, 0, len(c.vessels))
+	for _, v := range c.vessels {
+		vessels = append(vessels, v)
+	}
+	locations := make([]models.LocationRecord, 0, len(c.locations))
+	for _, loc := range c.locations {
+		locations = append(locations, loc)
+	}
+	return vessels, locations
+}
+
+// HandleAISReport receives reports from local NMEA sources. Positions of
+// vessels that are already tracked are applied immediately; everything is
+// also cached for name matching on the next refresh. Positions without a
+// time, as recorded ones may be, are discarded since they may be long out
+// of date. It satisfies nmea.Handler.
+func (e *Exporter) HandleAISReport(r *nmea.Report, err error) {
+	if err != nil {
+		atomic.AddUint64(&e.nmeaErrors, 1)
+		slog.Debug("discarding nmea sentence", "error", err)
+		return
+	}
+	atomic.AddUint64(&e.nmeaReports, 1)
+
+	switch {
+	case r.Location != nil && r.Location.Timestamp <= 0:
+		slog.Debug("discarding nmea position without time", "mmsi", r.Location.MMSI)
+	case r.Location != nil:
+		e.local.addLocation(*r.Location)
+		e.applyLiveLocation(*r.Location)
+	case r.Vessel != nil:
+		e.local.addVessel(*r.Vessel)
+	}
+}
+
+func (e *Exporter) nmeaEnabled() bool {
+	cfg := e.currentConfig()
+	return cfg.NMEATCPAddress != "" || cfg.NMEAUDPAddress != "" || cfg.NMEAFile != ""
+}
@@ -0,0 +1,132 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+	"github.com/joluc/icebreaker-exporter/pkg/nmea"
+)
+
+func TestHandleAISReportMergesWithRefresh(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vessels", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, testVesselsJSON)
+	})
+	mux.HandleFunc("/locations", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, testLocationsJSON)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	exp := New(config.Config{
+		VesselsURL:     srv.URL + "/vessels",
+		LocationsURL:   srv.URL + "/locations",
+		RequestTimeout: time.Second,
+		Targets:        config.NewTargets(config.ParseVesselNames("OTSO,URHO")),
+		NMEAUDPAddress: "127.0.0.1:0",
+	})
+
+	// URHO is only known to the local receiver.
+	exp.HandleAISReport(&nmea.Report{MessageType: 5, Vessel: &models.VesselMetadata{MMSI: "230990000", Name: "URHO", Country: "FI", StaticData: models.StaticData{CallSign: "OHLW"}}}, nil)
+	exp.HandleAISReport(&nmea.Report{MessageType: 1, Location: &models.LocationRecord{MMSI: "230990000", Latitude: 65.0, Longitude: 24.5, Timestamp: 1700000000}}, nil)
+	exp.HandleAISReport(nil, errors.New("bad checksum"))
+
+	exp.Refresh(context.Background())
+	s := exp.GetSnapshot()
+	if s.LastRefreshError != "" {
+		t.Fatalf("refresh failed: %s", s.LastRefreshError)
+	}
+	if len(s.Positions) != 2 || s.Positions[1].Name != "URHO" || s.Positions[1].Country != "FI" {
+		t.Fatalf("expected OTSO and URHO, got %+v", s.Positions)
+	}
+
+	// Once tracked, new reports are applied without waiting for a refresh.
+	exp.HandleAISReport(&nmea.Report{MessageType: 1, Location: &models.LocationRecord{MMSI: "230990000", Latitude: 65.1, Longitude: 24.6, Timestamp: 1700000060}}, nil)
+	if pos := exp.GetSnapshot().Positions[1]; pos.Latitude != 65.1 || pos.CallSign != "OHLW" {
+		t.Errorf("live report not applied or static data lost, got %+v", pos)
+	}
+
+	rr := httptest.NewRecorder()
+	exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+	if !strings.Contains(body, "icebreaker_nmea_reports_total 3") || !strings.Contains(body, "icebreaker_nmea_decode_errors_total 1") {
+		t.Errorf("missing nmea counters:\n%s", body)
+	}
+}
+
+func TestHandleAISReportReplayedFile(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vessels", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, testVesselsJSON)
+	})
+	mux.HandleFunc("/locations", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, testLocationsJSON)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	exp := New(config.Config{
+		VesselsURL:     srv.URL + "/vessels",
+		LocationsURL:   srv.URL + "/locations",
+		RequestTimeout: time.Second,
+		Targets:        config.NewTargets([]config.Vessel{{Name: "OTSO"}, {Name: "SEATTLE", MMSI: "477553000"}}),
+	})
+
+	// A position of SEATTLE recorded in 2020, and one without a time.
+	path := filepath.Join(t.TempDir(), "ais.nmea")
+	sentence := "!AIVDM,1,1,,B,177KQJ5000G?tO`K>RA1wUbN0TKH,0*5C"
+	input := `\c:1600000000*5E\` + sentence + "\n" + sentence + "\n"
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := nmea.ReadFile(path, exp.HandleAISReport); err != nil {
+		t.Fatal(err)
+	}
+
+	exp.Refresh(context.Background())
+	s := exp.GetSnapshot()
+	if len(s.Positions) != 1 || s.Positions[0].Name != "OTSO" {
+		t.Errorf("expected only OTSO, got %+v", s.Positions)
+	}
+}
+
+func TestAISCacheMergesStaticData(t *testing.T) {
+	c := newAISCache()
+	c.addVessel(models.VesselMetadata{MMSI: "271041815", Name: "PROGUY"})
+	c.addVessel(models.VesselMetadata{MMSI: "271041815", StaticData: models.StaticData{CallSign: "TC6163", ShipType: 60, Length: 15, Beam: 5}})
+
+	vessels, _ := c.records()
+	if len(vessels) != 1 {
+		t.Fatalf("expected 1 vessel, got %d", len(vessels))
+	}
+	v := vessels[0]
+	if v.Name != "PROGUY" || v.CallSign != "TC6163" || v.ShipType != 60 || v.Length != 15 {
+		t.Errorf("expected type 24 parts to be merged, got %+v", v)
+	}
+}
+
+func TestAISCacheDropsVesselsNoLongerHeard(t *testing.T) {
+	c := newAISCache()
+	now := time.Unix(1000, 0)
+	c.now = func() time.Time { return now }
+	c.addVessel(models.VesselMetadata{MMSI: "271041815", Name: "PROGUY"})
+	c.addLocation(models.LocationRecord{MMSI: "271041815", Latitude: 60, Longitude: 25, Timestamp: 1000})
+	now = now.Add(localMaxAge / 2)
+	c.addLocation(models.LocationRecord{MMSI: "230252000", Latitude: 65, Longitude: 24, Timestamp: 1900})
+
+	now = now.Add(localMaxAge/2 + time.Second)
+	vessels, locations := c.records()
+	if len(vessels) != 0 || len(locations) != 1 || locations[0].MMSI != "230252000" {
+		t.Errorf("expected only the vessel heard recently, got %+v %+v", vessels, locations)
+	}
+}
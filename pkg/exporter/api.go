@@ -0,0 +1,316 @@
+package exporter
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/ais"
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+	"github.com/joluc/icebreaker-exporter/pkg/port"
+	"github.com/joluc/icebreaker-exporter/pkg/seaarea"
+)
+
+// GeoJSON (RFC 7946) documents served by the HTTP API. Coordinates are
+// longitude, latitude.
+type geoFeature struct {
+	Type       string       `json:"type"`
+	ID         string       `json:"id,omitempty"`
+	Geometry   *geoGeometry `json:"geometry"`
+	Properties any          `json:"properties"`
+}
+
+type geoGeometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+// apiStatus is the refresh status included in API responses.
+type apiStatus struct {
+	Up                     bool       `json:"up"`
+	LastRefresh            *time.Time `json:"last_refresh"`
+	RefreshDurationSeconds float64    `json:"refresh_duration_seconds"`
+	LastRefreshError       string     `json:"last_refresh_error,omitempty"`
+}
+
+// apiVessel is the JSON representation of a position. Movement fields are
+// null when the vessel did not report them; static and voyage data fields
+// are omitted when they are not available.
+type apiVessel struct {
+	MMSI                       string            `json:"mmsi"`
+	Name                       string            `json:"name"`
+	Country                    string            `json:"country"`
+	CountryName                string            `json:"country_name,omitempty"`
+	Operator                   string            `json:"operator,omitempty"`
+	Fleet                      string            `json:"fleet,omitempty"`
+	Labels                     map[string]string `json:"labels,omitempty"`
+	Latitude                   float64           `json:"latitude"`
+	Longitude                  float64           `json:"longitude"`
+	SeaArea                    string            `json:"sea_area,omitempty"`
+	NearestPort                apiPort           `json:"nearest_port"`
+	Timestamp                  int64             `json:"timestamp"`
+	ReportAgeSeconds           float64           `json:"report_age_seconds"`
+	PositionAnomaly            string            `json:"position_anomaly,omitempty"`
+	SpeedOverGroundKnots       *float64          `json:"speed_over_ground_knots"`
+	CourseOverGroundDegrees    *float64          `json:"course_over_ground_degrees"`
+	HeadingDegrees             *float64          `json:"heading_degrees"`
+	NavigationStatus           *int              `json:"navigation_status"`
+	RateOfTurnDegreesPerMinute *float64          `json:"rate_of_turn_degrees_per_minute"`
+	IMO                        int               `json:"imo,omitempty"`
+	CallSign                   string            `json:"callsign,omitempty"`
+	ShipType                   int               `json:"ship_type,omitempty"`
+	Destination                string            `json:"destination,omitempty"`
+	ETA                        *time.Time        `json:"eta,omitempty"`
+	DraughtMeters              float64           `json:"draught_meters,omitempty"`
+	LengthMeters               float64           `json:"length_meters,omitempty"`
+	BeamMeters                 float64           `json:"beam_meters,omitempty"`
+}
+
+// apiPort is the port closest to a vessel.
+type apiPort struct {
+	LOCODE                string  `json:"locode"`
+	Name                  string  `json:"name"`
+	DistanceNauticalMiles float64 `json:"distance_nautical_miles"`
+}
+
+type apiVessels struct {
+	Status  apiStatus   `json:"status"`
+	Count   int         `json:"count"`
+	Vessels []apiVessel `json:"vessels"`
+}
+
+type apiFeatureCollection struct {
+	Type     string       `json:"type"`
+	Status   apiStatus    `json:"status"`
+	Features []geoFeature `json:"features"`
+}
+
+// VesselsHandler serves the current positions as JSON with the refresh
+// status. See vesselFilter for the query parameters.
+func (e *Exporter) VesselsHandler(w http.ResponseWriter, r *http.Request) {
+	status, vessels, ok := e.apiVessels(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, "application/json", apiVessels{Status: status, Count: len(vessels), Vessels: vessels})
+}
+
+// VesselsGeoJSONHandler serves the current positions as a GeoJSON
+// FeatureCollection of Points with the vessel fields as properties and the
+// refresh status as a foreign member.
+func (e *Exporter) VesselsGeoJSONHandler(w http.ResponseWriter, r *http.Request) {
+	status, vessels, ok := e.apiVessels(w, r)
+	if !ok {
+		return
+	}
+	features := make([]geoFeature, 0, len(vessels))
+	for _, v := range vessels {
+		features = append(features, geoFeature{
+			Type:       "Feature",
+			ID:         v.MMSI,
+			Geometry:   &geoGeometry{Type: "Point", Coordinates: [2]float64{v.Longitude, v.Latitude}},
+			Properties: v,
+		})
+	}
+	writeJSON(w, "application/geo+json", apiFeatureCollection{Type: "FeatureCollection", Status: status, Features: features})
+}
+
+// apiVessels returns the status and the filtered positions, or writes an
+// error response and returns false.
+func (e *Exporter) apiVessels(w http.ResponseWriter, r *http.Request) (apiStatus, []apiVessel, bool) {
+	filter, err := parseVesselFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return apiStatus{}, nil, false
+	}
+
+	s := e.GetSnapshot()
+	targets := e.currentConfig().Targets
+	now := time.Now()
+
+	vessels := make([]apiVessel, 0, len(s.Positions))
+	for _, pos := range s.Positions {
+		if !filter.match(pos) {
+			continue
+		}
+		vessels = append(vessels, newAPIVessel(pos, targets, now))
+	}
+	return newAPIStatus(s), vessels, true
+}
+
+func newAPIStatus(s models.Snapshot) apiStatus {
+	status := apiStatus{
+		Up:                     s.LastRefreshError == "" && !s.LastRefresh.IsZero(),
+		RefreshDurationSeconds: s.RefreshDuration.Seconds(),
+		LastRefreshError:       s.LastRefreshError,
+	}
+	if !s.LastRefresh.IsZero() {
+		status.LastRefresh = &s.LastRefresh
+	}
+	return status
+}
+
+// newAPIVessel converts a position to its API representation.
+func newAPIVessel(pos models.IcebreakerPosition, targets *config.Targets, now time.Time) apiVessel {
+	v := apiVessel{
+		MMSI:                       pos.MMSI,
+		Name:                       pos.Name,
+		Country:                    pos.Country,
+		Latitude:                   pos.Latitude,
+		Longitude:                  pos.Longitude,
+		SeaArea:                    seaarea.Of(pos.Longitude, pos.Latitude),
+		Timestamp:                  pos.Timestamp,
+		PositionAnomaly:            pos.Anomaly,
+		SpeedOverGroundKnots:       pos.SpeedOverGround,
+		CourseOverGroundDegrees:    pos.CourseOverGround,
+		HeadingDegrees:             pos.Heading,
+		NavigationStatus:           pos.NavigationStatus,
+		RateOfTurnDegreesPerMinute: pos.RateOfTurn,
+		IMO:                        pos.IMO,
+		CallSign:                   pos.CallSign,
+		ShipType:                   pos.ShipType,
+		Destination:                pos.Destination,
+		DraughtMeters:              pos.Draught,
+		LengthMeters:               pos.Length,
+		BeamMeters:                 pos.Beam,
+	}
+	nearest, dist := port.Nearest(geo.Point{Lon: pos.Longitude, Lat: pos.Latitude})
+	v.NearestPort = apiPort{LOCODE: nearest.LOCODE, Name: nearest.Name, DistanceNauticalMiles: math.Round(dist/geo.MetersPerNauticalMile*10) / 10}
+	if pos.Timestamp > 0 {
+		v.ReportAgeSeconds = max(0, now.Sub(time.Unix(pos.Timestamp, 0)).Seconds())
+	}
+	if country, ok := ais.CountryOf(pos.MMSI); ok {
+		v.CountryName = country.Name
+	}
+	if def, ok := targets.Match(pos.MMSI, pos.Name, pos.IMO); ok {
+		v.Operator, v.Fleet, v.Labels = def.Operator, def.Fleet, def.Labels
+	}
+	if !pos.ETA.IsZero() {
+		eta := pos.ETA
+		v.ETA = &eta
+	}
+	return v
+}
+
+// vesselFilter selects positions by the query parameters country (comma
+// separated ISO codes), name (case-insensitive substring) and bbox
+// (minLon,minLat,maxLon,maxLat as in GeoJSON).
+type vesselFilter struct {
+	countries map[string]struct{}
+	name      string
+	bbox      []float64
+}
+
+func parseVesselFilter(q url.Values) (vesselFilter, error) {
+	var f vesselFilter
+	if value := q.Get("country"); value != "" {
+		f.countries = map[string]struct{}{}
+		for _, c := range strings.Split(value, ",") {
+			f.countries[strings.ToUpper(strings.TrimSpace(c))] = struct{}{}
+		}
+	}
+	f.name = config.NormalizeName(q.Get("name"))
+	if value := q.Get("bbox"); value != "" {
+		parts := strings.Split(value, ",")
+		if len(parts) != 4 {
+			return f, errors.New("bbox must be minLon,minLat,maxLon,maxLat")
+		}
+		for _, part := range parts {
+			v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+			if err != nil {
+				return f, errors.New("bbox must be minLon,minLat,maxLon,maxLat")
+			}
+			f.bbox = append(f.bbox, v)
+		}
+		if f.bbox[0] > f.bbox[2] || f.bbox[1] > f.bbox[3] {
+			return f, errors.New("bbox minimum must not exceed maximum")
+		}
+	}
+	return f, nil
+}
+
+func (f vesselFilter) match(pos models.IcebreakerPosition) bool {
+	if f.countries != nil {
+		if _, ok := f.countries[pos.Country]; !ok {
+			return false
+		}
+	}
+	if f.name != "" && !strings.Contains(config.NormalizeName(pos.Name), f.name) {
+		return false
+	}
+	if f.bbox != nil && (pos.Longitude < f.bbox[0] || pos.Latitude < f.bbox[1] || pos.Longitude > f.bbox[2] || pos.Latitude > f.bbox[3]) {
+		return false
+	}
+	return true
+}
+
+// TrackHandler serves the recorded track of a vessel as a GeoJSON Feature
+// with a LineString geometry and the report timestamps of its points. The
+// geometry is null while fewer than two points are recorded. The since query
+// parameter limits the track to points reported at or after it.
+func (e *Exporter) TrackHandler(w http.ResponseWriter, r *http.Request) {
+	mmsi := r.PathValue("mmsi")
+	since, err := parseSince(r.URL.Query().Get("since"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	points := e.history.Track(mmsi, since)
+	s := e.GetSnapshot()
+	i := slices.IndexFunc(s.Positions, func(p models.IcebreakerPosition) bool { return p.MMSI == mmsi })
+	if i < 0 && len(points) == 0 {
+		http.Error(w, "vessel not found", http.StatusNotFound)
+		return
+	}
+
+	props := map[string]any{"mmsi": mmsi}
+	if i >= 0 {
+		props["vessel_name"] = s.Positions[i].Name
+		props["country"] = s.Positions[i].Country
+	}
+	coords := make([][2]float64, 0, len(points))
+	timestamps := make([]int64, 0, len(points))
+	for _, p := range points {
+		coords = append(coords, [2]float64{p.Longitude, p.Latitude})
+		timestamps = append(timestamps, p.Timestamp)
+	}
+	props["timestamps"] = timestamps
+
+	feature := geoFeature{Type: "Feature", Properties: props}
+	if len(coords) >= 2 {
+		feature.Geometry = &geoGeometry{Type: "LineString", Coordinates: coords}
+	}
+	writeJSON(w, "application/geo+json", feature)
+}
+
+// parseSince accepts an RFC 3339 time, Unix seconds or a duration before now
+// such as 6h. An empty value means no lower bound.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, errors.New("since must be an RFC 3339 time, Unix seconds or a duration such as 6h")
+}
+
+func writeJSON(w http.ResponseWriter, contentType string, v any) {
+	w.Header().Set("Content-Type", contentType)
+	_ = json.NewEncoder(w).Encode(v)
+}
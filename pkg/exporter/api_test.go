@@ -0,0 +1,169 @@
+package exporter
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+func TestTrackHandler(t *testing.T) {
+	exp := New(config.Config{HistoryRetention: 24 * time.Hour, HistoryMaxPoints: 100})
+	now := time.Now().Unix()
+	for i, ts := range []int64{now - 7200, now - 3600, now - 60} {
+		pos := models.IcebreakerPosition{Name: "OTSO", MMSI: "230252000", Country: "FI", Latitude: 65 + float64(i), Longitude: 25, Timestamp: ts}
+		exp.history.Record([]models.IcebreakerPosition{pos})
+		exp.snapshot.Positions = []models.IcebreakerPosition{pos}
+	}
+
+	get := func(mmsi, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/vessels/"+mmsi+"/track"+query, nil)
+		req.SetPathValue("mmsi", mmsi)
+		rr := httptest.NewRecorder()
+		exp.TrackHandler(rr, req)
+		return rr
+	}
+
+	rr := get("230252000", "?since=90m")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/geo+json" {
+		t.Fatalf("unexpected response %d %q: %s", rr.Code, rr.Header().Get("Content-Type"), rr.Body.String())
+	}
+	var feature struct {
+		Type     string
+		Geometry struct {
+			Type        string
+			Coordinates [][2]float64
+		}
+		Properties struct {
+			MMSI       string  `json:"mmsi"`
+			VesselName string  `json:"vessel_name"`
+			Timestamps []int64 `json:"timestamps"`
+		}
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &feature); err != nil {
+		t.Fatal(err)
+	}
+	if feature.Type != "Feature" || feature.Geometry.Type != "LineString" || len(feature.Geometry.Coordinates) != 2 {
+		t.Fatalf("expected a two point LineString, got %s", rr.Body.String())
+	}
+	if feature.Geometry.Coordinates[0] != [2]float64{25, 66} || feature.Properties.Timestamps[1] != now-60 || feature.Properties.VesselName != "OTSO" {
+		t.Errorf("unexpected track %s", rr.Body.String())
+	}
+
+	if rr := get("230252000", "?since="+time.Unix(now-120, 0).UTC().Format(time.RFC3339)); rr.Code != http.StatusOK || !json.Valid(rr.Body.Bytes()) {
+		t.Errorf("expected RFC 3339 since to be accepted, got %d", rr.Code)
+	}
+	if rr := get("230252000", "?since=yesterday"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid since, got %d", rr.Code)
+	}
+	if rr := get("230289000", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown vessel, got %d", rr.Code)
+	}
+}
+
+func TestVesselsHandler(t *testing.T) {
+	exp := New(config.Config{
+		Targets: config.NewTargets([]config.Vessel{{Name: "OTSO", Operator: "Arctia"}, {Name: "YMER"}}),
+	})
+	refreshed := time.Now()
+	exp.snapshot = models.Snapshot{
+		LastRefresh: refreshed,
+		Positions: []models.IcebreakerPosition{
+			{Name: "OTSO", MMSI: "230252000", Country: "FI", Latitude: 65.0, Longitude: 25.2, Timestamp: refreshed.Unix() - 30, SpeedOverGround: ptr(5.0),
+				StaticData: models.StaticData{IMO: 8914428, Destination: "KEMI"}},
+			{Name: "YMER", MMSI: "265547250", Country: "SE", Latitude: 65.5, Longitude: 22.1, Timestamp: refreshed.Unix()},
+		},
+	}
+
+	get := func(handler http.HandlerFunc, target string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler(rr, httptest.NewRequest(http.MethodGet, target, nil))
+		return rr
+	}
+
+	rr := get(exp.VesselsHandler, "/api/v1/vessels?country=fi")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	var list struct {
+		Status struct {
+			Up          bool       `json:"up"`
+			LastRefresh *time.Time `json:"last_refresh"`
+		} `json:"status"`
+		Count   int              `json:"count"`
+		Vessels []map[string]any `json:"vessels"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if !list.Status.Up || list.Status.LastRefresh == nil || list.Count != 1 {
+		t.Fatalf("unexpected envelope %s", rr.Body.String())
+	}
+	otso := list.Vessels[0]
+	for key, want := range map[string]any{
+		"mmsi":                    "230252000",
+		"country_name":            "Finland",
+		"operator":                "Arctia",
+		"speed_over_ground_knots": 5.0,
+		"heading_degrees":         nil,
+		"imo":                     8914428.0,
+		"destination":             "KEMI",
+		"sea_area":                "Bay of Bothnia",
+	} {
+		if got, ok := otso[key]; !ok || got != want {
+			t.Errorf("%s = %v, want %v", key, got, want)
+		}
+	}
+	if port, _ := otso["nearest_port"].(map[string]any); port["locode"] != "FIOUL" || port["distance_nautical_miles"].(float64) > 10 {
+		t.Errorf("unexpected nearest port %v", otso["nearest_port"])
+	}
+	if age := otso["report_age_seconds"].(float64); age < 30 || age > 60 {
+		t.Errorf("unexpected report age %v", age)
+	}
+	if _, ok := otso["beam_meters"]; ok {
+		t.Error("expected unreported static data to be omitted")
+	}
+
+	for target, want := range map[string]int{
+		"/api/v1/vessels?name=ym":                   1,
+		"/api/v1/vessels?bbox=20,64,23,66":          1,
+		"/api/v1/vessels?bbox=20,64,26,66&country=": 2,
+		"/api/v1/vessels?country=NO":                0,
+	} {
+		if err := json.Unmarshal(get(exp.VesselsHandler, target).Body.Bytes(), &list); err != nil || list.Count != want {
+			t.Errorf("%s: expected %d vessels, got %d (%v)", target, want, list.Count, err)
+		}
+	}
+	if rr := get(exp.VesselsHandler, "/api/v1/vessels?bbox=1,2,3"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for invalid bbox, got %d", rr.Code)
+	}
+
+	rr = get(exp.VesselsGeoJSONHandler, "/api/v1/vessels.geojson?name=otso")
+	var fc struct {
+		Type     string
+		Status   struct{ Up bool }
+		Features []struct {
+			ID       string
+			Geometry struct {
+				Type        string
+				Coordinates [2]float64
+			}
+			Properties struct {
+				Name string `json:"name"`
+			}
+		}
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil {
+		t.Fatal(err)
+	}
+	if fc.Type != "FeatureCollection" || !fc.Status.Up || len(fc.Features) != 1 {
+		t.Fatalf("unexpected collection %s", rr.Body.String())
+	}
+	if f := fc.Features[0]; f.ID != "230252000" || f.Geometry.Type != "Point" || f.Geometry.Coordinates != [2]float64{25.2, 65.0} || f.Properties.Name != "OTSO" {
+		t.Errorf("unexpected feature %+v", f)
+	}
+}
@@ -0,0 +1,427 @@
+package exporter
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/digitraffic"
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// feedAssist events report an icebreaker starting or ending the assistance
+// of a merchant vessel.
+const feedAssist = "assist"
+
+const (
+	// trafficMaxAge drops the location of a vessel that stopped reporting.
+	trafficMaxAge = 30 * time.Minute
+	// assistMinSpeed is the speed in knots both vessels need; ships moored
+	// side by side are not a convoy.
+	assistMinSpeed = 2
+	// assistSpeedTolerance and assistCourseTolerance bound how much the
+	// speed (knots) and course (degrees) of a following vessel may differ
+	// from the icebreaker's.
+	assistSpeedTolerance  = 3
+	assistCourseTolerance = 30
+	// assistMaxSkew is the largest time between the two reports compared.
+	assistMaxSkew = 5 * time.Minute
+	// assistGap is how long a following vessel may fall out of formation,
+	// or miss reports, before the assistance ends.
+	assistGap = 5 * time.Minute
+	// assistEventLog is the number of assist events kept for the API.
+	assistEventLog = 256
+)
+
+// trafficVessel is what is known about a vessel that is not a target.
+type trafficVessel struct {
+	name     string
+	shipType int
+	// seen is when the vessel was last in a vessels list.
+	seen time.Time
+}
+
+// traffic keeps the latest locations of the vessels that are not targets,
+// for assist detection.
+type traffic struct {
+	mu        sync.Mutex
+	vessels   map[string]trafficVessel
+	locations map[string]models.LocationRecord
+}
+
+func newTraffic() *traffic {
+	return &traffic{vessels: map[string]trafficVessel{}, locations: map[string]models.LocationRecord{}}
+}
+
+// vesselFilter returns the filter for the target vessels of the vessels
+// list. With assist detection it also remembers the name and ship type of
+// every other vessel it sees.
+func (t *traffic) vesselFilter(cfg config.Config) func(digitraffic.Vessel) bool {
+	isTarget := isTargetVessel(cfg)
+	if !cfg.AssistEnabled {
+		return isTarget
+	}
+	return func(v digitraffic.Vessel) bool {
+		if isTarget(v) {
+			return true
+		}
+		t.mu.Lock()
+		t.vessels[strconv.Itoa(v.MMSI)] = trafficVessel{name: strings.TrimSpace(v.Name), shipType: v.ShipType, seen: time.Now()}
+		t.mu.Unlock()
+		return false
+	}
+}
+
+// update stores the vessels and locations that are not tracked. Locations
+// older than trafficMaxAge are dropped, and so are vessels without a
+// location that were not in a vessels list for as long.
+func (t *traffic) update(vessels []models.VesselMetadata, locations []models.LocationRecord, tracked func(models.LocationRecord) bool, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, v := range vessels {
+		if tracked(models.LocationRecord{MMSI: v.MMSI, Name: v.Name}) {
+			continue
+		}
+		if current, ok := t.vessels[v.MMSI]; ok && v.ShipType == 0 {
+			current.seen = now
+			t.vessels[v.MMSI] = current
+			continue
+		}
+		t.vessels[v.MMSI] = trafficVessel{name: v.Name, shipType: v.ShipType, seen: now}
+	}
+	for _, loc := range locations {
+		if loc.MMSI == "" || math.IsNaN(loc.Latitude) || math.IsNaN(loc.Longitude) || tracked(loc) {
+			continue
+		}
+		if current, ok := t.locations[loc.MMSI]; ok && current.Timestamp > loc.Timestamp {
+			continue
+		}
+		t.locations[loc.MMSI] = loc
+	}
+	oldest := now.Add(-trafficMaxAge)
+	for mmsi, loc := range t.locations {
+		if loc.Timestamp < oldest.Unix() {
+			delete(t.locations, mmsi)
+		}
+	}
+	for mmsi, v := range t.vessels {
+		if _, ok := t.locations[mmsi]; !ok && v.seen.Before(oldest) {
+			delete(t.vessels, mmsi)
+		}
+	}
+}
+
+// reset forgets everything, when assist detection is disabled.
+func (t *traffic) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.vessels)
+	clear(t.locations)
+}
+
+// merchants returns the located cargo ships and tankers (AIS ship types
+// 70-89), named from the vessels list where the location lacks a name.
+func (t *traffic) merchants() []models.LocationRecord {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var out []models.LocationRecord
+	for mmsi, loc := range t.locations {
+		v := t.vessels[mmsi]
+		if v.shipType < 70 || v.shipType > 89 {
+			continue
+		}
+		if loc.Name == "" {
+			loc.Name = v.name
+		}
+		out = append(out, loc)
+	}
+	return out
+}
+
+func (t *traffic) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.locations)
+}
+
+func (t *traffic) hasVessels() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.vessels) > 0
+}
+
+// keepLocation returns the filter for the locations payload: the wanted
+// MMSIs, or all of them with assist detection.
+func keepLocation(cfg config.Config, wanted map[string]struct{}) func(mmsi string) bool {
+	return func(mmsi string) bool {
+		if cfg.AssistEnabled {
+			return true
+		}
+		_, ok := wanted[mmsi]
+		return ok
+	}
+}
+
+type assistKey struct {
+	icebreaker, vessel string
+}
+
+// assist is a merchant vessel following an icebreaker. Since is when it
+// was first seen following and LastSeen the latest time; it is active once
+// it has followed for the configured minimum duration.
+type assist struct {
+	IcebreakerMMSI string `json:"icebreaker_mmsi"`
+	IcebreakerName string `json:"icebreaker_name"`
+	VesselMMSI     string `json:"vessel_mmsi"`
+	VesselName     string `json:"vessel_name"`
+	Since          int64  `json:"since"`
+	LastSeen       int64  `json:"last_seen"`
+	active         bool
+}
+
+// assistEvent is logged and published on the live feed when an assistance
+// starts or ends.
+type assistEvent struct {
+	Event           string `json:"event"`
+	IcebreakerMMSI  string `json:"icebreaker_mmsi"`
+	IcebreakerName  string `json:"icebreaker_name"`
+	VesselMMSI      string `json:"vessel_mmsi"`
+	VesselName      string `json:"vessel_name"`
+	Timestamp       int64  `json:"timestamp"`
+	DurationSeconds int64  `json:"duration_seconds"`
+}
+
+// assistTracker detects merchant vessels travelling in the wake of an
+// icebreaker.
+type assistTracker struct {
+	mu      sync.Mutex
+	assists map[assistKey]*assist
+	// events holds the latest assistEventLog events, oldest first.
+	events []assistEvent
+	now    func() time.Time
+}
+
+func newAssistTracker() *assistTracker {
+	return &assistTracker{assists: map[assistKey]*assist{}, now: time.Now}
+}
+
+// observe compares the icebreakers with the merchant vessels at now and
+// returns the assistances that started or ended.
+func (t *assistTracker) observe(cfg config.Config, icebreakers []models.IcebreakerPosition, merchants []models.LocationRecord, now time.Time) []assistEvent {
+	ts := now.Unix()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var events []assistEvent
+	for _, ib := range icebreakers {
+		for _, m := range merchants {
+			if !following(ib, m, cfg.AssistRadius) {
+				continue
+			}
+			key := assistKey{icebreaker: ib.MMSI, vessel: m.MMSI}
+			a, ok := t.assists[key]
+			if !ok {
+				a = &assist{IcebreakerMMSI: ib.MMSI, VesselMMSI: m.MMSI, Since: ts}
+				t.assists[key] = a
+			}
+			a.IcebreakerName, a.VesselName, a.LastSeen = ib.Name, m.Name, ts
+			if !a.active && time.Duration(ts-a.Since)*time.Second >= cfg.AssistMinDuration {
+				a.active = true
+				events = append(events, a.event("start", a.Since))
+			}
+		}
+	}
+	for key, a := range t.assists {
+		if time.Duration(ts-a.LastSeen)*time.Second <= assistGap {
+			continue
+		}
+		delete(t.assists, key)
+		if a.active {
+			events = append(events, a.event("end", a.LastSeen))
+		}
+	}
+
+	t.events = append(t.events, events...)
+	if n := len(t.events) - assistEventLog; n > 0 {
+		t.events = slices.Delete(t.events, 0, n)
+	}
+	return events
+}
+
+func (a *assist) event(kind string, ts int64) assistEvent {
+	return assistEvent{
+		Event:           kind,
+		IcebreakerMMSI:  a.IcebreakerMMSI,
+		IcebreakerName:  a.IcebreakerName,
+		VesselMMSI:      a.VesselMMSI,
+		VesselName:      a.VesselName,
+		Timestamp:       ts,
+		DurationSeconds: a.LastSeen - a.Since,
+	}
+}
+
+// active returns the active assistances ordered by icebreaker and vessel.
+func (t *assistTracker) active() []assist {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	out := []assist{}
+	for _, a := range t.assists {
+		if a.active {
+			out = append(out, *a)
+		}
+	}
+	slices.SortFunc(out, func(a, b assist) int {
+		return strings.Compare(a.IcebreakerMMSI+a.VesselMMSI, b.IcebreakerMMSI+b.VesselMMSI)
+	})
+	return out
+}
+
+// counts returns the number of vessels each icebreaker is assisting.
+func (t *assistTracker) counts() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := map[string]int{}
+	for key, a := range t.assists {
+		if a.active {
+			out[key.icebreaker]++
+		}
+	}
+	return out
+}
+
+func (t *assistTracker) log() []assistEvent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]assistEvent{}, t.events...)
+}
+
+func (t *assistTracker) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	clear(t.assists)
+	t.events = nil
+}
+
+// following reports whether the merchant vessel is within radius nautical
+// miles astern of the icebreaker, making way at a similar course and speed.
+func following(ib models.IcebreakerPosition, m models.LocationRecord, radius float64) bool {
+	if ib.SpeedOverGround == nil || ib.CourseOverGround == nil || m.SpeedOverGround == nil || m.CourseOverGround == nil {
+		return false
+	}
+	if *ib.SpeedOverGround < assistMinSpeed || *m.SpeedOverGround < assistMinSpeed {
+		return false
+	}
+	if math.Abs(*ib.SpeedOverGround-*m.SpeedOverGround) > assistSpeedTolerance || angleDifference(*ib.CourseOverGround, *m.CourseOverGround) > assistCourseTolerance {
+		return false
+	}
+	if time.Duration(max(ib.Timestamp-m.Timestamp, m.Timestamp-ib.Timestamp))*time.Second > assistMaxSkew {
+		return false
+	}
+	from, to := geo.Point{Lon: ib.Longitude, Lat: ib.Latitude}, geo.Point{Lon: m.Longitude, Lat: m.Latitude}
+	if geo.Distance(from, to) > radius*geo.MetersPerNauticalMile {
+		return false
+	}
+	return angleDifference(geo.Bearing(from, to), *ib.CourseOverGround) > 90
+}
+
+// angleDifference returns the smaller angle between two bearings in
+// degrees.
+func angleDifference(a, b float64) float64 {
+	d := math.Mod(math.Abs(a-b), 360)
+	return min(d, 360-d)
+}
+
+// updateAssists runs assist detection on the plausible positions, logs the assistances
+// that started or ended and publishes them on the live feed.
+func (e *Exporter) updateAssists(positions []models.IcebreakerPosition) {
+	cfg := e.currentConfig()
+	if !cfg.AssistEnabled {
+		e.assists.reset()
+		return
+	}
+	for _, ev := range e.assists.observe(cfg, plausible(positions), e.traffic.merchants(), e.assists.now()) {
+		slog.Info("icebreaker assistance "+ev.Event, "icebreaker", ev.IcebreakerName, "vessel", ev.VesselName, "vesselMMSI", ev.VesselMMSI, "durationSeconds", ev.DurationSeconds)
+		e.feed.publish(feedAssist, ev)
+	}
+}
+
+// trafficLoop runs assist detection at interval until ctx is done. It keeps
+// assists current while the MQTT stream, which carries only the
+// icebreakers, replaces the REST refreshes.
+func (e *Exporter) trafficLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.refreshTraffic(ctx)
+		}
+	}
+}
+
+// refreshTraffic downloads the vessels and locations payloads for the
+// traffic and runs assist detection on the current positions. Assistances
+// still end when the download fails.
+func (e *Exporter) refreshTraffic(ctx context.Context) {
+	cfg := e.currentConfig()
+	api := e.client()
+	localVessels, localLocations := e.local.records()
+	bytesBefore, _ := api.Transferred()
+	retriesBefore := api.Retries()
+
+	reqCtx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout)
+	var (
+		vessels   []models.VesselMetadata
+		locations []models.LocationRecord
+		err       error
+	)
+	if cfg.Parser == config.ParserHeuristic {
+		vessels, locations, _, err = fetchHeuristic(reqCtx, api, cfg)
+	} else {
+		vessels, locations, _, err = fetchTyped(reqCtx, api, cfg, e.traffic, localVessels)
+	}
+	cancel()
+
+	bytesAfter, _ := api.Transferred()
+	e.transferredBytes.Add(bytesAfter - bytesBefore)
+	e.retries.Add(api.Retries() - retriesBefore)
+
+	if err != nil {
+		slog.Warn("traffic refresh failed", "error", err)
+	} else {
+		vessels = append(vessels, localVessels...)
+		locations = append(locations, localLocations...)
+		e.traffic.update(vessels, locations, trackedLocation(vessels, cfg.Targets), time.Now())
+	}
+	e.updateAssists(e.GetSnapshot().Positions)
+}
+
+// apiAssists is the response of AssistsHandler.
+type apiAssists struct {
+	Active []assist      `json:"active"`
+	Events []assistEvent `json:"events"`
+}
+
+// AssistsHandler serves the active assistances and the latest assist
+// events, oldest first.
+func (e *Exporter) AssistsHandler(w http.ResponseWriter, _ *http.Request) {
+	if !e.currentConfig().AssistEnabled {
+		http.Error(w, "assist detection is disabled", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, "application/json", apiAssists{Active: e.assists.active(), Events: e.assists.log()})
+}
@@ -0,0 +1,257 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+	"github.com/joluc/icebreaker-exporter/pkg/mqtt/mqtttest"
+)
+
+// testConvoy is OTSO heading north at 10 knots off Kemi.
+var testConvoy = models.IcebreakerPosition{Name: "OTSO", MMSI: "230252000", Latitude: 65, Longitude: 24, Timestamp: 1000, SpeedOverGround: ptr(10.0), CourseOverGround: ptr(0.0)}
+
+func testMerchant(lat float64, cog, sog float64, ts int64) models.LocationRecord {
+	return models.LocationRecord{Name: "BALTIC CARRIER", MMSI: "230999000", Latitude: lat, Longitude: 24, Timestamp: ts, SpeedOverGround: ptr(sog), CourseOverGround: ptr(cog)}
+}
+
+func TestFollowing(t *testing.T) {
+	astern := 65 - 0.5/60 // half a nautical mile
+	tests := []struct {
+		name string
+		m    models.LocationRecord
+		want bool
+	}{
+		{"astern", testMerchant(astern, 5, 9, 1000), true},
+		{"astern across north", testMerchant(astern, 355, 11, 1060), true},
+		{"ahead", testMerchant(65+0.5/60, 0, 10, 1000), false},
+		{"beyond the radius", testMerchant(65-3.0/60, 0, 10, 1000), false},
+		{"other course", testMerchant(astern, 60, 10, 1000), false},
+		{"slower", testMerchant(astern, 0, 5, 1000), false},
+		{"stale report", testMerchant(astern, 0, 10, 1000-600), false},
+		{"no course", models.LocationRecord{MMSI: "230999000", Latitude: astern, Longitude: 24, Timestamp: 1000, SpeedOverGround: ptr(10.0)}, false},
+	}
+	for _, tt := range tests {
+		if got := following(testConvoy, tt.m, 2); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	moored := testConvoy
+	moored.SpeedOverGround = ptr(0.0)
+	if following(moored, testMerchant(65-0.1/60, 0, 0, 1000), 2) {
+		t.Error("expected moored vessels not to be a convoy")
+	}
+}
+
+func TestAssistTracker(t *testing.T) {
+	tracker := newAssistTracker()
+	cfg := config.Config{AssistRadius: 2, AssistMinDuration: 10 * time.Minute}
+	start := time.Unix(1000, 0)
+	at := func(d time.Duration, following bool) []assistEvent {
+		now := start.Add(d)
+		ib := testConvoy
+		ib.Timestamp = now.Unix()
+		var merchants []models.LocationRecord
+		if following {
+			merchants = append(merchants, testMerchant(65-0.5/60, 0, 10, now.Unix()))
+		}
+		return tracker.observe(cfg, []models.IcebreakerPosition{ib}, merchants, now)
+	}
+
+	if events := at(0, true); len(events) != 0 {
+		t.Fatalf("expected no events before the minimum duration, got %+v", events)
+	}
+	at(5*time.Minute, true)
+	if n := tracker.counts()["230252000"]; n != 0 {
+		t.Errorf("expected no assisted vessels yet, got %d", n)
+	}
+	events := at(10*time.Minute, true)
+	if len(events) != 1 || events[0].Event != "start" || events[0].Timestamp != 1000 || events[0].VesselName != "BALTIC CARRIER" {
+		t.Fatalf("expected an assist start, got %+v", events)
+	}
+	if n := tracker.counts()["230252000"]; n != 1 {
+		t.Errorf("expected one assisted vessel, got %d", n)
+	}
+
+	// A short gap does not end the assistance.
+	if events := at(14*time.Minute, false); len(events) != 0 {
+		t.Errorf("expected no events within the gap, got %+v", events)
+	}
+	events = at(16*time.Minute, false)
+	if len(events) != 1 || events[0].Event != "end" || events[0].DurationSeconds != 600 {
+		t.Fatalf("expected an assist end after 10 minutes, got %+v", events)
+	}
+	if active := tracker.active(); len(active) != 0 {
+		t.Errorf("expected no active assists, got %+v", active)
+	}
+	if log := tracker.log(); len(log) != 2 {
+		t.Errorf("expected two logged events, got %+v", log)
+	}
+}
+
+func TestTrafficEviction(t *testing.T) {
+	tr := newTraffic()
+	now := time.Unix(1700000000, 0)
+	tracked := func(loc models.LocationRecord) bool { return loc.MMSI == "230252000" }
+	vessels := []models.VesselMetadata{
+		{Name: "OTSO", MMSI: "230252000"},
+		{Name: "BALTIC CARRIER", MMSI: "230999000", StaticData: models.StaticData{ShipType: 70}},
+		{Name: "BOTHNIA TANKER", MMSI: "230888000", StaticData: models.StaticData{ShipType: 80}},
+	}
+	merchant := testMerchant(65, 0, 10, now.Unix())
+
+	tr.update(vessels, []models.LocationRecord{merchant}, tracked, now)
+	if _, ok := tr.vessels["230252000"]; ok {
+		t.Error("expected the tracked vessel not to be stored as traffic")
+	}
+	if len(tr.vessels) != 2 || tr.len() != 1 {
+		t.Fatalf("expected 2 traffic vessels and 1 location, got %d and %d", len(tr.vessels), tr.len())
+	}
+
+	// The tanker never reports a location and drops out; the cargo ship
+	// keeps its entry while it reports.
+	now = now.Add(trafficMaxAge + time.Minute)
+	merchant.Timestamp = now.Unix()
+	tr.update(nil, []models.LocationRecord{merchant}, tracked, now)
+	if _, ok := tr.vessels["230888000"]; ok || len(tr.vessels) != 1 {
+		t.Errorf("expected the vessel without a location to be evicted, got %+v", tr.vessels)
+	}
+	if merchants := tr.merchants(); len(merchants) != 1 || merchants[0].MMSI != "230999000" {
+		t.Errorf("expected the reporting cargo ship, got %+v", merchants)
+	}
+
+	// Once it stops reporting, both its location and its entry go.
+	now = now.Add(trafficMaxAge + time.Minute)
+	tr.update(nil, nil, tracked, now)
+	if len(tr.vessels) != 0 || tr.len() != 0 {
+		t.Errorf("expected everything to be evicted, got %d vessels and %d locations", len(tr.vessels), tr.len())
+	}
+}
+
+func TestRefreshAssists(t *testing.T) {
+	now := time.Now().UnixMilli()
+	feature := func(mmsi int, lat, sog, cog float64) string {
+		return fmt.Sprintf(`{"type":"Feature","mmsi":%d,"geometry":{"type":"Point","coordinates":[24.0,%f]},"properties":{"mmsi":%d,"sog":%g,"cog":%g,"navStat":0,"timestampExternal":%d}}`, mmsi, lat, mmsi, sog, cog, now)
+	}
+	vessels := `[{"mmsi":230252000,"name":"OTSO"},{"mmsi":230999000,"name":"BALTIC CARRIER","shipType":70},{"mmsi":230888000,"name":"BOTHNIA TANKER","shipType":80},{"mmsi":230777000,"name":"TUG","shipType":52}]`
+	locations := `{"type":"FeatureCollection","features":[` + strings.Join([]string{
+		feature(230252000, 65, 10, 0),
+		feature(230999000, 65-0.5/60, 9.5, 5), // cargo ship astern
+		feature(230888000, 65+0.5/60, 10, 0),  // tanker ahead
+		feature(230777000, 65-0.3/60, 10, 0),  // tug astern
+	}, ",") + `]}`
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vessels", func(w http.ResponseWriter, _ *http.Request) { _, _ = io.WriteString(w, vessels) })
+	mux.HandleFunc("/locations", func(w http.ResponseWriter, _ *http.Request) { _, _ = io.WriteString(w, locations) })
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	exp := New(config.Config{
+		VesselsURL:     srv.URL + "/vessels",
+		LocationsURL:   srv.URL + "/locations",
+		RequestTimeout: time.Second,
+		Targets:        config.NewTargets(config.ParseVesselNames("OTSO")),
+		Parser:         config.ParserTyped,
+		FetchStrategy:  config.FetchFull,
+		AssistEnabled:  true,
+		AssistRadius:   2,
+	})
+	exp.Refresh(context.Background())
+
+	rr := httptest.NewRecorder()
+	exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+	for _, want := range []string{
+		`icebreaker_traffic_vessels 3`,
+		`icebreaker_assisted_vessels{vessel_name="OTSO",mmsi="230252000",country="FI"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in output:\n%s", want, body)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	exp.AssistsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/assists", nil))
+	var got apiAssists
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Active) != 1 || got.Active[0].VesselName != "BALTIC CARRIER" || len(got.Events) != 1 || got.Events[0].Event != "start" {
+		t.Errorf("unexpected assists %+v", got)
+	}
+
+	exp.cfg.Store(&config.Config{})
+	rr = httptest.NewRecorder()
+	exp.AssistsHandler(rr, httptest.NewRequest(http.MethodGet, "/api/v1/assists", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 with assist detection disabled, got %d", rr.Code)
+	}
+}
+
+func TestStreamLoopAssists(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	var moored atomic.Bool
+	feature := func(mmsi int, lat, sog float64) string {
+		return fmt.Sprintf(`{"type":"Feature","mmsi":%d,"geometry":{"type":"Point","coordinates":[24.0,%f]},"properties":{"mmsi":%d,"sog":%g,"cog":0,"navStat":0,"timestampExternal":%d}}`, mmsi, lat, mmsi, sog, time.Now().UnixMilli())
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vessels", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `[{"mmsi":230252000,"name":"OTSO"},{"mmsi":230999000,"name":"BALTIC CARRIER","shipType":70}]`)
+	})
+	mux.HandleFunc("/locations", func(w http.ResponseWriter, _ *http.Request) {
+		merchant := feature(230999000, 65-0.5/60, 9.5)
+		if moored.Load() {
+			merchant = feature(230999000, 64, 0)
+		}
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[`+feature(230252000, 65, 10)+`,`+merchant+`]}`)
+	})
+	mux.Handle("/mqtt", broker)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	exp := New(config.Config{
+		VesselsURL:      srv.URL + "/vessels",
+		LocationsURL:    srv.URL + "/locations",
+		MQTTURL:         "ws" + strings.TrimPrefix(srv.URL, "http") + "/mqtt",
+		RefreshInterval: 50 * time.Millisecond,
+		RequestTimeout:  time.Second,
+		Targets:         config.NewTargets(config.ParseVesselNames("OTSO")),
+		Parser:          config.ParserTyped,
+		FetchStrategy:   config.FetchFull,
+		AssistEnabled:   true,
+		AssistRadius:    2,
+	})
+	var skew atomic.Int64
+	exp.assists.now = func() time.Time { return time.Now().Add(time.Duration(skew.Load())) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go exp.StreamLoop(ctx)
+
+	waitFor(t, "subscription", func() bool { return len(broker.Subscriptions()) == 2 })
+	waitFor(t, "assist start", func() bool { return len(exp.assists.active()) == 1 })
+
+	// The stream stays connected, so only the traffic refreshes can end
+	// the assistance.
+	moored.Store(true)
+	skew.Store(int64(assistGap + time.Minute))
+	waitFor(t, "assist end", func() bool { return len(exp.assists.active()) == 0 })
+	if log := exp.assists.log(); len(log) != 2 || log[1].Event != "end" {
+		t.Errorf("expected an assist end, got %+v", log)
+	}
+	if broker.Connects() != 1 {
+		t.Errorf("expected the stream to stay connected, got %d connects", broker.Connects())
+	}
+}
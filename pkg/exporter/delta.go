@@ -0,0 +1,116 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/digitraffic"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// deltaResync bounds how long incremental refreshes build on each other
+// before the full locations payload is downloaded again.
+const deltaResync = time.Hour
+
+// deltaState carries the records of previous refreshes so that incremental
+// refreshes only request what changed since.
+type deltaState struct {
+	mu        sync.Mutex
+	vessels   []models.VesselMetadata
+	wanted    map[string]struct{}
+	locations map[string]models.LocationRecord
+	// sightings holds the coordinates of every vessel, merged like locations.
+	sightings map[string]models.LocationRecord
+	// since is the from parameter of the next locations request; zero
+	// requests the full payload.
+	since    time.Time
+	resynced time.Time
+}
+
+// reset forgets the vessels list and the wanted MMSIs, so that the next
+// refresh downloads both payloads in full, e.g. after the targets changed.
+func (d *deltaState) reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.vessels, d.wanted, d.since = nil, nil, time.Time{}
+}
+
+// fetchIncremental is the typed full strategy using conditional requests
+// for the vessels list and from=<epoch ms> deltas for the locations, merged
+// into the records of the previous refreshes.
+func fetchIncremental(ctx context.Context, api *digitraffic.Client, cfg config.Config, delta *deltaState, traffic *traffic, localVessels []models.VesselMetadata) ([]models.VesselMetadata, []models.LocationRecord, []models.LocationRecord, error) {
+	delta.mu.Lock()
+	defer delta.mu.Unlock()
+
+	start := time.Now()
+	if start.Sub(delta.resynced) >= deltaResync {
+		delta.since = time.Time{}
+	}
+
+	keepVessel := traffic.vesselFilter(cfg)
+	matched, err := api.FetchVesselsIfModified(ctx, keepVessel)
+	if errors.Is(err, digitraffic.ErrNotModified) && (delta.vessels == nil || cfg.AssistEnabled && !traffic.hasVessels()) {
+		// Nothing to build on, e.g. after assist detection was enabled.
+		matched, err = api.FetchVessels(ctx, keepVessel)
+	}
+	switch {
+	case errors.Is(err, digitraffic.ErrNotModified):
+	case err != nil:
+		return nil, nil, nil, fmt.Errorf("fetch vessels: %w", err)
+	default:
+		delta.vessels = targetMetadata(matched)
+	}
+
+	wanted := targetMMSIs(cfg, delta.vessels, localVessels)
+	if !maps.Equal(wanted, delta.wanted) {
+		// Deltas would miss the current position of new targets.
+		delta.since = time.Time{}
+	}
+	keep := keepLocation(cfg, wanted)
+
+	var collection digitraffic.Locations
+	if delta.since.IsZero() {
+		collection, err = api.FetchLocations(ctx, keep)
+	} else {
+		collection, err = api.FetchLocationsFrom(ctx, delta.since, keep)
+	}
+	switch {
+	case errors.Is(err, digitraffic.ErrNotModified):
+	case err != nil:
+		return nil, nil, nil, fmt.Errorf("fetch locations: %w", err)
+	default:
+		if delta.since.IsZero() {
+			delta.locations = make(map[string]models.LocationRecord, len(collection.Features))
+			delta.sightings = make(map[string]models.LocationRecord, len(collection.Sightings))
+			delta.resynced = start
+		}
+		for _, sighting := range collection.Sightings {
+			delta.sightings[sighting.MMSI] = sighting
+		}
+		for _, f := range collection.Features {
+			loc := f.Location()
+			if current, ok := delta.locations[loc.MMSI]; ok && current.Timestamp > loc.Timestamp {
+				continue
+			}
+			delta.locations[loc.MMSI] = loc
+		}
+		delta.since = start
+		if !collection.DataUpdatedTime.IsZero() {
+			delta.since = collection.DataUpdatedTime
+		}
+	}
+	delta.wanted = wanted
+
+	for mmsi := range delta.locations {
+		if !keep(mmsi) {
+			delete(delta.locations, mmsi)
+		}
+	}
+	return slices.Clone(delta.vessels), slices.Collect(maps.Values(delta.locations)), slices.Collect(maps.Values(delta.sightings)), nil
+}
@@ -0,0 +1,138 @@
+package exporter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+)
+
+func TestRefreshIncremental(t *testing.T) {
+	var locationCalls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vessels", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"vessels-1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"vessels-1"`)
+		_, _ = io.WriteString(w, testVesselsJSON)
+	})
+	mux.HandleFunc("/locations", func(w http.ResponseWriter, r *http.Request) {
+		locationCalls++
+		from := r.URL.Query().Get("from")
+		switch locationCalls {
+		case 1:
+			if from != "" {
+				t.Errorf("first refresh should fetch the full payload, got from=%s", from)
+			}
+			_, _ = io.WriteString(w, `{"type":"FeatureCollection","dataUpdatedTime":"2023-11-14T22:13:20Z","features":[`+
+				`{"type":"Feature","mmsi":230124000,"geometry":{"type":"Point","coordinates":[24.9,60.1]},"properties":{"mmsi":230124000,"sog":1.0,"timestampExternal":1700000000000}},`+
+				`{"type":"Feature","mmsi":111111111,"geometry":{"type":"Point","coordinates":[10,10]},"properties":{"mmsi":111111111,"timestampExternal":1700000000000}}]}`)
+		case 2:
+			if from != "1700000000000" {
+				t.Errorf("expected from=1700000000000, got %q", from)
+			}
+			_, _ = io.WriteString(w, `{"type":"FeatureCollection","dataUpdatedTime":"2023-11-14T22:14:20Z","features":[]}`)
+		default:
+			if from != "1700000060000" {
+				t.Errorf("expected from=1700000060000, got %q", from)
+			}
+			_, _ = io.WriteString(w, `{"type":"FeatureCollection","dataUpdatedTime":"2023-11-14T22:15:20Z","features":[`+
+				`{"type":"Feature","mmsi":230124000,"geometry":{"type":"Point","coordinates":[25.0,60.2]},"properties":{"mmsi":230124000,"sog":2.0,"timestampExternal":1700000100000}}]}`)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	exp := New(config.Config{
+		VesselsURL:         srv.URL + "/vessels",
+		LocationsURL:       srv.URL + "/locations",
+		RequestTimeout:     time.Second,
+		Targets:            config.NewTargets(config.ParseVesselNames("OTSO")),
+		Parser:             config.ParserTyped,
+		FetchStrategy:      config.FetchFull,
+		IncrementalRefresh: true,
+	})
+
+	exp.Refresh(context.Background())
+	first := exp.GetSnapshot()
+	if first.LastRefreshError != "" || len(first.Positions) != 1 {
+		t.Fatalf("unexpected first snapshot %+v", first)
+	}
+	if first.RefreshBytes == 0 || first.RefreshRecords != 4 {
+		t.Errorf("expected bytes and 4 records on first refresh, got %d bytes %d records", first.RefreshBytes, first.RefreshRecords)
+	}
+
+	// Empty delta and unchanged vessels keep the previous position.
+	exp.Refresh(context.Background())
+	second := exp.GetSnapshot()
+	if second.LastRefreshError != "" || len(second.Positions) != 1 || second.Positions[0].Latitude != 60.1 {
+		t.Fatalf("unexpected second snapshot %+v", second)
+	}
+	if second.RefreshRecords != 0 {
+		t.Errorf("expected no records on unchanged refresh, got %d", second.RefreshRecords)
+	}
+
+	exp.Refresh(context.Background())
+	third := exp.GetSnapshot()
+	if len(third.Positions) != 1 || third.Positions[0].Latitude != 60.2 || third.Positions[0].Timestamp != 1700000100 {
+		t.Fatalf("expected delta to be merged, got %+v", third.Positions)
+	}
+}
+
+func TestRefreshIncrementalBrokenBody(t *testing.T) {
+	var vesselCalls int
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vessels", func(w http.ResponseWriter, r *http.Request) {
+		vesselCalls++
+		if r.Header.Get("If-None-Match") == `"vessels-1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"vessels-1"`)
+		if vesselCalls == 1 {
+			_, _ = io.WriteString(w, testVesselsJSON[:len(testVesselsJSON)/2])
+			return
+		}
+		_, _ = io.WriteString(w, testVesselsJSON)
+	})
+	mux.HandleFunc("/locations", func(w http.ResponseWriter, r *http.Request) {
+		if from := r.URL.Query().Get("from"); from != "" {
+			t.Errorf("expected a full locations fetch, got from=%s", from)
+		}
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","dataUpdatedTime":"2023-11-14T22:13:20Z","features":[`+
+			`{"type":"Feature","mmsi":230124000,"geometry":{"type":"Point","coordinates":[24.9,60.1]},"properties":{"mmsi":230124000,"sog":1.0,"timestampExternal":1700000000000}}]}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	exp := New(config.Config{
+		VesselsURL:         srv.URL + "/vessels",
+		LocationsURL:       srv.URL + "/locations",
+		RequestTimeout:     time.Second,
+		Targets:            config.NewTargets(config.ParseVesselNames("OTSO")),
+		Parser:             config.ParserTyped,
+		FetchStrategy:      config.FetchFull,
+		IncrementalRefresh: true,
+	})
+
+	exp.Refresh(context.Background())
+	if first := exp.GetSnapshot(); first.LastRefreshError == "" {
+		t.Fatalf("expected the truncated vessels payload to fail the refresh, got %+v", first)
+	}
+
+	// The ETag of the broken reply must not turn the retry into a 304.
+	exp.Refresh(context.Background())
+	second := exp.GetSnapshot()
+	if second.LastRefreshError != "" || len(second.Positions) != 1 {
+		t.Fatalf("expected a full refresh after the broken payload, got %+v", second)
+	}
+	if vesselCalls != 2 {
+		t.Errorf("expected 2 vessels requests, got %d", vesselCalls)
+	}
+}
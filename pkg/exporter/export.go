@@ -0,0 +1,67 @@
+package exporter
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/export"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// fleetExport is the file name that exports the tracks of all vessels.
+const fleetExport = "fleet"
+
+// ExportHandler serves the recorded tracks for chart software:
+// /export/{mmsi}.gpx or .kml for one vessel and /export/fleet.gpx or .kml for
+// all of them. The since query parameter works as for TrackHandler.
+func (e *Exporter) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	file := r.PathValue("file")
+	ext := path.Ext(file)
+	name := strings.TrimSuffix(file, ext)
+
+	var (
+		write       func(io.Writer, []export.Track) error
+		contentType string
+	)
+	switch ext {
+	case ".gpx":
+		write, contentType = export.WriteGPX, "application/gpx+xml"
+	case ".kml":
+		write, contentType = export.WriteKML, "application/vnd.google-earth.kml+xml"
+	default:
+		http.Error(w, "unsupported export format, use .gpx or .kml", http.StatusNotFound)
+		return
+	}
+
+	since, err := parseSince(r.URL.Query().Get("since"), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var points map[string][]models.TrackPoint
+	if name == fleetExport {
+		points = e.history.Tracks()
+	} else {
+		points = map[string][]models.TrackPoint{name: e.history.Track(name, since)}
+	}
+	tracks := export.Tracks(e.GetSnapshot().Positions, points, since)
+	if name != fleetExport && len(tracks) == 0 {
+		http.Error(w, "no track recorded for vessel", http.StatusNotFound)
+		return
+	}
+
+	var b bytes.Buffer
+	if err := write(&b, tracks); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": file}))
+	_, _ = w.Write(b.Bytes())
+}
@@ -0,0 +1,62 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+func TestExportHandler(t *testing.T) {
+	exp := New(config.Config{HistoryRetention: 24 * time.Hour, HistoryMaxPoints: 100})
+	now := time.Now().Unix()
+	exp.snapshot.Positions = []models.IcebreakerPosition{
+		{Name: "OTSO", MMSI: "230252000", Country: "FI", Timestamp: now},
+		{Name: "YMER", MMSI: "265547250", Country: "SE", Timestamp: now},
+	}
+	exp.history.Record([]models.IcebreakerPosition{
+		{MMSI: "230252000", Latitude: 65.0, Longitude: 25.2, Timestamp: now - 60},
+		{MMSI: "265547250", Latitude: 65.5, Longitude: 22.1, Timestamp: now - 60},
+	})
+	exp.history.Record(exp.snapshot.Positions)
+
+	get := func(file string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/export/"+file, nil)
+		req.SetPathValue("file", file)
+		rr := httptest.NewRecorder()
+		exp.ExportHandler(rr, req)
+		return rr
+	}
+
+	rr := get("230252000.gpx")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/gpx+xml" {
+		t.Fatalf("unexpected response %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if body := rr.Body.String(); !strings.Contains(body, "<name>OTSO</name>") || strings.Contains(body, "YMER") {
+		t.Errorf("expected only the OTSO track:\n%s", body)
+	}
+	if got := rr.Header().Get("Content-Disposition"); got != `attachment; filename=230252000.gpx` {
+		t.Errorf("unexpected Content-Disposition %q", got)
+	}
+
+	rr = get("fleet.kml")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/vnd.google-earth.kml+xml" {
+		t.Fatalf("unexpected response %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	for _, want := range []string{"<name>OTSO</name>", "<name>YMER</name>", `<Style id="country-SE">`} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected %q in fleet KML", want)
+		}
+	}
+
+	if rr := get("230289000.gpx"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a vessel without track, got %d", rr.Code)
+	}
+	if rr := get("fleet.csv"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown format, got %d", rr.Code)
+	}
+}
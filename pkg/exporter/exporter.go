@@ -5,39 +5,117 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"math"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/joluc/icebreaker-exporter/pkg/ais"
 	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/digitraffic"
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+	"github.com/joluc/icebreaker-exporter/pkg/history"
 	"github.com/joluc/icebreaker-exporter/pkg/models"
+	"github.com/joluc/icebreaker-exporter/pkg/port"
+	"github.com/joluc/icebreaker-exporter/pkg/seaarea"
+	"github.com/joluc/icebreaker-exporter/pkg/storage"
 )
 
 type Exporter struct {
-	client *http.Client
-	cfg    config.Config
+	// cfg and api are replaced by Reload; use currentConfig and client.
+	cfg atomic.Pointer[config.Config]
+	api atomic.Pointer[digitraffic.Client]
 
 	mu       sync.RWMutex
 	snapshot models.Snapshot
 
 	scrapeCount uint64
+
+	// Totals across client replacements by Reload.
+	transferredBytes atomic.Uint64
+	retries          atomic.Uint64
+
+	reloadMu      sync.Mutex
+	reloaded      chan struct{}
+	reloadSuccess atomic.Bool
+	lastReload    atomic.Int64
+
+	streamConnected  atomic.Bool
+	streamMessages   uint64
+	streamLastUpdate atomic.Int64 // unix seconds of the last MQTT location message
+
+	resolver *mmsiResolver
+	delta    *deltaState
+	history  *history.History
+	feed     *feed
+	zones    *zoneTracker
+	motion   *kinematics
+	navstate *navigationTracker
+	checks   *plausibility
+	traffic  *traffic
+	assists  *assistTracker
+
+	// store is set by UseStorage; persistedResolve is the resolution time
+	// last written to it.
+	store            *storage.Store
+	persistedResolve time.Time
+
+	local       *aisCache
+	nmeaReports uint64
+	nmeaErrors  uint64
 }
 
 func New(cfg config.Config) *Exporter {
-	return &Exporter{
-		client: &http.Client{},
-		cfg:    cfg,
+	e := &Exporter{
+		resolver: &mmsiResolver{},
+		delta:    &deltaState{},
+		history:  history.New(cfg.HistoryRetention, cfg.HistoryMaxPoints),
+		feed:     newFeed(),
+		zones:    newZoneTracker(),
+		motion:   newKinematics(),
+		navstate: newNavigationTracker(),
+		checks:   newPlausibility(),
+		traffic:  newTraffic(),
+		assists:  newAssistTracker(),
+		local:    newAISCache(),
+		reloaded: make(chan struct{}, 1),
 	}
+	e.cfg.Store(&cfg)
+	e.api.Store(newClient(cfg))
+	e.reloadSuccess.Store(true)
+	e.lastReload.Store(time.Now().Unix())
+	return e
 }
 
-func (e *Exporter) RootHandler() http.HandlerFunc {
-	return func(w http.ResponseWriter, _ *http.Request) {
-		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		_, _ = fmt.Fprintf(w, "Nordic icebreaker exporter\nMetrics: %s\nHealth: /healthz\n", e.cfg.MetricsPath)
+func newClient(cfg config.Config) *digitraffic.Client {
+	api := &digitraffic.Client{
+		HTTP:         &http.Client{},
+		VesselsURL:   cfg.VesselsURL,
+		LocationsURL: cfg.LocationsURL,
+		User:         cfg.DigitrafficUser,
+		Retry: digitraffic.RetryPolicy{
+			MaxAttempts: cfg.RetryMaxAttempts,
+			BaseDelay:   cfg.RetryBaseDelay,
+			MaxDelay:    cfg.RetryMaxDelay,
+		},
+	}
+	if cfg.BreakerThreshold > 0 {
+		api.Breaker = digitraffic.NewBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown)
 	}
+	return api
+}
+
+func (e *Exporter) currentConfig() config.Config {
+	return *e.cfg.Load()
+}
+
+func (e *Exporter) client() *digitraffic.Client {
+	return e.api.Load()
 }
 
 func (e *Exporter) HealthHandler(w http.ResponseWriter, _ *http.Request) {
@@ -55,6 +133,8 @@ func (e *Exporter) HealthHandler(w http.ResponseWriter, _ *http.Request) {
 func (e *Exporter) MetricsHandler(w http.ResponseWriter, _ *http.Request) {
 	atomic.AddUint64(&e.scrapeCount, 1)
 	s := e.GetSnapshot()
+	cfg := e.currentConfig()
+	api := e.client()
 	now := float64(time.Now().Unix())
 
 	up := 1.0
@@ -74,12 +154,84 @@ func (e *Exporter) MetricsHandler(w http.ResponseWriter, _ *http.Request) {
 	writeMetricHeader(&b, "icebreaker_refresh_duration_seconds", "Duration of latest refresh operation", "gauge")
 	fmt.Fprintf(&b, "icebreaker_refresh_duration_seconds %.6f\n", s.RefreshDuration.Seconds())
 
+	writeMetricHeader(&b, "icebreaker_refresh_transferred_bytes", "Response bytes received from Digitraffic by the latest refresh", "gauge")
+	fmt.Fprintf(&b, "icebreaker_refresh_transferred_bytes %d\n", s.RefreshBytes)
+
+	writeMetricHeader(&b, "icebreaker_refresh_transferred_records", "Payload records received from Digitraffic by the latest refresh", "gauge")
+	fmt.Fprintf(&b, "icebreaker_refresh_transferred_records %d\n", s.RefreshRecords)
+
+	writeMetricHeader(&b, "icebreaker_transferred_bytes_total", "Total response bytes received from the Digitraffic REST API", "counter")
+	fmt.Fprintf(&b, "icebreaker_transferred_bytes_total %d\n", e.transferredBytes.Load())
+
+	writeMetricHeader(&b, "icebreaker_digitraffic_retries_total", "Total number of retried Digitraffic requests", "counter")
+	fmt.Fprintf(&b, "icebreaker_digitraffic_retries_total %d\n", e.retries.Load())
+
+	if api.Breaker != nil {
+		current := api.Breaker.State()
+		writeMetricHeader(&b, "icebreaker_digitraffic_circuit_breaker_state", "State of the Digitraffic circuit breaker", "gauge")
+		for _, state := range digitraffic.BreakerStates {
+			value := 0
+			if state == current {
+				value = 1
+			}
+			fmt.Fprintf(&b, "icebreaker_digitraffic_circuit_breaker_state{state=\"%s\"} %d\n", state, value)
+		}
+	}
+
+	reloadSuccess := 0
+	if e.reloadSuccess.Load() {
+		reloadSuccess = 1
+	}
+	writeMetricHeader(&b, "icebreaker_config_last_reload_successful", "Whether the last configuration reload succeeded", "gauge")
+	fmt.Fprintf(&b, "icebreaker_config_last_reload_successful %d\n", reloadSuccess)
+
+	writeMetricHeader(&b, "icebreaker_config_last_reload_success_timestamp_seconds", "Unix timestamp of the last successful configuration load", "gauge")
+	fmt.Fprintf(&b, "icebreaker_config_last_reload_success_timestamp_seconds %d\n", e.lastReload.Load())
+
 	writeMetricHeader(&b, "icebreaker_scrapes_total", "Total number of /metrics scrapes", "counter")
 	fmt.Fprintf(&b, "icebreaker_scrapes_total %d\n", atomic.LoadUint64(&e.scrapeCount))
 
+	writeMetricHeader(&b, "icebreaker_feed_clients", "Number of clients connected to the live position feed", "gauge")
+	fmt.Fprintf(&b, "icebreaker_feed_clients %d\n", e.feed.clientCount())
+
+	writeMetricHeader(&b, "icebreaker_feed_events_total", "Total number of events published on the live position feed", "counter")
+	fmt.Fprintf(&b, "icebreaker_feed_events_total %d\n", e.feed.published.Load())
+
+	writeMetricHeader(&b, "icebreaker_feed_dropped_events_total", "Total number of feed events dropped for clients with a full buffer", "counter")
+	fmt.Fprintf(&b, "icebreaker_feed_dropped_events_total %d\n", e.feed.dropped.Load())
+
+	writeMetricHeader(&b, "icebreaker_position_anomalies_total", "Total number of position reports that failed the plausibility checks", "counter")
+	anomalies := e.checks.counts()
+	for _, reason := range anomalyReasons {
+		fmt.Fprintf(&b, "icebreaker_position_anomalies_total{reason=\"%s\"} %d\n", reason, anomalies[reason])
+	}
+
 	writeMetricHeader(&b, "icebreaker_positions", "Number of exported icebreaker positions", "gauge")
 	fmt.Fprintf(&b, "icebreaker_positions %d\n", len(s.Positions))
 
+	if cfg.MQTTURL != "" {
+		connected := 0
+		if e.streamConnected.Load() {
+			connected = 1
+		}
+		writeMetricHeader(&b, "icebreaker_stream_connected", "Whether the Digitraffic MQTT stream is connected", "gauge")
+		fmt.Fprintf(&b, "icebreaker_stream_connected %d\n", connected)
+
+		writeMetricHeader(&b, "icebreaker_stream_messages_total", "Total number of MQTT messages received", "counter")
+		fmt.Fprintf(&b, "icebreaker_stream_messages_total %d\n", atomic.LoadUint64(&e.streamMessages))
+
+		writeMetricHeader(&b, "icebreaker_stream_last_update_timestamp_seconds", "Unix timestamp of the last location received from the MQTT stream", "gauge")
+		fmt.Fprintf(&b, "icebreaker_stream_last_update_timestamp_seconds %d\n", e.streamLastUpdate.Load())
+	}
+
+	if e.nmeaEnabled() {
+		writeMetricHeader(&b, "icebreaker_nmea_reports_total", "Total number of AIS reports decoded from local NMEA sources", "counter")
+		fmt.Fprintf(&b, "icebreaker_nmea_reports_total %d\n", atomic.LoadUint64(&e.nmeaReports))
+
+		writeMetricHeader(&b, "icebreaker_nmea_decode_errors_total", "Total number of NMEA sentences that failed to decode", "counter")
+		fmt.Fprintf(&b, "icebreaker_nmea_decode_errors_total %d\n", atomic.LoadUint64(&e.nmeaErrors))
+	}
+
 	writeMetricHeader(&b, "icebreaker_latitude_degrees", "Current latitude of a Nordic icebreaker", "gauge")
 	writeMetricHeader(&b, "icebreaker_longitude_degrees", "Current longitude of a Nordic icebreaker", "gauge")
 	writeMetricHeader(&b, "icebreaker_last_report_timestamp_seconds", "Unix timestamp of the vessel position report", "gauge")
@@ -88,10 +240,28 @@ func (e *Exporter) MetricsHandler(w http.ResponseWriter, _ *http.Request) {
 	writeMetricHeader(&b, "icebreaker_course_over_ground_degrees", "Course over ground in degrees", "gauge")
 	writeMetricHeader(&b, "icebreaker_heading_degrees", "True heading in degrees", "gauge")
 	writeMetricHeader(&b, "icebreaker_navigation_status", "AIS navigation status code", "gauge")
+	writeMetricHeader(&b, "icebreaker_navigation_state", "AIS navigation status of the vessel, 1 for the current state", "gauge")
+	writeMetricHeader(&b, "icebreaker_navigation_state_seconds_total", "Seconds the vessel spent in each navigation status since the exporter started", "counter")
+	writeMetricHeader(&b, "icebreaker_navigation_state_changes_total", "Number of times the vessel changed into each navigation status", "counter")
 	writeMetricHeader(&b, "icebreaker_rate_of_turn_degrees_per_minute", "Rate of turn in degrees per minute", "gauge")
-
-	for _, pos := range s.Positions {
-		labels := fmt.Sprintf(`vessel_name="%s",mmsi="%s",country="%s"`, EscapeLabel(pos.Name), EscapeLabel(pos.MMSI), EscapeLabel(pos.Country))
+	writeMetricHeader(&b, "icebreaker_vessel_info", "AIS static and voyage data of the vessel", "gauge")
+	writeMetricHeader(&b, "icebreaker_draught_meters", "Reported draught in metres", "gauge")
+	writeMetricHeader(&b, "icebreaker_length_meters", "Overall length in metres from the AIS reference point dimensions", "gauge")
+	writeMetricHeader(&b, "icebreaker_beam_meters", "Beam in metres from the AIS reference point dimensions", "gauge")
+	writeMetricHeader(&b, "icebreaker_eta_timestamp_seconds", "Unix timestamp of the reported estimated time of arrival", "gauge")
+	writeMetricHeader(&b, "icebreaker_sea_area_info", "Baltic Sea area the vessel is in", "gauge")
+	writeMetricHeader(&b, "icebreaker_distance_travelled_nautical_miles_total", "Distance travelled since the exporter started, from successive position reports", "counter")
+	writeMetricHeader(&b, "icebreaker_derived_speed_knots", "Speed between the two latest position reports", "gauge")
+	writeMetricHeader(&b, "icebreaker_sog_discrepancy_knots", "Absolute difference between the derived and the reported speed over ground", "gauge")
+	writeMetricHeader(&b, "icebreaker_position_jumps_total", "Position reports of the vessel that failed the speed plausibility check", "counter")
+	writeMetricHeader(&b, "icebreaker_position_implausible", "Whether the latest position report of the vessel failed a plausibility check, by reason", "gauge")
+	writeMetricHeader(&b, "icebreaker_nearest_port_distance_nautical_miles", "Great-circle distance to the nearest port in nautical miles", "gauge")
+	writeMetricHeader(&b, "icebreaker_nearest_port_info", "Nearest port of the vessel", "gauge")
+	writeMetricHeader(&b, "icebreaker_nearest_icebreaker_distance_nautical_miles", "Distance to the nearest other tracked icebreaker in nautical miles", "gauge")
+	writeMetricHeader(&b, "icebreaker_nearest_icebreaker_info", "Nearest other tracked icebreaker of the vessel", "gauge")
+
+	for i, pos := range s.Positions {
+		labels := vesselLabels(cfg.Targets, pos)
 
 		fmt.Fprintf(&b, "icebreaker_latitude_degrees{%s} %.6f\n", labels, pos.Latitude)
 		fmt.Fprintf(&b, "icebreaker_longitude_degrees{%s} %.6f\n", labels, pos.Longitude)
@@ -100,18 +270,178 @@ func (e *Exporter) MetricsHandler(w http.ResponseWriter, _ *http.Request) {
 			fmt.Fprintf(&b, "icebreaker_report_age_seconds{%s} %.0f\n", labels, math.Max(0, now-float64(pos.Timestamp)))
 		}
 
-		// Export AIS movement metrics
-		fmt.Fprintf(&b, "icebreaker_speed_over_ground_knots{%s} %.2f\n", labels, pos.SpeedOverGround)
-		fmt.Fprintf(&b, "icebreaker_course_over_ground_degrees{%s} %.1f\n", labels, pos.CourseOverGround)
-		fmt.Fprintf(&b, "icebreaker_heading_degrees{%s} %.1f\n", labels, pos.Heading)
-		fmt.Fprintf(&b, "icebreaker_navigation_status{%s} %d\n", labels, pos.NavigationStatus)
-		fmt.Fprintf(&b, "icebreaker_rate_of_turn_degrees_per_minute{%s} %.1f\n", labels, pos.RateOfTurn)
+		// Export AIS movement metrics, omitting series the vessel did not report
+		if pos.SpeedOverGround != nil {
+			fmt.Fprintf(&b, "icebreaker_speed_over_ground_knots{%s} %.2f\n", labels, *pos.SpeedOverGround)
+		}
+		if pos.CourseOverGround != nil {
+			fmt.Fprintf(&b, "icebreaker_course_over_ground_degrees{%s} %.1f\n", labels, *pos.CourseOverGround)
+		}
+		if pos.Heading != nil {
+			fmt.Fprintf(&b, "icebreaker_heading_degrees{%s} %.1f\n", labels, *pos.Heading)
+		}
+		if pos.NavigationStatus != nil {
+			fmt.Fprintf(&b, "icebreaker_navigation_status{%s} %d\n", labels, *pos.NavigationStatus)
+			for code, state := range ais.NavigationStates {
+				value := 0
+				if code == *pos.NavigationStatus {
+					value = 1
+				}
+				fmt.Fprintf(&b, "icebreaker_navigation_state{%s,state=\"%s\"} %d\n", labels, state, value)
+			}
+		}
+		if n, ok := e.navstate.state(pos.MMSI); ok {
+			for code, state := range ais.NavigationStates {
+				fmt.Fprintf(&b, "icebreaker_navigation_state_seconds_total{%s,state=\"%s\"} %d\n", labels, state, n.seconds[code])
+				fmt.Fprintf(&b, "icebreaker_navigation_state_changes_total{%s,state=\"%s\"} %d\n", labels, state, n.changes[code])
+			}
+		}
+		if pos.RateOfTurn != nil {
+			fmt.Fprintf(&b, "icebreaker_rate_of_turn_degrees_per_minute{%s} %.1f\n", labels, *pos.RateOfTurn)
+		}
+
+		// Static and voyage data; zero means the vessel did not report it
+		imo := ""
+		if pos.IMO != 0 {
+			imo = strconv.Itoa(pos.IMO)
+		}
+		shipType := ""
+		if pos.ShipType != 0 {
+			shipType = strconv.Itoa(pos.ShipType)
+		}
+		country, _ := ais.CountryOf(pos.MMSI)
+		fmt.Fprintf(&b, "icebreaker_vessel_info{%s,country_name=\"%s\",imo=\"%s\",callsign=\"%s\",ship_type=\"%s\",destination=\"%s\"} 1\n",
+			labels, EscapeLabel(country.Name), imo, EscapeLabel(pos.CallSign), shipType, EscapeLabel(pos.Destination))
+		if pos.Draught > 0 {
+			fmt.Fprintf(&b, "icebreaker_draught_meters{%s} %.1f\n", labels, pos.Draught)
+		}
+		if pos.Length > 0 {
+			fmt.Fprintf(&b, "icebreaker_length_meters{%s} %.0f\n", labels, pos.Length)
+		}
+		if pos.Beam > 0 {
+			fmt.Fprintf(&b, "icebreaker_beam_meters{%s} %.0f\n", labels, pos.Beam)
+		}
+		if !pos.ETA.IsZero() {
+			fmt.Fprintf(&b, "icebreaker_eta_timestamp_seconds{%s} %d\n", labels, pos.ETA.Unix())
+		}
+		if area := seaarea.Of(pos.Longitude, pos.Latitude); area != "" {
+			fmt.Fprintf(&b, "icebreaker_sea_area_info{%s,sea_area=\"%s\"} 1\n", labels, EscapeLabel(area))
+		}
+		if m, ok := e.motion.state(pos.MMSI); ok {
+			fmt.Fprintf(&b, "icebreaker_distance_travelled_nautical_miles_total{%s} %.3f\n", labels, m.distance/geo.MetersPerNauticalMile)
+			if m.speedValid {
+				fmt.Fprintf(&b, "icebreaker_derived_speed_knots{%s} %.2f\n", labels, m.speed)
+			}
+			if d, ok := sogDiscrepancy(m, pos); ok {
+				fmt.Fprintf(&b, "icebreaker_sog_discrepancy_knots{%s} %.2f\n", labels, d)
+			}
+		}
+		implausible, jumps := e.checks.vessel(pos.MMSI)
+		fmt.Fprintf(&b, "icebreaker_position_jumps_total{%s} %d\n", labels, jumps)
+		for _, reason := range anomalyReasons {
+			value := 0
+			if reason == implausible {
+				value = 1
+			}
+			fmt.Fprintf(&b, "icebreaker_position_implausible{%s,reason=\"%s\"} %d\n", labels, reason, value)
+		}
+		// The port goes into a separate series, so that the distance series
+		// stays the same when the nearest port changes.
+		nearest, dist := port.Nearest(geo.Point{Lon: pos.Longitude, Lat: pos.Latitude})
+		fmt.Fprintf(&b, "icebreaker_nearest_port_distance_nautical_miles{%s} %.2f\n", labels, dist/geo.MetersPerNauticalMile)
+		fmt.Fprintf(&b, "icebreaker_nearest_port_info{%s,port=\"%s\",locode=\"%s\"} 1\n", labels, EscapeLabel(nearest.Name), nearest.LOCODE)
+		// Likewise for the nearest icebreaker.
+		if j, d := nearestOther(s.Positions, i); j >= 0 {
+			other := s.Positions[j]
+			fmt.Fprintf(&b, "icebreaker_nearest_icebreaker_distance_nautical_miles{%s} %.2f\n", labels, d)
+			fmt.Fprintf(&b, "icebreaker_nearest_icebreaker_info{%s,nearest_mmsi=\"%s\",nearest=\"%s\"} 1\n", labels, other.MMSI, EscapeLabel(other.Name))
+		}
+	}
+
+	if cfg.PairDistances {
+		pairs := len(s.Positions) * (len(s.Positions) - 1) / 2
+		exceeded := 0
+		if pairs > cfg.MaxPairs {
+			exceeded = 1
+		}
+		writeMetricHeader(&b, "icebreaker_pair_distance_limit_exceeded", "Whether the icebreaker pairs exceed -metrics.max-pairs, omitting the pair distances", "gauge")
+		fmt.Fprintf(&b, "icebreaker_pair_distance_limit_exceeded %d\n", exceeded)
+		if exceeded == 0 {
+			writeMetricHeader(&b, "icebreaker_pair_distance_nautical_miles", "Distance between two tracked icebreakers in nautical miles", "gauge")
+			for i, pos := range s.Positions {
+				for _, other := range s.Positions[i+1:] {
+					// Keep the series of a pair when the order of the positions changes.
+					from, to := pos, other
+					if from.MMSI > to.MMSI {
+						from, to = to, from
+					}
+					fmt.Fprintf(&b, "icebreaker_pair_distance_nautical_miles{from_mmsi=\"%s\",to_mmsi=\"%s\",from=\"%s\",to=\"%s\"} %.2f\n",
+						from.MMSI, to.MMSI, EscapeLabel(from.Name), EscapeLabel(to.Name), pairDistance(from, to))
+				}
+			}
+		}
+	}
+
+	if len(cfg.Zones) > 0 {
+		writeMetricHeader(&b, "icebreaker_in_zone", "Whether the vessel is inside the zone", "gauge")
+		writeMetricHeader(&b, "icebreaker_zone_entries_total", "Total number of times the vessel entered the zone", "counter")
+		writeMetricHeader(&b, "icebreaker_zone_dwell_seconds", "Seconds since the vessel entered the zone it is in", "gauge")
+		for _, pos := range s.Positions {
+			labels := vesselLabels(cfg.Targets, pos)
+			for _, zone := range cfg.Zones {
+				inside, entered, entries := e.zones.state(zone.Name, pos.MMSI)
+				zoneLabels := fmt.Sprintf(`zone="%s",%s`, EscapeLabel(zone.Name), labels)
+				in := 0
+				if inside {
+					in = 1
+				}
+				fmt.Fprintf(&b, "icebreaker_in_zone{%s} %d\n", zoneLabels, in)
+				fmt.Fprintf(&b, "icebreaker_zone_entries_total{%s} %d\n", zoneLabels, entries)
+				if inside {
+					fmt.Fprintf(&b, "icebreaker_zone_dwell_seconds{%s} %.0f\n", zoneLabels, math.Max(0, now-float64(entered)))
+				}
+			}
+		}
+	}
+
+	if cfg.AssistEnabled {
+		writeMetricHeader(&b, "icebreaker_traffic_vessels", "Number of other vessels with a recent location kept for assist detection", "gauge")
+		fmt.Fprintf(&b, "icebreaker_traffic_vessels %d\n", e.traffic.len())
+
+		writeMetricHeader(&b, "icebreaker_assisted_vessels", "Number of merchant vessels the icebreaker is assisting", "gauge")
+		assisted := e.assists.counts()
+		for _, pos := range s.Positions {
+			fmt.Fprintf(&b, "icebreaker_assisted_vessels{%s} %d\n", vesselLabels(cfg.Targets, pos), assisted[pos.MMSI])
+		}
 	}
 
 	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
 	_, _ = io.WriteString(w, b.String())
 }
 
+// vesselLabels returns the label set of the per-vessel series: the AIS
+// identity plus the operator, fleet and custom labels of the matching vessel
+// definition.
+func vesselLabels(targets *config.Targets, pos models.IcebreakerPosition) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `vessel_name="%s",mmsi="%s",country="%s"`, EscapeLabel(pos.Name), EscapeLabel(pos.MMSI), EscapeLabel(pos.Country))
+
+	def, ok := targets.Match(pos.MMSI, pos.Name, pos.IMO)
+	if !ok {
+		return b.String()
+	}
+	if def.Operator != "" {
+		fmt.Fprintf(&b, `,operator="%s"`, EscapeLabel(def.Operator))
+	}
+	if def.Fleet != "" {
+		fmt.Fprintf(&b, `,fleet="%s"`, EscapeLabel(def.Fleet))
+	}
+	for _, name := range slices.Sorted(maps.Keys(def.Labels)) {
+		fmt.Fprintf(&b, `,%s="%s"`, name, EscapeLabel(def.Labels[name]))
+	}
+	return b.String()
+}
+
 func writeMetricHeader(b *strings.Builder, metric, help, metricType string) {
 	fmt.Fprintf(b, "# HELP %s %s\n", metric, help)
 	fmt.Fprintf(b, "# TYPE %s %s\n", metric, metricType)
@@ -124,16 +454,21 @@ func EscapeLabel(value string) string {
 	return value
 }
 
+// RefreshLoop refreshes the snapshot every RefreshInterval. After a config
+// reload it refreshes immediately and continues at the new interval.
 func (e *Exporter) RefreshLoop(ctx context.Context) {
 	e.Refresh(ctx)
 
-	ticker := time.NewTicker(e.cfg.RefreshInterval)
+	ticker := time.NewTicker(e.currentConfig().RefreshInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-e.reloaded:
+			ticker.Reset(e.currentConfig().RefreshInterval)
+			e.Refresh(ctx)
 		case <-ticker.C:
 			e.Refresh(ctx)
 		}
@@ -141,27 +476,71 @@ func (e *Exporter) RefreshLoop(ctx context.Context) {
 }
 
 func (e *Exporter) Refresh(ctx context.Context) {
+	api := e.client()
 	start := time.Now()
-	positions, err := fetchPositions(ctx, e.client, e.cfg)
+	bytesBefore, recordsBefore := api.Transferred()
+	retriesBefore := api.Retries()
+	positions, err := e.fetchPositions(ctx, api, e.currentConfig())
 	duration := time.Since(start)
+	bytesAfter, recordsAfter := api.Transferred()
+	e.transferredBytes.Add(bytesAfter - bytesBefore)
+	e.retries.Add(api.Retries() - retriesBefore)
 
 	e.mu.Lock()
-	defer e.mu.Unlock()
-
+	previous := e.snapshot.Positions
 	s := models.Snapshot{
 		LastRefresh:     time.Now(),
 		RefreshDuration: duration,
+		RefreshBytes:    bytesAfter - bytesBefore,
+		RefreshRecords:  recordsAfter - recordsBefore,
 	}
 	if err != nil {
 		slog.Error("refresh failed", "error", err)
 		s.Positions = e.snapshot.Positions
 		s.LastRefreshError = err.Error()
 	} else {
+		positions = keepNewer(previous, positions)
 		s.Positions = positions
+		e.history.Record(plausible(positions))
 		slog.Info("refreshed icebreaker positions", "count", len(positions), "durationMs", duration.Milliseconds())
 	}
 
 	e.snapshot = s
+	e.mu.Unlock()
+
+	if err == nil {
+		e.publishChanges(previous, positions)
+		e.zones.retain(e.currentConfig().Zones, positions)
+		e.motion.retain(positions)
+		e.navstate.retain(positions)
+		e.checks.retain(positions)
+		for _, pos := range plausible(positions) {
+			e.motion.observe(pos, e.checks.reanchored(pos))
+			e.navstate.observe(pos)
+		}
+		e.updateZones(plausible(positions))
+		e.updateAssists(positions)
+	}
+	e.persistRefresh(s)
+}
+
+// keepNewer keeps the location of a vessel from previous where it is newer
+// than the refreshed one, e.g. when it was streamed after the REST payload
+// was generated. The vessel data is taken from the refresh.
+func keepNewer(previous, positions []models.IcebreakerPosition) []models.IcebreakerPosition {
+	before := make(map[string]models.IcebreakerPosition, len(previous))
+	for _, pos := range previous {
+		before[pos.MMSI] = pos
+	}
+	for i, pos := range positions {
+		old, ok := before[pos.MMSI]
+		if !ok || old.Timestamp <= pos.Timestamp {
+			continue
+		}
+		old.Name, old.Country, old.StaticData = pos.Name, pos.Country, pos.StaticData
+		positions[i] = old
+	}
+	return positions
 }
 
 func (e *Exporter) GetSnapshot() models.Snapshot {
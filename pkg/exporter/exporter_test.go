@@ -1,6 +1,7 @@
 package exporter
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -12,20 +13,42 @@ import (
 )
 
 func TestRootHandler(t *testing.T) {
-	exp := New(config.Config{MetricsPath: "/metrics"})
-
-	req := httptest.NewRequest(http.MethodGet, "/", nil)
-	rr := httptest.NewRecorder()
-
+	exp := New(config.Config{MetricsPath: "/metrics", WebTileURL: "https://tiles.example.org/{z}/{x}/{y}.png"})
 	handler := exp.RootHandler()
-	handler.ServeHTTP(rr, req)
 
+	get := func(path string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		return rr
+	}
+
+	rr := get("/")
 	if status := rr.Code; status != http.StatusOK {
 		t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
 	}
+	body := rr.Body.String()
+	for _, want := range []string{`href="metrics"`, `data-tiles="https://tiles.example.org/{z}/{x}/{y}.png"`, `src="app.js"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page does not contain %s: %v", want, body)
+		}
+	}
+	if strings.Contains(body, "{{") {
+		t.Errorf("page was not rendered: %v", body)
+	}
 
-	if !strings.Contains(rr.Body.String(), "/metrics") {
-		t.Errorf("handler returned unexpected body: %v", rr.Body.String())
+	for _, path := range []string{"/app.js", "/style.css", "/coastline.geojson"} {
+		if rr := get(path); rr.Code != http.StatusOK || rr.Body.Len() == 0 {
+			t.Errorf("%s: got %d", path, rr.Code)
+		}
+	}
+	if rr := get("/nope"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown path, got %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for POST, got %d", rr.Code)
 	}
 }
 
@@ -76,11 +99,30 @@ func TestMetricsHandler(t *testing.T) {
 				Latitude:         60.1,
 				Longitude:        24.9,
 				Timestamp:        time.Now().Unix(),
-				SpeedOverGround:  5.2,
-				CourseOverGround: 45.0,
-				Heading:          47,
-				NavigationStatus: 0,
-				RateOfTurn:       2.5,
+				SpeedOverGround:  ptr(5.2),
+				CourseOverGround: ptr(45.0),
+				Heading:          ptr(47.0),
+				NavigationStatus: ptr(0),
+				RateOfTurn:       ptr(2.5),
+				StaticData: models.StaticData{
+					IMO:         8914428,
+					CallSign:    "OHMN",
+					ShipType:    52,
+					Destination: "KEMI",
+					ETA:         time.Unix(1700000000, 0),
+					Draught:     8,
+					Length:      99,
+					Beam:        24,
+				},
+			},
+			{
+				Name:      "KONTIO",
+				MMSI:      "230123000",
+				Country:   "FI",
+				Latitude:  61.1,
+				Longitude: 21.2,
+				Timestamp: time.Now().Unix(),
+				// No movement data reported at all.
 			},
 		},
 	}
@@ -118,4 +160,103 @@ func TestMetricsHandler(t *testing.T) {
 	if !strings.Contains(body, `icebreaker_rate_of_turn_degrees_per_minute{vessel_name="OTSO",mmsi="123456",country="FI"} 2.5`) {
 		t.Errorf("missing or incorrect ROT metric:\n%s", body)
 	}
+
+	// Unavailable values are omitted rather than exported as zero
+	for _, want := range []string{
+		`icebreaker_vessel_info{vessel_name="OTSO",mmsi="123456",country="FI",country_name="",imo="8914428",callsign="OHMN",ship_type="52",destination="KEMI"} 1`,
+		`icebreaker_draught_meters{vessel_name="OTSO",mmsi="123456",country="FI"} 8.0`,
+		`icebreaker_length_meters{vessel_name="OTSO",mmsi="123456",country="FI"} 99`,
+		`icebreaker_beam_meters{vessel_name="OTSO",mmsi="123456",country="FI"} 24`,
+		`icebreaker_eta_timestamp_seconds{vessel_name="OTSO",mmsi="123456",country="FI"} 1700000000`,
+		`icebreaker_vessel_info{vessel_name="KONTIO",mmsi="230123000",country="FI",country_name="Finland",imo="",callsign="",ship_type="",destination=""} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in output:\n%s", want, body)
+		}
+	}
+	if !strings.Contains(body, `icebreaker_latitude_degrees{vessel_name="KONTIO",mmsi="230123000",country="FI"} 61.1`) {
+		t.Errorf("missing latitude for vessel without movement data:\n%s", body)
+	}
+	for _, metric := range []string{
+		"icebreaker_speed_over_ground_knots",
+		"icebreaker_course_over_ground_degrees",
+		"icebreaker_heading_degrees",
+		"icebreaker_navigation_status",
+		"icebreaker_rate_of_turn_degrees_per_minute",
+		"icebreaker_draught_meters",
+		"icebreaker_eta_timestamp_seconds",
+	} {
+		if strings.Contains(body, metric+`{vessel_name="KONTIO"`) {
+			t.Errorf("unexpected %s series for vessel without movement data:\n%s", metric, body)
+		}
+	}
+}
+
+func TestMetricsHandlerCircuitBreaker(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	exp := New(config.Config{
+		VesselsURL:       srv.URL + "/vessels",
+		LocationsURL:     srv.URL + "/locations",
+		RequestTimeout:   time.Second,
+		Targets:          config.NewTargets(config.ParseVesselNames("OTSO")),
+		RetryMaxAttempts: 2,
+		RetryBaseDelay:   time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	})
+	exp.Refresh(context.Background())
+
+	rr := httptest.NewRecorder()
+	exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+	for _, want := range []string{
+		"icebreaker_up 0",
+		"icebreaker_digitraffic_retries_total 1",
+		`icebreaker_digitraffic_circuit_breaker_state{state="open"} 1`,
+		`icebreaker_digitraffic_circuit_breaker_state{state="closed"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in output:\n%s", want, body)
+		}
+	}
+}
+
+func TestMetricsHandlerVesselLabels(t *testing.T) {
+	exp := New(config.Config{
+		Targets: config.NewTargets([]config.Vessel{
+			{Name: "OTSO", MMSI: "230252000", Operator: "Arctia", Fleet: "finnish", Labels: map[string]string{"region": "bothnian_bay", "class": "polar"}},
+			{Name: "YMER"},
+		}),
+	})
+	exp.snapshot = models.Snapshot{
+		LastRefresh: time.Now(),
+		Positions: []models.IcebreakerPosition{
+			{Name: "OTSO", MMSI: "230252000", Country: "FI", Latitude: 65.0, Longitude: 25.2},
+			{Name: "YMER", MMSI: "265547250", Country: "SE", Latitude: 65.5, Longitude: 22.1},
+		},
+	}
+
+	rr := httptest.NewRecorder()
+	exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+	for _, want := range []string{
+		`icebreaker_latitude_degrees{vessel_name="OTSO",mmsi="230252000",country="FI",operator="Arctia",fleet="finnish",class="polar",region="bothnian_bay"} 65.000000`,
+		`icebreaker_vessel_info{vessel_name="OTSO",mmsi="230252000",country="FI",operator="Arctia",fleet="finnish",class="polar",region="bothnian_bay",country_name=`,
+		`icebreaker_latitude_degrees{vessel_name="YMER",mmsi="265547250",country="SE"} 65.500000`,
+		`icebreaker_sea_area_info{vessel_name="OTSO",mmsi="230252000",country="FI",operator="Arctia",fleet="finnish",class="polar",region="bothnian_bay",sea_area="Bay of Bothnia"} 1`,
+		`icebreaker_nearest_port_distance_nautical_miles{vessel_name="YMER",mmsi="265547250",country="SE"} `,
+		`icebreaker_nearest_port_info{vessel_name="YMER",mmsi="265547250",country="SE",port="Luleå",locode="SELLA"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in output:\n%s", want, body)
+		}
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
 }
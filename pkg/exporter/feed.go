@@ -0,0 +1,280 @@
+package exporter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+	"github.com/joluc/icebreaker-exporter/pkg/websocket"
+)
+
+const (
+	// feedBacklog events are kept for clients resuming with Last-Event-ID.
+	feedBacklog = 256
+	// feedClientBuffer bounds the events queued for one client. A client
+	// that falls further behind misses events; they are counted as dropped.
+	feedClientBuffer = 64
+	feedKeepAlive    = 30 * time.Second
+	feedWriteTimeout = 10 * time.Second
+)
+
+// Feed event types. A snapshot event carries all current vessels and starts
+// every stream that cannot be resumed; position events carry one vessel.
+const (
+	feedSnapshot = "snapshot"
+	feedPosition = "position"
+)
+
+type feedEvent struct {
+	ID   uint64
+	Type string
+	Data json.RawMessage
+}
+
+// feed fans position changes out to the clients of StreamHandler.
+type feed struct {
+	mu      sync.Mutex
+	lastID  uint64
+	backlog []feedEvent
+	clients map[*feedClient]struct{}
+
+	published atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+type feedClient struct {
+	events  chan feedEvent
+	dropped atomic.Uint64
+}
+
+func newFeed() *feed {
+	return &feed{clients: map[*feedClient]struct{}{}}
+}
+
+// publish queues an event for every client without blocking.
+func (f *feed) publish(eventType string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lastID++
+	ev := feedEvent{ID: f.lastID, Type: eventType, Data: data}
+	if len(f.backlog) == feedBacklog {
+		copy(f.backlog, f.backlog[1:])
+		f.backlog = f.backlog[:feedBacklog-1]
+	}
+	f.backlog = append(f.backlog, ev)
+	f.published.Add(1)
+
+	for c := range f.clients {
+		select {
+		case c.events <- ev:
+		default:
+			c.dropped.Add(1)
+			f.dropped.Add(1)
+		}
+	}
+}
+
+// subscribe registers a client. When resume is set and every event after
+// lastID is still in the backlog, those events are returned to be replayed.
+// Otherwise resumed is false and the client starts from a snapshot as of
+// event id.
+func (f *feed) subscribe(lastID uint64, resume bool) (c *feedClient, replay []feedEvent, id uint64, resumed bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c = &feedClient{events: make(chan feedEvent, feedClientBuffer)}
+	f.clients[c] = struct{}{}
+
+	if resume && lastID <= f.lastID && (lastID == f.lastID || (len(f.backlog) > 0 && f.backlog[0].ID <= lastID+1)) {
+		for _, ev := range f.backlog {
+			if ev.ID > lastID {
+				replay = append(replay, ev)
+			}
+		}
+		return c, replay, f.lastID, true
+	}
+	return c, nil, f.lastID, false
+}
+
+func (f *feed) unsubscribe(c *feedClient) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.clients, c)
+}
+
+func (f *feed) clientCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.clients)
+}
+
+// publishChanges emits a position event for every vessel whose position,
+// navigation status or report timestamp changed.
+func (e *Exporter) publishChanges(previous, current []models.IcebreakerPosition) {
+	before := make(map[string]models.IcebreakerPosition, len(previous))
+	for _, pos := range previous {
+		before[pos.MMSI] = pos
+	}
+	targets := e.currentConfig().Targets
+	now := time.Now()
+	for _, pos := range current {
+		if old, ok := before[pos.MMSI]; ok && !positionChanged(old, pos) {
+			continue
+		}
+		e.feed.publish(feedPosition, newAPIVessel(pos, targets, now))
+	}
+}
+
+func positionChanged(a, b models.IcebreakerPosition) bool {
+	if a.Latitude != b.Latitude || a.Longitude != b.Longitude || a.Timestamp != b.Timestamp {
+		return true
+	}
+	if (a.NavigationStatus == nil) != (b.NavigationStatus == nil) {
+		return true
+	}
+	return a.NavigationStatus != nil && *a.NavigationStatus != *b.NavigationStatus
+}
+
+// StreamHandler pushes position changes as Server-Sent Events or, for
+// WebSocket upgrade requests, as WebSocket text messages. Streams start with
+// a snapshot event unless the client resumes with Last-Event-ID (SSE
+// header) or the last_event_id query parameter and the missed events are
+// still buffered.
+func (e *Exporter) StreamHandler(w http.ResponseWriter, r *http.Request) {
+	value := r.Header.Get("Last-Event-ID")
+	if value == "" {
+		value = r.URL.Query().Get("last_event_id")
+	}
+	lastID, err := strconv.ParseUint(value, 10, 64)
+	resume := value != "" && err == nil
+
+	if r.Header.Get("Upgrade") != "" {
+		e.serveWebSocketFeed(w, r, lastID, resume)
+		return
+	}
+	e.serveSSEFeed(w, r, lastID, resume)
+}
+
+func (e *Exporter) serveSSEFeed(w http.ResponseWriter, r *http.Request, lastID uint64, resume bool) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	write := func(s string) error {
+		_ = rc.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+		if _, err := fmt.Fprint(w, s); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+	send := func(ev feedEvent) error {
+		return write(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data))
+	}
+	keepAlive := func() error { return write(": keepalive\n\n") }
+
+	e.runFeed(r.Context(), lastID, resume, send, keepAlive)
+}
+
+// wsFeedMessage is the WebSocket framing of a feed event.
+type wsFeedMessage struct {
+	ID    uint64          `json:"id"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+func (e *Exporter) serveWebSocketFeed(w http.ResponseWriter, r *http.Request, lastID uint64, resume bool) {
+	conn, err := websocket.Upgrade(w, r, "")
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Reads only detect the client going away.
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	send := func(ev feedEvent) error {
+		msg, err := json.Marshal(wsFeedMessage{ID: ev.ID, Event: ev.Type, Data: ev.Data})
+		if err != nil {
+			return err
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+		return conn.WriteMessage(websocket.OpText, msg)
+	}
+	keepAlive := func() error {
+		_ = conn.SetWriteDeadline(time.Now().Add(feedWriteTimeout))
+		return conn.WriteMessage(websocket.OpPing, nil)
+	}
+
+	e.runFeed(ctx, lastID, resume, send, keepAlive)
+}
+
+// runFeed sends feed events to one client until ctx is done or a write
+// fails.
+func (e *Exporter) runFeed(ctx context.Context, lastID uint64, resume bool, send func(feedEvent) error, keepAlive func() error) {
+	client, replay, id, resumed := e.feed.subscribe(lastID, resume)
+	defer func() {
+		e.feed.unsubscribe(client)
+		if n := client.dropped.Load(); n > 0 {
+			slog.Warn("live feed client fell behind", "dropped_events", n)
+		}
+	}()
+
+	if !resumed {
+		s := e.GetSnapshot()
+		targets := e.currentConfig().Targets
+		now := time.Now()
+		vessels := make([]apiVessel, 0, len(s.Positions))
+		for _, pos := range s.Positions {
+			vessels = append(vessels, newAPIVessel(pos, targets, now))
+		}
+		data, err := json.Marshal(apiVessels{Status: newAPIStatus(s), Count: len(vessels), Vessels: vessels})
+		if err != nil || send(feedEvent{ID: id, Type: feedSnapshot, Data: data}) != nil {
+			return
+		}
+	}
+	for _, ev := range replay {
+		if send(ev) != nil {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(feedKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case ev := <-client.events:
+			if send(ev) != nil {
+				return
+			}
+		case <-ticker.C:
+			if keepAlive() != nil {
+				return
+			}
+		}
+	}
+}
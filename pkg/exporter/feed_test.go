@@ -0,0 +1,180 @@
+package exporter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+	"github.com/joluc/icebreaker-exporter/pkg/websocket"
+)
+
+func newFeedTestExporter() *Exporter {
+	exp := New(config.Config{Targets: config.NewTargets([]config.Vessel{{Name: "OTSO"}})})
+	exp.snapshot = models.Snapshot{
+		LastRefresh: time.Now(),
+		Positions:   []models.IcebreakerPosition{{Name: "OTSO", MMSI: "230252000", Country: "FI", Latitude: 65.0, Longitude: 25.0, Timestamp: 100}},
+	}
+	return exp
+}
+
+type sseEvent struct {
+	id, event, data string
+}
+
+func readSSEEvent(t *testing.T, r *bufio.Reader) sseEvent {
+	t.Helper()
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("reading event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if ev.event != "" {
+				return ev
+			}
+		case strings.HasPrefix(line, "id: "):
+			ev.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			ev.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestStreamHandlerSSE(t *testing.T) {
+	exp := newFeedTestExporter()
+	srv := httptest.NewServer(http.HandlerFunc(exp.StreamHandler))
+	defer srv.Close()
+
+	connect := func(lastEventID string) (*bufio.Reader, func()) {
+		ctx, cancel := context.WithCancel(context.Background())
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Header.Get("Content-Type") != "text/event-stream" {
+			t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+		}
+		return bufio.NewReader(resp.Body), func() { cancel(); resp.Body.Close() }
+	}
+
+	r, disconnect := connect("")
+	ev := readSSEEvent(t, r)
+	var snapshot struct {
+		Count   int
+		Vessels []struct {
+			MMSI string `json:"mmsi"`
+		}
+	}
+	if err := json.Unmarshal([]byte(ev.data), &snapshot); err != nil || ev.event != "snapshot" || ev.id != "0" {
+		t.Fatalf("expected snapshot event 0, got %+v (%v)", ev, err)
+	}
+	if snapshot.Count != 1 || snapshot.Vessels[0].MMSI != "230252000" {
+		t.Fatalf("unexpected snapshot %s", ev.data)
+	}
+
+	waitFor(t, "subscription", func() bool { return exp.feed.clientCount() == 1 })
+	exp.applyLiveLocation(models.LocationRecord{MMSI: "230252000", Latitude: 65.1, Longitude: 25.0, Timestamp: 160})
+	exp.applyLiveLocation(models.LocationRecord{MMSI: "230252000", Latitude: 65.1, Longitude: 25.0, Timestamp: 160})
+	exp.applyLiveLocation(models.LocationRecord{MMSI: "230252000", Latitude: 65.2, Longitude: 25.0, Timestamp: 220})
+
+	ev = readSSEEvent(t, r)
+	if ev.event != "position" || ev.id != "1" || !strings.Contains(ev.data, `"latitude":65.1`) {
+		t.Fatalf("unexpected position event %+v", ev)
+	}
+	disconnect()
+
+	// Resuming replays the missed event instead of sending a snapshot; the
+	// unchanged duplicate report was not published.
+	r, disconnect = connect("1")
+	defer disconnect()
+	ev = readSSEEvent(t, r)
+	if ev.event != "position" || ev.id != "2" || !strings.Contains(ev.data, `"latitude":65.2`) {
+		t.Fatalf("expected replay of event 2, got %+v", ev)
+	}
+}
+
+func TestStreamHandlerWebSocket(t *testing.T) {
+	exp := newFeedTestExporter()
+	srv := httptest.NewServer(http.HandlerFunc(exp.StreamHandler))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	read := func() wsFeedMessage {
+		t.Helper()
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		op, data, err := conn.ReadMessage()
+		if err != nil || op != websocket.OpText {
+			t.Fatalf("reading message: op %d, %v", op, err)
+		}
+		var msg wsFeedMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		return msg
+	}
+
+	if msg := read(); msg.Event != "snapshot" {
+		t.Fatalf("expected snapshot first, got %+v", msg)
+	}
+	waitFor(t, "subscription", func() bool { return exp.feed.clientCount() == 1 })
+	exp.applyLiveLocation(models.LocationRecord{MMSI: "230252000", Latitude: 65.1, Longitude: 25.0, Timestamp: 160})
+	if msg := read(); msg.Event != "position" || msg.ID != 1 || !strings.Contains(string(msg.Data), `"mmsi":"230252000"`) {
+		t.Fatalf("unexpected message %+v", msg)
+	}
+
+	conn.Close()
+	waitFor(t, "unsubscription", func() bool { return exp.feed.clientCount() == 0 })
+}
+
+func TestFeedBoundsClientsAndBacklog(t *testing.T) {
+	f := newFeed()
+	slow, _, _, _ := f.subscribe(0, false)
+	for i := range feedBacklog + 10 {
+		f.publish(feedPosition, i)
+	}
+
+	if got := slow.dropped.Load(); got != feedBacklog+10-feedClientBuffer {
+		t.Errorf("expected the client to count %d dropped events, got %d", feedBacklog+10-feedClientBuffer, got)
+	}
+	if len(slow.events) != feedClientBuffer {
+		t.Errorf("expected %d queued events, got %d", feedClientBuffer, len(slow.events))
+	}
+	if got, want := f.dropped.Load(), uint64(feedBacklog+10-feedClientBuffer); got != want {
+		t.Errorf("expected %d dropped events, got %d", want, got)
+	}
+
+	// Event 10 fell out of the backlog, so resuming after it needs a snapshot.
+	if _, _, _, resumed := f.subscribe(9, true); resumed {
+		t.Error("expected resume from an evicted event to fail")
+	}
+	_, replay, id, resumed := f.subscribe(10, true)
+	if !resumed || len(replay) != feedBacklog || replay[0].ID != 11 || id != feedBacklog+10 {
+		t.Errorf("unexpected resume: resumed %v, %d events, id %d", resumed, len(replay), id)
+	}
+	if _, _, _, resumed := f.subscribe(feedBacklog+11, true); resumed {
+		t.Error("expected resume from a future event to fail")
+	}
+}
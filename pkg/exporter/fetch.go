@@ -0,0 +1,211 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/digitraffic"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// fetchPositions downloads the Digitraffic payloads and selects the target
+// positions, merging in any records received from local AIS sources. Besides
+// the target locations the fetch strategies return sightings: the
+// coordinates of every vessel in the download, for the cluster check.
+func (e *Exporter) fetchPositions(ctx context.Context, api *digitraffic.Client, cfg config.Config) ([]models.IcebreakerPosition, error) {
+	localVessels, localLocations := e.local.records()
+
+	reqCtx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout)
+	defer cancel()
+
+	var (
+		vessels   []models.VesselMetadata
+		locations []models.LocationRecord
+		sightings []models.LocationRecord
+		err       error
+	)
+	switch {
+	case cfg.Parser == config.ParserHeuristic:
+		vessels, locations, sightings, err = fetchHeuristic(reqCtx, api, cfg)
+	case cfg.FetchStrategy == config.FetchTargeted:
+		vessels, locations, sightings, err = fetchTargeted(reqCtx, api, cfg, e.resolver, localVessels)
+	case cfg.IncrementalRefresh:
+		vessels, locations, sightings, err = fetchIncremental(reqCtx, api, cfg, e.delta, e.traffic, localVessels)
+	default:
+		vessels, locations, sightings, err = fetchTyped(reqCtx, api, cfg, e.traffic, localVessels)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	vessels = append(vessels, localVessels...)
+	sightings = append(sightings, localLocations...)
+	locations = append(locations, localLocations...)
+	tracked := trackedLocation(vessels, cfg.Targets)
+	locations = e.checks.filter(cfg, locations, sightings, tracked)
+	positions := SelectTargetPositions(vessels, locations, cfg.Targets)
+	if cfg.AssistEnabled {
+		e.traffic.update(vessels, locations, tracked, time.Now())
+	} else {
+		e.traffic.reset()
+	}
+
+	if len(positions) == 0 {
+		return nil, errors.New("no positions found for configured icebreakers")
+	}
+
+	return positions, nil
+}
+
+// fetchTyped decodes only the target vessels and their locations using the
+// typed AIS v1 schema.
+func fetchTyped(ctx context.Context, api *digitraffic.Client, cfg config.Config, traffic *traffic, localVessels []models.VesselMetadata) ([]models.VesselMetadata, []models.LocationRecord, []models.LocationRecord, error) {
+	vessels, err := fetchTargetVessels(ctx, api, traffic.vesselFilter(cfg))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	wanted := targetMMSIs(cfg, vessels, localVessels)
+
+	collection, err := api.FetchLocations(ctx, keepLocation(cfg, wanted))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("fetch locations: %w", err)
+	}
+
+	locations := make([]models.LocationRecord, 0, len(collection.Features))
+	for _, f := range collection.Features {
+		locations = append(locations, f.Location())
+	}
+	return vessels, locations, collection.Sightings, nil
+}
+
+// fetchTargeted reuses the cached name to MMSI mapping and requests each
+// target's location individually, with at most cfg.FetchConcurrency requests
+// in flight. The mapping is resolved again when it expires or when a resolved
+// MMSI no longer reports a position. Failed requests are logged and skipped;
+// the refresh fails only when all of them failed. Other vessels are never
+// downloaded, so there are no sightings.
+func fetchTargeted(ctx context.Context, api *digitraffic.Client, cfg config.Config, resolver *mmsiResolver, localVessels []models.VesselMetadata) ([]models.VesselMetadata, []models.LocationRecord, []models.LocationRecord, error) {
+	vessels, ok := resolver.cached(cfg.ResolveInterval, time.Now())
+	if !ok {
+		var err error
+		vessels, err = fetchTargetVessels(ctx, api, isTargetVessel(cfg))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		resolver.store(vessels, time.Now())
+		slog.Info("resolved icebreaker MMSIs", "count", len(vessels))
+	}
+
+	wanted := slices.Sorted(maps.Keys(targetMMSIs(cfg, vessels, localVessels)))
+	features := make([]digitraffic.Feature, len(wanted))
+	found := make([]bool, len(wanted))
+	errs := make([]error, len(wanted))
+
+	sem := make(chan struct{}, max(cfg.FetchConcurrency, 1))
+	var wg sync.WaitGroup
+	for i, mmsi := range wanted {
+		wg.Go(func() {
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			features[i], found[i], errs[i] = api.FetchLocation(ctx, mmsi)
+		})
+	}
+	wg.Wait()
+
+	failed := 0
+	for i, err := range errs {
+		if err != nil {
+			failed++
+			slog.Warn("fetch location failed", "mmsi", wanted[i], "error", err)
+		}
+	}
+	if failed > 0 && failed == len(wanted) {
+		return nil, nil, nil, fmt.Errorf("fetch locations: %w", errors.Join(errs...))
+	}
+
+	locations := make([]models.LocationRecord, 0, len(wanted))
+	for i, f := range features {
+		if errs[i] != nil {
+			continue
+		}
+		if !found[i] {
+			// MMSIs pinned in the vessel definitions are not resolved by name.
+			if slices.ContainsFunc(vessels, func(v models.VesselMetadata) bool { return v.MMSI == wanted[i] }) {
+				slog.Warn("no location for resolved vessel, resolving names again on next refresh", "mmsi", wanted[i])
+				resolver.invalidate()
+			}
+			continue
+		}
+		locations = append(locations, f.Location())
+	}
+	return vessels, locations, nil, nil
+}
+
+// fetchTargetVessels downloads the vessels list and keeps the entries
+// accepted by keep, a filter for the targets.
+func fetchTargetVessels(ctx context.Context, api *digitraffic.Client, keep func(digitraffic.Vessel) bool) ([]models.VesselMetadata, error) {
+	matched, err := api.FetchVessels(ctx, keep)
+	if err != nil {
+		return nil, fmt.Errorf("fetch vessels: %w", err)
+	}
+	return targetMetadata(matched), nil
+}
+
+func isTargetVessel(cfg config.Config) func(digitraffic.Vessel) bool {
+	return func(v digitraffic.Vessel) bool {
+		_, ok := cfg.Targets.Match(strconv.Itoa(v.MMSI), v.Name, v.IMO)
+		return ok
+	}
+}
+
+func targetMetadata(matched []digitraffic.Vessel) []models.VesselMetadata {
+	vessels := make([]models.VesselMetadata, 0, len(matched))
+	for _, v := range matched {
+		vessels = append(vessels, v.Metadata())
+	}
+	return vessels
+}
+
+// targetMMSIs returns the MMSIs of the target vessels, including those only
+// known from local AIS sources and those pinned in the vessel definitions.
+func targetMMSIs(cfg config.Config, vessels, localVessels []models.VesselMetadata) map[string]struct{} {
+	wanted := make(map[string]struct{}, len(vessels)+len(localVessels))
+	for _, v := range vessels {
+		wanted[v.MMSI] = struct{}{}
+	}
+	for _, v := range localVessels {
+		if _, ok := cfg.Targets.Match(v.MMSI, v.Name, v.IMO); ok {
+			wanted[v.MMSI] = struct{}{}
+		}
+	}
+	for _, mmsi := range cfg.Targets.MMSIs() {
+		wanted[mmsi] = struct{}{}
+	}
+	return wanted
+}
+
+// fetchHeuristic walks the raw payloads and guesses fields. It tolerates
+// schema changes at the cost of CPU and precision.
+func fetchHeuristic(ctx context.Context, api *digitraffic.Client, cfg config.Config) ([]models.VesselMetadata, []models.LocationRecord, []models.LocationRecord, error) {
+	vesselsPayload, err := api.FetchGeneric(ctx, cfg.VesselsURL)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("fetch vessels: %w", err)
+	}
+	locationsPayload, err := api.FetchGeneric(ctx, cfg.LocationsURL)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("fetch locations: %w", err)
+	}
+
+	// Every location is a sighting; clipped so that appending to one
+	// leaves the other alone.
+	locations := slices.Clip(ExtractLocations(locationsPayload))
+	return ExtractVesselMetadata(vesselsPayload), locations, locations, nil
+}
@@ -0,0 +1,190 @@
+package exporter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// testAPI serves testVesselsJSON and testLocationsJSON and counts requests.
+type testAPI struct {
+	vesselCalls   atomic.Int64
+	locationCalls atomic.Int64
+
+	mu       sync.Mutex
+	inFlight int
+	peak     int
+	missing  map[string]bool
+	failing  map[string]bool
+}
+
+func newTestAPI(t *testing.T) (*testAPI, config.Config) {
+	t.Helper()
+	api := &testAPI{missing: map[string]bool{}, failing: map[string]bool{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vessels", func(w http.ResponseWriter, _ *http.Request) {
+		api.vesselCalls.Add(1)
+		_, _ = io.WriteString(w, testVesselsJSON)
+	})
+	mux.HandleFunc("/locations", func(w http.ResponseWriter, r *http.Request) {
+		api.locationCalls.Add(1)
+		mmsi := r.URL.Query().Get("mmsi")
+		if mmsi == "" {
+			_, _ = io.WriteString(w, testLocationsJSON)
+			return
+		}
+
+		api.mu.Lock()
+		api.inFlight++
+		api.peak = max(api.peak, api.inFlight)
+		missing, failing := api.missing[mmsi], api.failing[mmsi]
+		api.mu.Unlock()
+		defer func() {
+			api.mu.Lock()
+			api.inFlight--
+			api.mu.Unlock()
+		}()
+		time.Sleep(10 * time.Millisecond)
+
+		switch {
+		case failing:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case missing:
+			http.NotFound(w, r)
+		case mmsi == "230124000":
+			_, _ = io.WriteString(w, testLocationsJSON)
+		default:
+			_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[]}`)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	cfg := config.Config{
+		VesselsURL:       srv.URL + "/vessels",
+		LocationsURL:     srv.URL + "/locations",
+		RequestTimeout:   time.Second,
+		Targets:          config.NewTargets(config.ParseVesselNames("OTSO")),
+		FetchStrategy:    config.FetchFull,
+		FetchConcurrency: 1,
+		ResolveInterval:  time.Hour,
+	}
+	return api, cfg
+}
+
+func TestFetchPositionsParsers(t *testing.T) {
+	for _, parser := range []string{config.ParserTyped, config.ParserHeuristic} {
+		t.Run(parser, func(t *testing.T) {
+			_, cfg := newTestAPI(t)
+			cfg.Parser = parser
+
+			exp := New(cfg)
+			positions, err := exp.fetchPositions(context.Background(), exp.client(), cfg)
+			if err != nil {
+				t.Fatalf("fetchPositions() error = %v", err)
+			}
+			if len(positions) != 1 {
+				t.Fatalf("expected 1 position, got %d", len(positions))
+			}
+			pos := positions[0]
+			if pos.Name != "OTSO" || pos.Country != "FI" || pos.Latitude != 60.1 || pos.Timestamp != 1700000000 {
+				t.Errorf("unexpected position %+v", pos)
+			}
+		})
+	}
+}
+
+func TestFetchPositionsTargeted(t *testing.T) {
+	api, cfg := newTestAPI(t)
+	cfg.Parser = config.ParserTyped
+	cfg.FetchStrategy = config.FetchTargeted
+	exp := New(cfg)
+
+	for i := 0; i < 3; i++ {
+		positions, err := exp.fetchPositions(context.Background(), exp.client(), exp.currentConfig())
+		if err != nil {
+			t.Fatalf("fetchPositions() error = %v", err)
+		}
+		if len(positions) != 1 || positions[0].MMSI != "230124000" || positions[0].Latitude != 60.1 {
+			t.Fatalf("unexpected positions %+v", positions)
+		}
+	}
+	if got := api.vesselCalls.Load(); got != 1 {
+		t.Errorf("expected vessels to be resolved once, got %d calls", got)
+	}
+	if got := api.locationCalls.Load(); got != 3 {
+		t.Errorf("expected 3 per-vessel location calls, got %d", got)
+	}
+
+	// A resolved MMSI that stops reporting triggers a new resolution.
+	api.mu.Lock()
+	api.missing["230124000"] = true
+	api.mu.Unlock()
+	if _, err := exp.fetchPositions(context.Background(), exp.client(), exp.currentConfig()); err == nil {
+		t.Fatal("expected error when no target reports a position")
+	}
+	if _, err := exp.fetchPositions(context.Background(), exp.client(), exp.currentConfig()); err == nil {
+		t.Fatal("expected error when no target reports a position")
+	}
+	if got := api.vesselCalls.Load(); got != 2 {
+		t.Errorf("expected vessels to be resolved again, got %d calls", got)
+	}
+}
+
+func TestFetchPositionsTargetedPartialFailure(t *testing.T) {
+	api, cfg := newTestAPI(t)
+	cfg.Parser = config.ParserTyped
+	cfg.FetchStrategy = config.FetchTargeted
+	exp := New(cfg)
+	exp.local.addVessel(models.VesselMetadata{MMSI: "230000001", Name: "OTSO"})
+
+	api.mu.Lock()
+	api.failing["230000001"] = true
+	api.mu.Unlock()
+	positions, err := exp.fetchPositions(context.Background(), exp.client(), exp.currentConfig())
+	if err != nil {
+		t.Fatalf("expected the other vessels despite one failed request, got %v", err)
+	}
+	if len(positions) != 1 || positions[0].MMSI != "230124000" {
+		t.Errorf("unexpected positions %+v", positions)
+	}
+
+	api.mu.Lock()
+	api.failing["230124000"] = true
+	api.mu.Unlock()
+	if _, err := exp.fetchPositions(context.Background(), exp.client(), exp.currentConfig()); err == nil {
+		t.Error("expected an error when every request failed")
+	}
+}
+
+func TestFetchPositionsTargetedConcurrency(t *testing.T) {
+	api, cfg := newTestAPI(t)
+	cfg.Parser = config.ParserTyped
+	cfg.FetchStrategy = config.FetchTargeted
+	cfg.FetchConcurrency = 2
+	exp := New(cfg)
+	for _, mmsi := range []string{"230000001", "230000002", "230000003", "230000004", "230000005"} {
+		exp.local.addVessel(models.VesselMetadata{MMSI: mmsi, Name: "OTSO"})
+	}
+
+	if _, err := exp.fetchPositions(context.Background(), exp.client(), exp.currentConfig()); err != nil {
+		t.Fatalf("fetchPositions() error = %v", err)
+	}
+	if got := api.locationCalls.Load(); got != 6 {
+		t.Errorf("expected 6 per-vessel location calls, got %d", got)
+	}
+	api.mu.Lock()
+	peak := api.peak
+	api.mu.Unlock()
+	if peak > 2 {
+		t.Errorf("expected at most 2 concurrent requests, got %d", peak)
+	}
+}
@@ -0,0 +1,104 @@
+package exporter
+
+import (
+	"math"
+	"sync"
+
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// motion is the kinematic state derived from a vessel's reports.
+type motion struct {
+	last      geo.Point
+	timestamp int64
+	// distance is the total distance travelled in metres.
+	distance float64
+	// speed is the speed over the latest plausible segment in knots; valid
+	// after the first one.
+	speed      float64
+	speedValid bool
+}
+
+// kinematics derives distance travelled and speed from successive positions.
+type kinematics struct {
+	mu     sync.Mutex
+	states map[string]*motion
+}
+
+func newKinematics() *kinematics {
+	return &kinematics{states: map[string]*motion{}}
+}
+
+// observe adds a report that passed the plausibility checks. Duplicate and
+// older reports are ignored. A reanchored report, one the checks accepted
+// out of reach of the previous report, adds no distance; the vessel
+// continues from the new position.
+func (k *kinematics) observe(pos models.IcebreakerPosition, reanchored bool) {
+	if pos.Timestamp <= 0 {
+		return
+	}
+	pt := geo.Point{Lon: pos.Longitude, Lat: pos.Latitude}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	m, ok := k.states[pos.MMSI]
+	if !ok {
+		k.states[pos.MMSI] = &motion{last: pt, timestamp: pos.Timestamp}
+		return
+	}
+	if pos.Timestamp <= m.timestamp {
+		return
+	}
+
+	dist := geo.GeodesicDistance(m.last, pt)
+	knots := impliedKnots(dist, pos.Timestamp-m.timestamp)
+	m.last, m.timestamp = pt, pos.Timestamp
+	if reanchored {
+		return
+	}
+	m.distance += dist
+	m.speed, m.speedValid = knots, true
+}
+
+// retain forgets vessels that are no longer tracked.
+func (k *kinematics) retain(positions []models.IcebreakerPosition) {
+	mmsis := make(map[string]struct{}, len(positions))
+	for _, pos := range positions {
+		mmsis[pos.MMSI] = struct{}{}
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for mmsi := range k.states {
+		if _, ok := mmsis[mmsi]; !ok {
+			delete(k.states, mmsi)
+		}
+	}
+}
+
+// state returns a copy of the vessel's state.
+func (k *kinematics) state(mmsi string) (motion, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	m, ok := k.states[mmsi]
+	if !ok {
+		return motion{}, false
+	}
+	return *m, true
+}
+
+// impliedKnots is the speed of covering metres in seconds.
+func impliedKnots(metres float64, seconds int64) float64 {
+	return metres / geo.MetersPerNauticalMile / (float64(seconds) / 3600)
+}
+
+// sogDiscrepancy returns how far the derived speed is from the reported speed
+// over ground.
+func sogDiscrepancy(m motion, pos models.IcebreakerPosition) (float64, bool) {
+	if !m.speedValid || pos.SpeedOverGround == nil {
+		return 0, false
+	}
+	return math.Abs(m.speed - *pos.SpeedOverGround), true
+}
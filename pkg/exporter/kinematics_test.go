@@ -0,0 +1,111 @@
+package exporter
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+func TestKinematics(t *testing.T) {
+	k := newKinematics()
+	pos := func(lat float64, ts int64) models.IcebreakerPosition {
+		return models.IcebreakerPosition{MMSI: "230252000", Latitude: lat, Longitude: 25, Timestamp: ts, SpeedOverGround: ptr(11.0)}
+	}
+
+	// One minute of latitude at 65°N is 1.0037 nmi on the WGS 84 ellipsoid.
+	k.observe(pos(65, 1000), false)
+	k.observe(pos(65, 1000), false)
+	k.observe(pos(65+1.0/60, 1360), false)
+	k.observe(pos(65+1.0/60, 1360), false) // duplicate report
+	k.observe(pos(65, 1200), false)        // older report
+
+	m, ok := k.state("230252000")
+	if !ok || !m.speedValid {
+		t.Fatalf("expected a derived speed, got %+v", m)
+	}
+	if nm := m.distance / 1852; math.Abs(nm-1.0037) > 0.0005 {
+		t.Errorf("distance: got %.4f nmi, want 1.0037", nm)
+	}
+	if math.Abs(m.speed-10.037) > 0.005 {
+		t.Errorf("speed: got %.3f kn, want 10.037", m.speed)
+	}
+	if d, ok := sogDiscrepancy(m, pos(65, 0)); !ok || math.Abs(d-0.963) > 0.005 {
+		t.Errorf("discrepancy: got %.3f kn", d)
+	}
+
+	// A reanchored report adds no distance, and the next report continues
+	// from the new position.
+	k.observe(pos(66, 1420), true)
+	k.observe(pos(66+1.0/60, 1780), false)
+	m, _ = k.state("230252000")
+	if nm := m.distance / 1852; math.Abs(nm-2.008) > 0.002 {
+		t.Errorf("distance after jump: got %.4f nmi, want about 2.008", nm)
+	}
+
+	k.retain(nil)
+	if _, ok := k.state("230252000"); ok {
+		t.Error("expected untracked vessel to be forgotten")
+	}
+}
+
+func TestMetricsHandlerKinematics(t *testing.T) {
+	exp := New(config.Config{})
+	start := time.Now().Unix() - 3600
+	first := models.IcebreakerPosition{Name: "OTSO", MMSI: "230252000", Country: "FI", Latitude: 65, Longitude: 25, Timestamp: start}
+	second := first
+	second.Latitude, second.Timestamp, second.SpeedOverGround = 65.1, start+1800, ptr(12.5)
+	exp.motion.observe(first, false)
+	exp.motion.observe(second, false)
+	exp.snapshot = models.Snapshot{LastRefresh: time.Now(), Positions: []models.IcebreakerPosition{second}}
+
+	rr := httptest.NewRecorder()
+	exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+	for _, want := range []string{
+		`icebreaker_distance_travelled_nautical_miles_total{vessel_name="OTSO",mmsi="230252000",country="FI"} 6.02`,
+		`icebreaker_derived_speed_knots{vessel_name="OTSO",mmsi="230252000",country="FI"} 12.04`,
+		`icebreaker_sog_discrepancy_knots{vessel_name="OTSO",mmsi="230252000",country="FI"} 0.46`,
+		`icebreaker_position_jumps_total{vessel_name="OTSO",mmsi="230252000",country="FI"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in output:\n%s", want, body)
+		}
+	}
+}
+
+func TestJumpsFollowPlausibility(t *testing.T) {
+	exp := New(config.Config{Targets: config.NewTargets(config.ParseVesselNames("OTSO"))})
+	exp.snapshot = models.Snapshot{Positions: []models.IcebreakerPosition{{Name: "OTSO", MMSI: "230252000", Country: "FI", Latitude: 65.6, Longitude: 24.4, Timestamp: 1000}}}
+	report := func(lat, lon float64, ts int64) models.LocationRecord {
+		return models.LocationRecord{MMSI: "230252000", Latitude: lat, Longitude: lon, Timestamp: ts}
+	}
+
+	exp.applyLiveLocation(report(65.6, 24.4, 1000))
+	exp.applyLiveLocation(report(60.2, 25.0, 1060))  // Helsinki a minute later
+	exp.applyLiveLocation(report(60.21, 25.0, 1120)) // still there
+	exp.applyLiveLocation(report(60.22, 25.0, 1180)) // third in a row: reanchored
+	exp.applyLiveLocation(report(60.22+1.0/60, 25.0, 1540))
+
+	m, _ := exp.motion.state("230252000")
+	if nm := m.distance / 1852; nm > 1.01 {
+		t.Errorf("expected the jump to add no distance, got %.3f nmi", nm)
+	}
+
+	rr := httptest.NewRecorder()
+	exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+	for _, want := range []string{
+		`icebreaker_position_jumps_total{vessel_name="OTSO",mmsi="230252000",country="FI"} 2`,
+		`icebreaker_position_anomalies_total{reason="speed"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in output:\n%s", want, body)
+		}
+	}
+}
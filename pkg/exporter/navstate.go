@@ -0,0 +1,91 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/ais"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// navigationMaxGap bounds the time between two reports that is credited to
+// the earlier navigation status. Over longer silences the vessel may have
+// done anything.
+const navigationMaxGap = time.Hour
+
+// navigation is the navigation status history of a vessel.
+type navigation struct {
+	status    int
+	timestamp int64
+	// seconds is the time spent in each status, changes the number of times
+	// the vessel changed into it.
+	seconds [len(ais.NavigationStates)]int64
+	changes [len(ais.NavigationStates)]uint64
+}
+
+// navigationTracker accumulates the time each vessel spends in a navigation
+// status.
+type navigationTracker struct {
+	mu     sync.Mutex
+	states map[string]*navigation
+}
+
+func newNavigationTracker() *navigationTracker {
+	return &navigationTracker{states: map[string]*navigation{}}
+}
+
+// observe adds a report. Reports without a navigation status, duplicate and
+// older ones are ignored. The time since the previous report is credited to
+// its status unless it exceeds navigationMaxGap.
+func (t *navigationTracker) observe(pos models.IcebreakerPosition) {
+	if pos.NavigationStatus == nil || pos.Timestamp <= 0 {
+		return
+	}
+	status := *pos.NavigationStatus
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n, ok := t.states[pos.MMSI]
+	if !ok {
+		t.states[pos.MMSI] = &navigation{status: status, timestamp: pos.Timestamp}
+		return
+	}
+	if pos.Timestamp <= n.timestamp {
+		return
+	}
+	if elapsed := pos.Timestamp - n.timestamp; time.Duration(elapsed)*time.Second <= navigationMaxGap {
+		n.seconds[n.status] += elapsed
+	}
+	if status != n.status {
+		n.changes[status]++
+	}
+	n.status, n.timestamp = status, pos.Timestamp
+}
+
+// retain forgets vessels that are no longer tracked.
+func (t *navigationTracker) retain(positions []models.IcebreakerPosition) {
+	mmsis := make(map[string]struct{}, len(positions))
+	for _, pos := range positions {
+		mmsis[pos.MMSI] = struct{}{}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for mmsi := range t.states {
+		if _, ok := mmsis[mmsi]; !ok {
+			delete(t.states, mmsi)
+		}
+	}
+}
+
+// state returns a copy of the vessel's history.
+func (t *navigationTracker) state(mmsi string) (navigation, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, ok := t.states[mmsi]
+	if !ok {
+		return navigation{}, false
+	}
+	return *n, true
+}
@@ -0,0 +1,78 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+func TestNavigationTracker(t *testing.T) {
+	tracker := newNavigationTracker()
+	report := func(status *int, ts int64) models.IcebreakerPosition {
+		return models.IcebreakerPosition{MMSI: "230252000", Latitude: 65, Longitude: 25, Timestamp: ts, NavigationStatus: status}
+	}
+
+	tracker.observe(report(ptr(5), 1000))
+	tracker.observe(report(ptr(5), 1180))
+	tracker.observe(report(ptr(5), 1180)) // duplicate report
+	tracker.observe(report(ptr(0), 1360))
+	tracker.observe(report(nil, 1400))    // no status
+	tracker.observe(report(ptr(1), 1300)) // older report
+	tracker.observe(report(ptr(1), 1960))
+	tracker.observe(report(ptr(0), 1960+7200)) // after a long silence
+
+	n, ok := tracker.state("230252000")
+	if !ok {
+		t.Fatal("expected a navigation state")
+	}
+	if n.status != 0 {
+		t.Errorf("status: got %d, want 0", n.status)
+	}
+	if n.seconds[5] != 360 || n.seconds[0] != 600 || n.seconds[1] != 0 {
+		t.Errorf("unexpected seconds %v", n.seconds)
+	}
+	if n.changes[5] != 0 || n.changes[0] != 2 || n.changes[1] != 1 {
+		t.Errorf("unexpected changes %v", n.changes)
+	}
+
+	tracker.retain(nil)
+	if _, ok := tracker.state("230252000"); ok {
+		t.Error("expected untracked vessel to be forgotten")
+	}
+}
+
+func TestMetricsHandlerNavigationState(t *testing.T) {
+	exp := New(config.Config{})
+	start := time.Now().Unix() - 3600
+	first := models.IcebreakerPosition{Name: "OTSO", MMSI: "230252000", Country: "FI", Latitude: 65, Longitude: 25, Timestamp: start, NavigationStatus: ptr(0)}
+	second := first
+	second.Timestamp, second.NavigationStatus = start+1800, ptr(5)
+	exp.navstate.observe(first)
+	exp.navstate.observe(second)
+	exp.snapshot = models.Snapshot{LastRefresh: time.Now(), Positions: []models.IcebreakerPosition{second}}
+
+	rr := httptest.NewRecorder()
+	exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+	for _, want := range []string{
+		`icebreaker_navigation_status{vessel_name="OTSO",mmsi="230252000",country="FI"} 5`,
+		`icebreaker_navigation_state{vessel_name="OTSO",mmsi="230252000",country="FI",state="moored"} 1`,
+		`icebreaker_navigation_state{vessel_name="OTSO",mmsi="230252000",country="FI",state="under_way_using_engine"} 0`,
+		`icebreaker_navigation_state{vessel_name="OTSO",mmsi="230252000",country="FI",state="towing_astern"} 0`,
+		`icebreaker_navigation_state_seconds_total{vessel_name="OTSO",mmsi="230252000",country="FI",state="under_way_using_engine"} 1800`,
+		`icebreaker_navigation_state_seconds_total{vessel_name="OTSO",mmsi="230252000",country="FI",state="moored"} 0`,
+		`icebreaker_navigation_state_changes_total{vessel_name="OTSO",mmsi="230252000",country="FI",state="moored"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in output:\n%s", want, body)
+		}
+	}
+	if n := strings.Count(body, "icebreaker_navigation_state{"); n != 16 {
+		t.Errorf("expected 16 navigation states, got %d", n)
+	}
+}
@@ -0,0 +1,33 @@
+package exporter
+
+import (
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// pairDistance returns the geodesic distance between two positions in
+// nautical miles.
+func pairDistance(a, b models.IcebreakerPosition) float64 {
+	return geo.GeodesicDistance(geo.Point{Lon: a.Longitude, Lat: a.Latitude}, geo.Point{Lon: b.Longitude, Lat: b.Latitude}) / geo.MetersPerNauticalMile
+}
+
+// nearestOther returns the index of the position closest to positions[i]
+// and the geodesic distance to it in nautical miles, or -1 if there is no
+// other position. The candidates are compared by the cheaper great-circle
+// distance.
+func nearestOther(positions []models.IcebreakerPosition, i int) (int, float64) {
+	from := geo.Point{Lon: positions[i].Longitude, Lat: positions[i].Latitude}
+	nearest, best := -1, 0.0
+	for j, pos := range positions {
+		if j == i {
+			continue
+		}
+		if d := geo.Distance(from, geo.Point{Lon: pos.Longitude, Lat: pos.Latitude}); nearest < 0 || d < best {
+			nearest, best = j, d
+		}
+	}
+	if nearest < 0 {
+		return -1, 0
+	}
+	return nearest, pairDistance(positions[i], positions[nearest])
+}
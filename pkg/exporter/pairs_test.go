@@ -0,0 +1,63 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+func TestMetricsHandlerPairDistances(t *testing.T) {
+	exp := New(config.Config{PairDistances: true, MaxPairs: 3})
+	exp.snapshot = models.Snapshot{LastRefresh: time.Now(), Positions: []models.IcebreakerPosition{
+		{Name: "OTSO", MMSI: "230252000", Country: "FI", Latitude: 65, Longitude: 24},
+		// One minute of latitude north, 1.0037 nmi on the WGS 84 ellipsoid.
+		{Name: "KONTIO", MMSI: "230253000", Country: "FI", Latitude: 65 + 1.0/60, Longitude: 24},
+		// Same name, other vessel: the series must not collide.
+		{Name: "OTSO", MMSI: "265066000", Country: "SE", Latitude: 60.16, Longitude: 24.96},
+	}}
+
+	scrape := func() string {
+		rr := httptest.NewRecorder()
+		exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rr.Body.String()
+	}
+	body := scrape()
+	for _, want := range []string{
+		`icebreaker_nearest_icebreaker_distance_nautical_miles{vessel_name="OTSO",mmsi="230252000",country="FI"} 1.00`,
+		`icebreaker_nearest_icebreaker_distance_nautical_miles{vessel_name="KONTIO",mmsi="230253000",country="FI"} 1.00`,
+		`icebreaker_nearest_icebreaker_distance_nautical_miles{vessel_name="OTSO",mmsi="265066000",country="SE"} 29`,
+		`icebreaker_nearest_icebreaker_info{vessel_name="OTSO",mmsi="230252000",country="FI",nearest_mmsi="230253000",nearest="KONTIO"} 1`,
+		`icebreaker_nearest_icebreaker_info{vessel_name="KONTIO",mmsi="230253000",country="FI",nearest_mmsi="230252000",nearest="OTSO"} 1`,
+		`icebreaker_nearest_icebreaker_info{vessel_name="OTSO",mmsi="265066000",country="SE",nearest_mmsi="230252000",nearest="OTSO"} 1`,
+		`icebreaker_pair_distance_limit_exceeded 0`,
+		`icebreaker_pair_distance_nautical_miles{from_mmsi="230252000",to_mmsi="230253000",from="OTSO",to="KONTIO"} 1.00`,
+		`icebreaker_pair_distance_nautical_miles{from_mmsi="230252000",to_mmsi="265066000",from="OTSO",to="OTSO"} 29`,
+		`icebreaker_pair_distance_nautical_miles{from_mmsi="230253000",to_mmsi="265066000",from="KONTIO",to="OTSO"} 29`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in output:\n%s", want, body)
+		}
+	}
+	if n := strings.Count(body, "icebreaker_pair_distance_nautical_miles{"); n != 3 {
+		t.Errorf("expected 3 pair series, got %d", n)
+	}
+
+	cfg := exp.currentConfig()
+	cfg.MaxPairs = 2
+	exp.cfg.Store(&cfg)
+	body = scrape()
+	if !strings.Contains(body, "icebreaker_pair_distance_limit_exceeded 1") || strings.Contains(body, "icebreaker_pair_distance_nautical_miles{") {
+		t.Errorf("expected the pair distances to be omitted above the limit:\n%s", body)
+	}
+
+	cfg.PairDistances = false
+	exp.cfg.Store(&cfg)
+	if body = scrape(); strings.Contains(body, "icebreaker_pair_distance") {
+		t.Errorf("expected no pair distances when disabled:\n%s", body)
+	}
+}
@@ -1,76 +1,18 @@
 package exporter
 
 import (
-	"context"
 	"encoding/json"
-	"errors"
-	"fmt"
-	"io"
 	"math"
-	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/joluc/icebreaker-exporter/pkg/ais"
 	"github.com/joluc/icebreaker-exporter/pkg/config"
 	"github.com/joluc/icebreaker-exporter/pkg/models"
 )
 
-func fetchPositions(ctx context.Context, client *http.Client, cfg config.Config) ([]models.IcebreakerPosition, error) {
-	reqCtx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout)
-	defer cancel()
-
-	vesselsPayload, err := fetchJSON(reqCtx, client, cfg.VesselsURL, cfg.DigitrafficUser)
-	if err != nil {
-		return nil, fmt.Errorf("fetch vessels: %w", err)
-	}
-	locationsPayload, err := fetchJSON(reqCtx, client, cfg.LocationsURL, cfg.DigitrafficUser)
-	if err != nil {
-		return nil, fmt.Errorf("fetch locations: %w", err)
-	}
-
-	vessels := ExtractVesselMetadata(vesselsPayload)
-	locations := ExtractLocations(locationsPayload)
-	positions := SelectIcebreakerPositions(vessels, locations, cfg.TargetNames)
-
-	if len(positions) == 0 {
-		return nil, errors.New("no positions found for configured icebreakers")
-	}
-
-	return positions, nil
-}
-
-func fetchJSON(ctx context.Context, client *http.Client, endpoint, userAgent string) (any, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Accept", "application/json")
-	if userAgent != "" {
-		req.Header.Set("Digitraffic-User", userAgent)
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
-		return nil, fmt.Errorf("status %s: %s", resp.Status, strings.TrimSpace(string(body)))
-	}
-
-	dec := json.NewDecoder(resp.Body)
-	dec.UseNumber()
-	var payload any
-	if err := dec.Decode(&payload); err != nil {
-		return nil, err
-	}
-	return payload, nil
-}
-
 func ExtractVesselMetadata(payload any) []models.VesselMetadata {
 	byMMSI := map[string]models.VesselMetadata{}
 	walkJSON(payload, func(item map[string]any) {
@@ -84,26 +26,11 @@ func ExtractVesselMetadata(payload any) []models.VesselMetadata {
 			return
 		}
 
-		// Infer country based on MID (first 3 digits of MMSI)
-		country := "Unknown"
-		if len(mmsi) >= 3 {
-			mid := mmsi[:3]
-			switch mid {
-			case "230":
-				country = "FI"
-			case "265", "266":
-				country = "SE"
-			case "257", "258", "259":
-				country = "NO"
-			case "219", "220":
-				country = "DK"
-			}
-		}
-
 		byMMSI[mmsi] = models.VesselMetadata{
-			Name:    strings.TrimSpace(name),
-			MMSI:    mmsi,
-			Country: country,
+			Name:       strings.TrimSpace(name),
+			MMSI:       mmsi,
+			Country:    ais.CountryCode(mmsi),
+			StaticData: extractStaticData(item),
 		}
 	})
 
@@ -114,6 +41,32 @@ func ExtractVesselMetadata(payload any) []models.VesselMetadata {
 	return out
 }
 
+// extractStaticData reads the AIS static and voyage fields of a vessels
+// entry, leaving absent fields at zero.
+func extractStaticData(item map[string]any) models.StaticData {
+	number := func(keys ...string) int {
+		value, _ := getNumber(item, keys...)
+		return int(value)
+	}
+	draught, _ := getNumber(item, "draught") // decimetres
+
+	data := models.StaticData{
+		IMO:         number("imo"),
+		CallSign:    strings.TrimSpace(getString(item, "callSign", "callsign")),
+		ShipType:    number("shipType"),
+		Destination: strings.TrimSpace(getString(item, "destination")),
+		Draught:     draught / 10,
+	}
+	data.Length, data.Beam = ais.Dimensions(number("referencePointA"), number("referencePointB"), number("referencePointC"), number("referencePointD"))
+
+	ref := time.Now()
+	if ts, ok := getNumber(item, "timestamp"); ok && ts > 0 {
+		ref = time.Unix(normalizeTimestamp(int64(ts)), 0)
+	}
+	data.ETA = ais.ETA(number("eta"), ref)
+	return data
+}
+
 func ExtractLocations(payload any) []models.LocationRecord {
 	var out []models.LocationRecord
 	walkJSON(payload, func(item map[string]any) {
@@ -159,43 +112,14 @@ func parseGeoJSONLocation(item map[string]any) (models.LocationRecord, bool) {
 		name = getString(item, "name", "vesselName")
 	}
 
-	ts := getTimestamp(properties, "timestamp", "time", "locUpdateTimestamp")
+	ts := getTimestamp(properties, "timestampExternal", "timestamp", "time", "locUpdateTimestamp")
 	if ts == 0 {
-		ts = getTimestamp(item, "timestamp", "time", "locUpdateTimestamp")
-	}
-
-	// Extract AIS movement fields from properties
-	sog, _ := getNumber(properties, "sog", "speedOverGround")
-	if sog == 0 {
-		sog, _ = getNumber(item, "sog", "speedOverGround")
-	}
-	cog, _ := getNumber(properties, "cog", "courseOverGround")
-	if cog == 0 {
-		cog, _ = getNumber(item, "cog", "courseOverGround")
-	}
-	heading, _ := getNumber(properties, "heading", "headingDegrees")
-	if heading == 0 {
-		heading, _ = getNumber(item, "heading", "headingDegrees")
-	}
-	rot, _ := getNumber(properties, "rot", "rateOfTurn")
-	if rot == 0 {
-		rot, _ = getNumber(item, "rot", "rateOfTurn")
+		ts = getTimestamp(item, "timestampExternal", "timestamp", "time", "locUpdateTimestamp")
 	}
 
-	// Extract navigation status as integer
-	navStat := 0
-	if raw, ok := properties["navStat"]; ok && raw != nil {
-		if value, ok := toFloat64(raw); ok {
-			navStat = int(value)
-		}
-	}
-	if navStat == 0 {
-		if raw, ok := item["navStat"]; ok && raw != nil {
-			if value, ok := toFloat64(raw); ok {
-				navStat = int(value)
-			}
-		}
-	}
+	// Prefer properties over the feature itself. A value that is present
+	// but zero is real data and must not fall through to the next scope.
+	scopes := []map[string]any{properties, item}
 
 	return models.LocationRecord{
 		Name:             strings.TrimSpace(name),
@@ -203,11 +127,11 @@ func parseGeoJSONLocation(item map[string]any) (models.LocationRecord, bool) {
 		Latitude:         lat,
 		Longitude:        lon,
 		Timestamp:        ts,
-		SpeedOverGround:  sog,
-		CourseOverGround: cog,
-		Heading:          heading,
-		NavigationStatus: navStat,
-		RateOfTurn:       rot,
+		SpeedOverGround:  getOptional(scopes, ais.Speed, "sog", "speedOverGround"),
+		CourseOverGround: getOptional(scopes, ais.Course, "cog", "courseOverGround"),
+		Heading:          getOptional(scopes, ais.Heading, "heading", "headingDegrees"),
+		NavigationStatus: getNavigationStatus(scopes),
+		RateOfTurn:       getOptional(scopes, ais.RateOfTurn, "rot", "rateOfTurn"),
 	}, true
 }
 
@@ -225,19 +149,7 @@ func parseFlatLocation(item map[string]any) (models.LocationRecord, bool) {
 
 	ts := getTimestamp(item, "timestamp", "time", "locUpdateTimestamp")
 
-	// Extract AIS movement fields
-	sog, _ := getNumber(item, "sog", "speedOverGround")
-	cog, _ := getNumber(item, "cog", "courseOverGround")
-	heading, _ := getNumber(item, "heading", "headingDegrees")
-	rot, _ := getNumber(item, "rot", "rateOfTurn")
-
-	// Extract navigation status as integer
-	navStat := 0
-	if raw, ok := item["navStat"]; ok && raw != nil {
-		if value, ok := toFloat64(raw); ok {
-			navStat = int(value)
-		}
-	}
+	scopes := []map[string]any{item}
 
 	return models.LocationRecord{
 		Name:             strings.TrimSpace(getString(item, "name", "vesselName")),
@@ -245,18 +157,30 @@ func parseFlatLocation(item map[string]any) (models.LocationRecord, bool) {
 		Latitude:         lat,
 		Longitude:        lon,
 		Timestamp:        ts,
-		SpeedOverGround:  sog,
-		CourseOverGround: cog,
-		Heading:          heading,
-		NavigationStatus: navStat,
-		RateOfTurn:       rot,
+		SpeedOverGround:  getOptional(scopes, ais.Speed, "sog", "speedOverGround"),
+		CourseOverGround: getOptional(scopes, ais.Course, "cog", "courseOverGround"),
+		Heading:          getOptional(scopes, ais.Heading, "heading", "headingDegrees"),
+		NavigationStatus: getNavigationStatus(scopes),
+		RateOfTurn:       getOptional(scopes, ais.RateOfTurn, "rot", "rateOfTurn"),
 	}, true
 }
 
+// SelectIcebreakerPositions picks the latest position of every vessel whose
+// name is in targets.
 func SelectIcebreakerPositions(vessels []models.VesselMetadata, locations []models.LocationRecord, targets map[string]struct{}) []models.IcebreakerPosition {
+	defs := make([]config.Vessel, 0, len(targets))
+	for name := range targets {
+		defs = append(defs, config.Vessel{Name: name})
+	}
+	return SelectTargetPositions(vessels, locations, config.NewTargets(defs))
+}
+
+// SelectTargetPositions picks the latest position of every vessel matching
+// one of the target definitions.
+func SelectTargetPositions(vessels []models.VesselMetadata, locations []models.LocationRecord, targets *config.Targets) []models.IcebreakerPosition {
 	selectedByMMSI := map[string]models.VesselMetadata{}
 	for _, vessel := range vessels {
-		if _, ok := targets[config.NormalizeName(vessel.Name)]; !ok {
+		if _, ok := targets.Match(vessel.MMSI, vessel.Name, vessel.IMO); !ok {
 			continue
 		}
 		selectedByMMSI[vessel.MMSI] = vessel
@@ -274,30 +198,22 @@ func SelectIcebreakerPositions(vessels []models.VesselMetadata, locations []mode
 		vessel, ok := selectedByMMSI[loc.MMSI]
 		if !ok {
 			locName := strings.TrimSpace(loc.Name)
-			if _, nameMatch := targets[config.NormalizeName(locName)]; !nameMatch {
+			target, match := targets.Match(loc.MMSI, locName, 0)
+			if !match {
 				continue
 			}
+			if locName == "" {
+				locName = target.Name
+			}
 			vessel = models.VesselMetadata{
 				Name:    locName,
 				MMSI:    loc.MMSI,
-				Country: "Unknown",
+				Country: ais.CountryCode(loc.MMSI),
 			}
 			selectedByMMSI[loc.MMSI] = vessel
 		}
 
-		candidate := models.IcebreakerPosition{
-			Name:             vessel.Name,
-			MMSI:             loc.MMSI,
-			Country:          vessel.Country,
-			Latitude:         loc.Latitude,
-			Longitude:        loc.Longitude,
-			Timestamp:        loc.Timestamp,
-			SpeedOverGround:  loc.SpeedOverGround,
-			CourseOverGround: loc.CourseOverGround,
-			Heading:          loc.Heading,
-			NavigationStatus: loc.NavigationStatus,
-			RateOfTurn:       loc.RateOfTurn,
-		}
+		candidate := newPosition(vessel, loc)
 		current, exists := bestByMMSI[loc.MMSI]
 		if !exists || candidate.Timestamp > current.Timestamp {
 			bestByMMSI[loc.MMSI] = candidate
@@ -319,6 +235,24 @@ func SelectIcebreakerPositions(vessels []models.VesselMetadata, locations []mode
 	return out
 }
 
+func newPosition(vessel models.VesselMetadata, loc models.LocationRecord) models.IcebreakerPosition {
+	return models.IcebreakerPosition{
+		Name:             vessel.Name,
+		MMSI:             loc.MMSI,
+		Country:          vessel.Country,
+		Latitude:         loc.Latitude,
+		Longitude:        loc.Longitude,
+		Timestamp:        loc.Timestamp,
+		SpeedOverGround:  loc.SpeedOverGround,
+		CourseOverGround: loc.CourseOverGround,
+		Heading:          loc.Heading,
+		NavigationStatus: loc.NavigationStatus,
+		RateOfTurn:       loc.RateOfTurn,
+		Anomaly:          loc.Anomaly,
+		StaticData:       vessel.StaticData,
+	}
+}
+
 func walkJSON(node any, fn func(map[string]any)) {
 	switch value := node.(type) {
 	case map[string]any:
@@ -362,6 +296,27 @@ func getNumber(item map[string]any, keys ...string) (float64, bool) {
 	return 0, false
 }
 
+// getOptional returns the first value found for keys in scopes, passed
+// through normalize to drop AIS "not available" sentinels. Missing values
+// yield nil rather than zero.
+func getOptional(scopes []map[string]any, normalize func(float64) *float64, keys ...string) *float64 {
+	for _, scope := range scopes {
+		if value, ok := getNumber(scope, keys...); ok {
+			return normalize(value)
+		}
+	}
+	return nil
+}
+
+func getNavigationStatus(scopes []map[string]any) *int {
+	for _, scope := range scopes {
+		if value, ok := getNumber(scope, "navStat", "navigationStatus"); ok {
+			return ais.NavigationStatus(int(value))
+		}
+	}
+	return nil
+}
+
 func getMMSI(item map[string]any, keys ...string) string {
 	if item == nil {
 		return ""
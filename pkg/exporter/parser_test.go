@@ -2,7 +2,9 @@ package exporter
 
 import (
 	"testing"
+	"time"
 
+	"github.com/joluc/icebreaker-exporter/pkg/config"
 	"github.com/joluc/icebreaker-exporter/pkg/models"
 )
 
@@ -20,6 +22,46 @@ func TestExtractVesselMetadata(t *testing.T) {
 	}
 }
 
+func TestExtractVesselMetadataStaticData(t *testing.T) {
+	payload := []any{
+		map[string]any{
+			"name": "OTSO", "mmsi": 230124000, "imo": 8914428, "callSign": "OHMN", "shipType": 52,
+			"draught": 80, "destination": "KEMI ", "eta": 754432, "timestamp": 1700000000000,
+			"referencePointA": 60, "referencePointB": 39, "referencePointC": 12, "referencePointD": 12,
+		},
+	}
+
+	metas := ExtractVesselMetadata(payload)
+	if len(metas) != 1 {
+		t.Fatalf("expected 1 vessel, got %d", len(metas))
+	}
+	got := metas[0].StaticData
+	if got.IMO != 8914428 || got.CallSign != "OHMN" || got.ShipType != 52 || got.Destination != "KEMI" ||
+		got.Draught != 8 || got.Length != 99 || got.Beam != 24 || !got.ETA.Equal(time.Date(2023, 11, 16, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected static data %+v", got)
+	}
+}
+
+func TestExtractVesselMetadataDraught(t *testing.T) {
+	tests := []struct {
+		draught any
+		want    float64
+	}{
+		{80, 8},
+		{73, 7.3},
+		{73.5, 7.35},
+	}
+	for _, tt := range tests {
+		metas := ExtractVesselMetadata([]any{map[string]any{"name": "OTSO", "mmsi": 230124000, "draught": tt.draught}})
+		if len(metas) != 1 {
+			t.Fatalf("expected 1 vessel, got %d", len(metas))
+		}
+		if got := metas[0].StaticData.Draught; got != tt.want {
+			t.Errorf("draught %v: got %v, want %v", tt.draught, got, tt.want)
+		}
+	}
+}
+
 func TestExtractLocations(t *testing.T) {
 	payload := map[string]any{
 		"features": []any{
@@ -59,25 +101,87 @@ func TestExtractLocations(t *testing.T) {
 	}
 
 	// Verify first location has movement data
-	if locations[0].SpeedOverGround != 5.2 {
-		t.Errorf("expected SOG=5.2, got %.2f", locations[0].SpeedOverGround)
+	if got := locations[0].SpeedOverGround; got == nil || *got != 5.2 {
+		t.Errorf("expected SOG=5.2, got %v", got)
 	}
-	if locations[0].CourseOverGround != 45.0 {
-		t.Errorf("expected COG=45.0, got %.1f", locations[0].CourseOverGround)
+	if got := locations[0].CourseOverGround; got == nil || *got != 45.0 {
+		t.Errorf("expected COG=45.0, got %v", got)
 	}
-	if locations[0].Heading != 47 {
-		t.Errorf("expected Heading=47, got %.0f", locations[0].Heading)
+	if got := locations[0].Heading; got == nil || *got != 47 {
+		t.Errorf("expected Heading=47, got %v", got)
 	}
-	if locations[0].NavigationStatus != 0 {
-		t.Errorf("expected NavStat=0, got %d", locations[0].NavigationStatus)
+	if got := locations[0].NavigationStatus; got == nil || *got != 0 {
+		t.Errorf("expected NavStat=0, got %v", got)
 	}
-	if locations[0].RateOfTurn != 2.5 {
-		t.Errorf("expected ROT=2.5, got %.1f", locations[0].RateOfTurn)
+	if got := locations[0].RateOfTurn; got == nil || *got != 2.5 {
+		t.Errorf("expected ROT=2.5, got %v", got)
 	}
 
 	// Verify second location (flat format) has movement data
-	if locations[1].NavigationStatus != 5 {
-		t.Errorf("expected NavStat=5 for second location, got %d", locations[1].NavigationStatus)
+	if got := locations[1].NavigationStatus; got == nil || *got != 5 {
+		t.Errorf("expected NavStat=5 for second location, got %v", got)
+	}
+	// Real zeros are kept, not treated as missing
+	if got := locations[1].SpeedOverGround; got == nil || *got != 0 {
+		t.Errorf("expected SOG=0 for second location, got %v", got)
+	}
+}
+
+func TestExtractLocationsUnavailableValues(t *testing.T) {
+	payload := map[string]any{
+		"features": []any{
+			map[string]any{
+				"mmsi": 230124000,
+				"properties": map[string]any{
+					"mmsi":    230124000,
+					"sog":     0.0,
+					"cog":     360.0,
+					"heading": 511,
+					"navStat": 15,
+					"rot":     -128,
+				},
+				"geometry": map[string]any{
+					"coordinates": []any{24.91, 60.17},
+				},
+				// Must not override the real zero in properties
+				"sog": 7.5,
+			},
+			map[string]any{
+				"mmsi": "230123000",
+				"lat":  61.3,
+				"lon":  21.4,
+				"sog":  102.3,
+			},
+		},
+	}
+
+	locations := ExtractLocations(payload)
+	if len(locations) != 2 {
+		t.Fatalf("expected 2 locations, got %d", len(locations))
+	}
+
+	byMMSI := map[string]models.LocationRecord{}
+	for _, loc := range locations {
+		byMMSI[loc.MMSI] = loc
+	}
+
+	otso := byMMSI["230124000"]
+	if otso.SpeedOverGround == nil || *otso.SpeedOverGround != 0 {
+		t.Errorf("expected real SOG=0, got %v", otso.SpeedOverGround)
+	}
+	if otso.CourseOverGround != nil || otso.Heading != nil || otso.RateOfTurn != nil {
+		t.Errorf("expected sentinels to be unavailable, got COG=%v heading=%v ROT=%v", otso.CourseOverGround, otso.Heading, otso.RateOfTurn)
+	}
+	if otso.NavigationStatus == nil || *otso.NavigationStatus != 15 {
+		t.Errorf("expected NavStat=15 to be kept, got %v", otso.NavigationStatus)
+	}
+
+	kontio := byMMSI["230123000"]
+	if kontio.SpeedOverGround != nil {
+		t.Errorf("expected SOG=102.3 to be unavailable, got %v", *kontio.SpeedOverGround)
+	}
+	if kontio.CourseOverGround != nil || kontio.Heading != nil || kontio.NavigationStatus != nil || kontio.RateOfTurn != nil {
+		t.Errorf("expected missing fields to be unavailable, got %+v", kontio)
 	}
 }
 
@@ -88,9 +192,9 @@ func TestSelectIcebreakerPositions(t *testing.T) {
 		{Name: "Random", MMSI: "111111111"},
 	}
 	locations := []models.LocationRecord{
-		{Name: "Otso", MMSI: "230124000", Latitude: 60.1, Longitude: 24.9, Timestamp: 100, SpeedOverGround: 3.5, NavigationStatus: 0},
-		{Name: "Otso", MMSI: "230124000", Latitude: 60.2, Longitude: 25.0, Timestamp: 200, SpeedOverGround: 5.2, NavigationStatus: 0},
-		{Name: "Kontio", MMSI: "230123000", Latitude: 61.1, Longitude: 21.2, Timestamp: 150, SpeedOverGround: 0.0, NavigationStatus: 5},
+		{Name: "Otso", MMSI: "230124000", Latitude: 60.1, Longitude: 24.9, Timestamp: 100, SpeedOverGround: ptr(3.5), NavigationStatus: ptr(0)},
+		{Name: "Otso", MMSI: "230124000", Latitude: 60.2, Longitude: 25.0, Timestamp: 200, SpeedOverGround: ptr(5.2), NavigationStatus: ptr(0)},
+		{Name: "Kontio", MMSI: "230123000", Latitude: 61.1, Longitude: 21.2, Timestamp: 150, SpeedOverGround: ptr(0.0), NavigationStatus: ptr(5)},
 		{Name: "Random", MMSI: "111111111", Latitude: 10, Longitude: 10, Timestamp: 100},
 	}
 
@@ -109,10 +213,49 @@ func TestSelectIcebreakerPositions(t *testing.T) {
 	}
 
 	// Verify movement fields are propagated
-	if positions[1].SpeedOverGround != 5.2 {
-		t.Errorf("expected SOG=5.2 for latest Otso position, got %.2f", positions[1].SpeedOverGround)
+	if got := positions[1].SpeedOverGround; got == nil || *got != 5.2 {
+		t.Errorf("expected SOG=5.2 for latest Otso position, got %v", got)
+	}
+	if got := positions[0].NavigationStatus; got == nil || *got != 5 {
+		t.Errorf("expected NavStat=5 for Kontio, got %v", got)
+	}
+}
+
+func TestSelectTargetPositionsNameMatchCountry(t *testing.T) {
+	locations := []models.LocationRecord{
+		{Name: "Ymer", MMSI: "265547250", Latitude: 65.5, Longitude: 22.1, Timestamp: 100},
+	}
+	targets := config.NewTargets(config.ParseVesselNames("YMER"))
+
+	positions := SelectTargetPositions(nil, locations, targets)
+	if len(positions) != 1 || positions[0].Country != "SE" {
+		t.Fatalf("expected name-matched YMER with country SE, got %+v", positions)
+	}
+}
+
+func TestSelectTargetPositionsPinnedMMSI(t *testing.T) {
+	metas := []models.VesselMetadata{
+		{Name: "Otso", MMSI: "230252000"},
+		{Name: "Otso", MMSI: "230999999"},
+	}
+	locations := []models.LocationRecord{
+		{MMSI: "230252000", Latitude: 65.0, Longitude: 25.2, Timestamp: 100},
+		{MMSI: "230999999", Latitude: 60.1, Longitude: 24.9, Timestamp: 100},
+		{MMSI: "230289000", Latitude: 65.7, Longitude: 24.5, Timestamp: 100},
+	}
+	targets := config.NewTargets([]config.Vessel{
+		{Name: "OTSO", MMSI: "230252000"},
+		{Name: "POLARIS", MMSI: "230289000"},
+	})
+
+	positions := SelectTargetPositions(metas, locations, targets)
+	if len(positions) != 2 {
+		t.Fatalf("expected 2 positions, got %+v", positions)
+	}
+	if positions[0].MMSI != "230252000" || positions[1].MMSI != "230289000" {
+		t.Errorf("expected pinned OTSO and POLARIS, got %+v", positions)
 	}
-	if positions[0].NavigationStatus != 5 {
-		t.Errorf("expected NavStat=5 for Kontio, got %d", positions[0].NavigationStatus)
+	if positions[1].Name != "POLARIS" {
+		t.Errorf("expected unnamed location to take the definition name, got %q", positions[1].Name)
 	}
 }
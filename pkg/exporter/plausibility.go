@@ -0,0 +1,282 @@
+package exporter
+
+import (
+	"log/slog"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+	"github.com/joluc/icebreaker-exporter/pkg/land"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// Reasons a position report fails the plausibility checks.
+const (
+	anomalySpeed    = "speed"
+	anomalyLand     = "land"
+	anomalySpoofing = "spoofing_point"
+	anomalyCluster  = "cluster"
+)
+
+var anomalyReasons = []string{anomalySpeed, anomalyLand, anomalySpoofing, anomalyCluster}
+
+const (
+	// maxPlausibleSpeedKnots caps the speed implied by two successive
+	// reports. Faster ones are GNSS glitches.
+	maxPlausibleSpeedKnots = 50
+	// clusterMinVessels distinct vessels reporting the very same
+	// coordinates in one refresh are taken to be spoofed there.
+	clusterMinVessels = 3
+	// The reanchorAfter-th consecutive report that fails only the speed
+	// check is accepted: the vessel really is there and the earlier fix was
+	// wrong.
+	reanchorAfter = 3
+)
+
+// nullIsland is where receivers without a fix place a vessel.
+var nullIsland = config.SpoofingPoint{Name: "Null Island", Radius: config.DefaultSpoofingRadius}
+
+// plausibleState is what the checks remember of a vessel.
+type plausibleState struct {
+	// last is the latest report that passed the checks.
+	last    models.LocationRecord
+	hasLast bool
+	// checked and verdict are the timestamp and outcome of the latest
+	// report, so that a report returned by several refreshes counts once.
+	checked int64
+	verdict string
+	// streak counts consecutive reports that failed the speed check.
+	streak int
+	// jumps counts the reports that failed the speed check, and reanchored
+	// is the timestamp of the latest report accepted after a streak.
+	jumps      uint64
+	reanchored int64
+}
+
+// plausibility flags position reports that imply impossible speeds, lie on
+// land or sit at known spoofing points.
+type plausibility struct {
+	mu        sync.Mutex
+	states    map[string]*plausibleState
+	anomalies map[string]uint64
+}
+
+func newPlausibility() *plausibility {
+	return &plausibility{states: map[string]*plausibleState{}, anomalies: map[string]uint64{}}
+}
+
+// filter checks the locations of the tracked vessels and sets the Anomaly
+// of implausible ones. With cfg.KeepLastPlausible they are replaced by the
+// vessel's last plausible report, if there is one. The cluster check counts
+// the sightings, the coordinates of every vessel in the refresh, since the
+// locations are usually those of the targets only.
+func (p *plausibility) filter(cfg config.Config, locations, sightings []models.LocationRecord, tracked func(models.LocationRecord) bool) []models.LocationRecord {
+	points := append([]config.SpoofingPoint{nullIsland}, cfg.SpoofingPoints...)
+	clustered := clusters(sightings)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, loc := range locations {
+		if loc.MMSI == "" || math.IsNaN(loc.Latitude) || math.IsNaN(loc.Longitude) || !tracked(loc) {
+			continue
+		}
+		locations[i] = p.verdict(cfg, loc, staticAnomaly(loc, points, clustered))
+	}
+	return locations
+}
+
+// check checks a single location of a tracked vessel, as received from a
+// push source, like filter does. Without the other vessels of a refresh
+// the cluster check does not apply.
+func (p *plausibility) check(cfg config.Config, loc models.LocationRecord) models.LocationRecord {
+	if loc.MMSI == "" || math.IsNaN(loc.Latitude) || math.IsNaN(loc.Longitude) {
+		return loc
+	}
+	points := append([]config.SpoofingPoint{nullIsland}, cfg.SpoofingPoints...)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.verdict(cfg, loc, staticAnomaly(loc, points, nil))
+}
+
+// verdict records the checks of loc that failed for reason, if any, and
+// returns loc flagged, or replaced by the last plausible report.
+func (p *plausibility) verdict(cfg config.Config, loc models.LocationRecord, reason string) models.LocationRecord {
+	reason = p.observe(loc, reason)
+	if reason == "" {
+		return loc
+	}
+	loc.Anomaly = reason
+	if s := p.states[loc.MMSI]; cfg.KeepLastPlausible && s.hasLast {
+		return s.last
+	}
+	return loc
+}
+
+// observe records a report that failed the location checks for reason, or
+// passed them if reason is empty, and returns its verdict. Reports older
+// than the latest checked one are not counted and not checked for speed.
+func (p *plausibility) observe(loc models.LocationRecord, reason string) string {
+	s, ok := p.states[loc.MMSI]
+	if !ok {
+		s = &plausibleState{}
+		p.states[loc.MMSI] = s
+	}
+	switch {
+	case s.checked != 0 && loc.Timestamp == s.checked:
+		return s.verdict
+	case loc.Timestamp < s.checked:
+		return reason
+	}
+
+	if reason == "" && s.hasLast && loc.Timestamp > s.last.Timestamp {
+		dist := geo.GeodesicDistance(geo.Point{Lon: s.last.Longitude, Lat: s.last.Latitude}, geo.Point{Lon: loc.Longitude, Lat: loc.Latitude})
+		if impliedKnots(dist, loc.Timestamp-s.last.Timestamp) > maxPlausibleSpeedKnots {
+			if s.streak++; s.streak < reanchorAfter {
+				reason = anomalySpeed
+				s.jumps++
+			} else {
+				s.reanchored = loc.Timestamp
+			}
+		}
+	}
+
+	s.checked, s.verdict = loc.Timestamp, reason
+	if reason == "" {
+		s.last, s.hasLast, s.streak = loc, true, 0
+		return ""
+	}
+	p.anomalies[reason]++
+	slog.Warn("implausible position report", "mmsi", loc.MMSI, "reason", reason, "latitude", loc.Latitude, "longitude", loc.Longitude)
+	return reason
+}
+
+// retain forgets vessels that are no longer tracked.
+func (p *plausibility) retain(positions []models.IcebreakerPosition) {
+	mmsis := make(map[string]struct{}, len(positions))
+	for _, pos := range positions {
+		mmsis[pos.MMSI] = struct{}{}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for mmsi := range p.states {
+		if _, ok := mmsis[mmsi]; !ok {
+			delete(p.states, mmsi)
+		}
+	}
+}
+
+// vessel returns why the latest report of the vessel failed the checks,
+// empty if it passed them, and how many of its reports failed the speed
+// check. With cfg.KeepLastPlausible the exported position no longer carries
+// the reason.
+func (p *plausibility) vessel(mmsi string) (reason string, jumps uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if s, ok := p.states[mmsi]; ok {
+		return s.verdict, s.jumps
+	}
+	return "", 0
+}
+
+// reanchored reports whether pos was accepted although it is out of reach
+// of the vessel's previous plausible position.
+func (p *plausibility) reanchored(pos models.IcebreakerPosition) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.states[pos.MMSI]
+	return ok && s.reanchored != 0 && s.reanchored == pos.Timestamp
+}
+
+// counts returns the number of implausible reports by reason.
+func (p *plausibility) counts() map[string]uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := make(map[string]uint64, len(anomalyReasons))
+	for _, reason := range anomalyReasons {
+		out[reason] = p.anomalies[reason]
+	}
+	return out
+}
+
+// plausible returns the positions that passed the checks. Flagged reports
+// are exported, but add no track points, distance, navigation states, zone
+// crossings or assists.
+func plausible(positions []models.IcebreakerPosition) []models.IcebreakerPosition {
+	out := make([]models.IcebreakerPosition, 0, len(positions))
+	for _, pos := range positions {
+		if pos.Anomaly == "" {
+			out = append(out, pos)
+		}
+	}
+	return out
+}
+
+// staticAnomaly runs the checks that need no earlier report. The cluster
+// check is skipped when clustered is nil.
+func staticAnomaly(loc models.LocationRecord, points []config.SpoofingPoint, clustered map[[2]int64]bool) string {
+	pt := geo.Point{Lon: loc.Longitude, Lat: loc.Latitude}
+	for _, sp := range points {
+		if geo.Distance(pt, geo.Point{Lon: sp.Longitude, Lat: sp.Latitude}) <= sp.Radius*geo.MetersPerNauticalMile {
+			return anomalySpoofing
+		}
+	}
+	if clustered[coordinateKey(loc)] {
+		return anomalyCluster
+	}
+	if land.Contains(loc.Longitude, loc.Latitude) {
+		return anomalyLand
+	}
+	return ""
+}
+
+// clusters returns the coordinates reported by at least clusterMinVessels
+// distinct vessels. Moored ships lie tens of metres apart; identical fixes
+// are a spoofer's.
+func clusters(locations []models.LocationRecord) map[[2]int64]bool {
+	vessels := map[[2]int64]map[string]struct{}{}
+	for _, loc := range locations {
+		if loc.MMSI == "" {
+			continue
+		}
+		key := coordinateKey(loc)
+		if vessels[key] == nil {
+			vessels[key] = map[string]struct{}{}
+		}
+		vessels[key][loc.MMSI] = struct{}{}
+	}
+	out := map[[2]int64]bool{}
+	for key, mmsis := range vessels {
+		if len(mmsis) >= clusterMinVessels {
+			out[key] = true
+		}
+	}
+	return out
+}
+
+// coordinateKey rounds a location to about a metre.
+func coordinateKey(loc models.LocationRecord) [2]int64 {
+	return [2]int64{int64(math.Round(loc.Latitude * 1e5)), int64(math.Round(loc.Longitude * 1e5))}
+}
+
+// trackedLocation reports whether SelectTargetPositions would pick a
+// location for a target vessel.
+func trackedLocation(vessels []models.VesselMetadata, targets *config.Targets) func(models.LocationRecord) bool {
+	selected := map[string]struct{}{}
+	for _, v := range vessels {
+		if _, ok := targets.Match(v.MMSI, v.Name, v.IMO); ok {
+			selected[v.MMSI] = struct{}{}
+		}
+	}
+	return func(loc models.LocationRecord) bool {
+		if _, ok := selected[loc.MMSI]; ok {
+			return true
+		}
+		_, ok := targets.Match(loc.MMSI, strings.TrimSpace(loc.Name), 0)
+		return ok
+	}
+}
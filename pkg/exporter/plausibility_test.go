@@ -0,0 +1,211 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+func TestPlausibilityFilter(t *testing.T) {
+	p := newPlausibility()
+	cfg := config.Config{SpoofingPoints: []config.SpoofingPoint{{Name: "Pulkovo", Latitude: 59.8, Longitude: 30.26, Radius: 2}}}
+	all := func(models.LocationRecord) bool { return true }
+	report := func(lat, lon float64, ts int64) models.LocationRecord {
+		return models.LocationRecord{MMSI: "230252000", Latitude: lat, Longitude: lon, Timestamp: ts}
+	}
+
+	steps := []struct {
+		lat, lon float64
+		ts       int64
+		want     string
+	}{
+		{65.6, 24.4, 1000, ""},
+		{65.61, 24.4, 1060, ""},
+		{65.61, 24.4, 1060, ""},                // returned again by the next refresh
+		{60.2, 25.0, 1120, anomalySpeed},       // Helsinki a minute later
+		{60.2, 25.0, 1120, anomalySpeed},       // counted once
+		{59.801, 30.26, 1180, anomalySpoofing}, // configured point
+		{0, 0, 1240, anomalySpoofing},          // Null Island
+		{62.24, 25.75, 1300, anomalyLand},      // Jyväskylä
+		{65.62, 24.4, 1360, ""},                // back on track
+		{60.2, 25.0, 1420, anomalySpeed},
+		{60.21, 25.0, 1480, anomalySpeed},
+		{60.22, 25.0, 1540, ""}, // third in a row: the vessel is there
+		{60.23, 25.0, 1600, ""},
+		{62.24, 25.75, 1500, anomalyLand}, // older: checked, not counted
+	}
+	for i, step := range steps {
+		locations := []models.LocationRecord{report(step.lat, step.lon, step.ts)}
+		got := p.filter(cfg, locations, locations, all)[0]
+		if got.Anomaly != step.want {
+			t.Errorf("step %d (%g, %g): got anomaly %q, want %q", i, step.lat, step.lon, got.Anomaly, step.want)
+		}
+	}
+
+	// Keeping the last plausible position replaces the report; it is still
+	// counted.
+	cfg.KeepLastPlausible = true
+	locations := []models.LocationRecord{report(62.24, 25.75, 1660)}
+	got := p.filter(cfg, locations, locations, all)[0]
+	if got.Anomaly != "" || got.Latitude != 60.23 || got.Timestamp != 1600 {
+		t.Errorf("expected the last plausible position, got %+v", got)
+	}
+
+	// Three vessels at identical coordinates are spoofed; only tracked
+	// vessels are counted.
+	batch := []models.LocationRecord{
+		report(60.24, 25.0, 1720),
+		{MMSI: "230000001", Latitude: 60.24, Longitude: 25.0, Timestamp: 1720},
+		{MMSI: "230000002", Latitude: 60.24, Longitude: 25.0, Timestamp: 1720},
+		{MMSI: "230000003", Latitude: 60.3, Longitude: 25.1, Timestamp: 1720},
+	}
+	cfg.KeepLastPlausible = false
+	batch = p.filter(cfg, batch, batch, func(loc models.LocationRecord) bool { return loc.MMSI == "230252000" })
+	if batch[0].Anomaly != anomalyCluster || batch[1].Anomaly != "" {
+		t.Errorf("unexpected cluster verdicts %+v", batch)
+	}
+
+	if s := p.states["230252000"]; s.jumps != 3 || s.reanchored != 1540 {
+		t.Errorf("expected 3 jumps and a reanchor at 1540, got %d and %d", s.jumps, s.reanchored)
+	}
+
+	want := map[string]uint64{anomalySpeed: 3, anomalySpoofing: 2, anomalyLand: 2, anomalyCluster: 1}
+	for reason, n := range p.counts() {
+		if n != want[reason] {
+			t.Errorf("%s: got %d anomalies, want %d", reason, n, want[reason])
+		}
+	}
+
+	p.retain(nil)
+	if len(p.states) != 0 {
+		t.Error("expected untracked vessels to be forgotten")
+	}
+}
+
+func TestFetchPositionsCluster(t *testing.T) {
+	// The default strategy only decodes the target's location; the other
+	// vessels at OTSO's coordinates are sightings.
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vessels", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, testVesselsJSON)
+	})
+	mux.HandleFunc("/locations", func(w http.ResponseWriter, _ *http.Request) {
+		feature := func(mmsi int, lon, lat float64) string {
+			return fmt.Sprintf(`{"type":"Feature","mmsi":%d,"geometry":{"type":"Point","coordinates":[%g,%g]},"properties":{"mmsi":%d,"timestampExternal":1700000000000}}`, mmsi, lon, lat, mmsi)
+		}
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","dataUpdatedTime":"2023-11-14T22:13:20Z","features":[`+
+			feature(230124000, 24.9, 60.1)+","+feature(111111111, 24.9, 60.1)+","+feature(222222222, 24.9, 60.1)+","+feature(333333333, 25.0, 60.2)+`]}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cfg := config.Config{
+		VesselsURL:         srv.URL + "/vessels",
+		LocationsURL:       srv.URL + "/locations",
+		RequestTimeout:     time.Second,
+		Targets:            config.NewTargets(config.ParseVesselNames("OTSO")),
+		Parser:             config.ParserTyped,
+		FetchStrategy:      config.FetchFull,
+		IncrementalRefresh: true,
+	}
+	exp := New(cfg)
+	positions, err := exp.fetchPositions(t.Context(), exp.client(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 || positions[0].Anomaly != anomalyCluster {
+		t.Fatalf("expected OTSO to be flagged as part of a cluster, got %+v", positions)
+	}
+
+	cfg.IncrementalRefresh = false
+	exp = New(cfg)
+	if positions, err = exp.fetchPositions(t.Context(), exp.client(), cfg); err != nil || positions[0].Anomaly != anomalyCluster {
+		t.Errorf("expected the typed full fetch to flag the cluster, got %+v, %v", positions, err)
+	}
+}
+
+func TestPlausibilityCheck(t *testing.T) {
+	p := newPlausibility()
+	cfg := config.Config{KeepLastPlausible: true}
+	report := func(lat, lon float64, ts int64) models.LocationRecord {
+		return models.LocationRecord{MMSI: "230252000", Latitude: lat, Longitude: lon, Timestamp: ts}
+	}
+
+	if got := p.check(cfg, report(65.6, 24.4, 1000)); got.Anomaly != "" {
+		t.Errorf("expected a plausible report, got %+v", got)
+	}
+	got := p.check(cfg, report(62.24, 25.75, 1060)) // Jyväskylä
+	if got.Anomaly != "" || got.Latitude != 65.6 {
+		t.Errorf("expected the last plausible position, got %+v", got)
+	}
+	if n := p.counts()[anomalyLand]; n != 1 {
+		t.Errorf("expected one land anomaly, got %d", n)
+	}
+}
+
+func TestFetchPositionsPlausibility(t *testing.T) {
+	_, cfg := newTestAPI(t)
+	cfg.Parser = config.ParserTyped
+	cfg.SpoofingPoints = []config.SpoofingPoint{{Latitude: 60.1, Longitude: 24.9, Radius: 1}}
+
+	exp := New(cfg)
+	positions, err := exp.fetchPositions(t.Context(), exp.client(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(positions) != 1 || positions[0].Anomaly != anomalySpoofing {
+		t.Fatalf("expected a flagged position, got %+v", positions)
+	}
+
+	exp.snapshot = models.Snapshot{Positions: positions}
+	rr := httptest.NewRecorder()
+	exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+	for _, want := range []string{
+		`icebreaker_position_anomalies_total{reason="spoofing_point"} 1`,
+		`icebreaker_position_anomalies_total{reason="land"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in output:\n%s", want, body)
+		}
+	}
+}
+
+func TestApplyLiveLocationImplausible(t *testing.T) {
+	exp := New(config.Config{Targets: config.NewTargets(config.ParseVesselNames("OTSO")), HistoryRetention: time.Hour, HistoryMaxPoints: 10})
+	now := time.Now().Unix()
+	exp.snapshot = models.Snapshot{Positions: []models.IcebreakerPosition{{Name: "OTSO", MMSI: "230252000", Country: "FI", Latitude: 65.6, Longitude: 24.4, Timestamp: now - 120}}}
+
+	exp.applyLiveLocation(models.LocationRecord{MMSI: "230252000", Latitude: 65.61, Longitude: 24.4, Timestamp: now - 60})
+	exp.applyLiveLocation(models.LocationRecord{MMSI: "230252000", Latitude: 62.24, Longitude: 25.75, Timestamp: now}) // Jyväskylä
+
+	pos := exp.GetSnapshot().Positions[0]
+	if pos.Anomaly != anomalyLand || pos.Latitude != 62.24 {
+		t.Fatalf("expected the flagged report to be exported, got %+v", pos)
+	}
+	if track := exp.history.Track("230252000", time.Time{}); len(track) != 1 || track[0].Latitude != 65.61 {
+		t.Errorf("expected the flagged report to stay out of the track, got %+v", track)
+	}
+	if m, ok := exp.motion.state("230252000"); !ok || m.timestamp != now-60 {
+		t.Errorf("expected the flagged report to stay out of the kinematics, got %+v", m)
+	}
+
+	rr := httptest.NewRecorder()
+	exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+	for _, want := range []string{
+		`icebreaker_position_implausible{vessel_name="OTSO",mmsi="230252000",country="FI",reason="land"} 1`,
+		`icebreaker_position_implausible{vessel_name="OTSO",mmsi="230252000",country="FI",reason="speed"} 0`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in output:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+)
+
+// Reload parses the configuration again from the arguments and config file it
+// was loaded from and, if it is valid, replaces the current one. The refresh
+// loop is rescheduled and the MQTT stream resubscribes. Settings bound at
+// startup (listen address, metrics path, storage and the streaming and NMEA
+// sources) keep their value until a restart.
+func (e *Exporter) Reload() error {
+	e.reloadMu.Lock()
+	defer e.reloadMu.Unlock()
+
+	err := e.reload()
+	e.reloadSuccess.Store(err == nil)
+	if err != nil {
+		slog.Error("config reload failed", "error", err)
+		return err
+	}
+	e.lastReload.Store(time.Now().Unix())
+	return nil
+}
+
+func (e *Exporter) reload() error {
+	old := e.currentConfig()
+	cfg, err := config.Parse(old.Args)
+	if err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	for _, s := range []struct {
+		flag     string
+		old, new *string
+	}{
+		{"listen-address", &old.ListenAddress, &cfg.ListenAddress},
+		{"metrics-path", &old.MetricsPath, &cfg.MetricsPath},
+		{"storage.path", &old.StoragePath, &cfg.StoragePath},
+		{"mqtt-url", &old.MQTTURL, &cfg.MQTTURL},
+		{"nmea-tcp-address", &old.NMEATCPAddress, &cfg.NMEATCPAddress},
+		{"nmea-udp-address", &old.NMEAUDPAddress, &cfg.NMEAUDPAddress},
+		{"nmea-file", &old.NMEAFile, &cfg.NMEAFile},
+	} {
+		if *s.new != *s.old {
+			slog.Warn("setting changed on reload, restart to apply it", "flag", s.flag)
+			*s.new = *s.old
+		}
+	}
+
+	// Keep the client, and with it the circuit breaker state and cache
+	// validators, unless its settings changed.
+	if clientSettingsChanged(old, cfg) {
+		e.api.Store(newClient(cfg))
+	}
+	e.cfg.Store(&cfg)
+	e.resolver.invalidate()
+	if targetsChanged(old.Vessels, cfg.Vessels) {
+		// The vessels list kept by incremental refreshes was filtered by the
+		// old targets, and a conditional request would not replace it.
+		e.delta.reset()
+	}
+	e.history.SetLimits(cfg.HistoryRetention, cfg.HistoryMaxPoints)
+
+	select {
+	case e.reloaded <- struct{}{}:
+	default:
+	}
+	slog.Info("configuration reloaded", "vessels", cfg.Targets.Len(), "refreshInterval", cfg.RefreshInterval)
+	return nil
+}
+
+// targetsChanged reports whether the vessel definitions match different
+// vessels.
+func targetsChanged(a, b []config.Vessel) bool {
+	return !slices.EqualFunc(a, b, func(x, y config.Vessel) bool {
+		return x.Name == y.Name && x.MMSI == y.MMSI && x.IMO == y.IMO
+	})
+}
+
+func clientSettingsChanged(a, b config.Config) bool {
+	return a.VesselsURL != b.VesselsURL ||
+		a.LocationsURL != b.LocationsURL ||
+		a.DigitrafficUser != b.DigitrafficUser ||
+		a.RetryMaxAttempts != b.RetryMaxAttempts ||
+		a.RetryBaseDelay != b.RetryBaseDelay ||
+		a.RetryMaxDelay != b.RetryMaxDelay ||
+		a.BreakerThreshold != b.BreakerThreshold ||
+		a.BreakerCooldown != b.BreakerCooldown
+}
+
+// ReloadHandler reloads the configuration on POST requests.
+func (e *Exporter) ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST requests allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := e.Reload(); err != nil {
+		http.Error(w, fmt.Sprintf("failed to reload config: %s", err), http.StatusInternalServerError)
+		return
+	}
+	_, _ = io.WriteString(w, "ok\n")
+}
@@ -0,0 +1,141 @@
+package exporter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+)
+
+func TestReload(t *testing.T) {
+	_, base := newTestAPI(t)
+	path := filepath.Join(t.TempDir(), "config.yml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("settings:\n  refresh-interval: 1m\nvessels:\n  - name: OTSO\n    fleet: finnish\n")
+
+	cfg, err := config.Parse([]string{"-config.file", path, "-vessels-url", base.VesselsURL, "-locations-url", base.LocationsURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := New(cfg)
+	exp.Refresh(context.Background())
+	api := exp.client()
+
+	scrape := func() string {
+		rr := httptest.NewRecorder()
+		exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rr.Body.String()
+	}
+	if body := scrape(); !strings.Contains(body, `fleet="finnish"`) {
+		t.Fatalf("expected fleet label before reload:\n%s", body)
+	}
+
+	write("settings:\n  refresh-interval: 5m\n  listen-address: \":9999\"\nvessels:\n  - name: OTSO\n    fleet: arctia\n")
+	rr := httptest.NewRecorder()
+	exp.ReloadHandler(rr, httptest.NewRequest(http.MethodPost, "/-/reload", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("reload returned %d: %s", rr.Code, rr.Body.String())
+	}
+	select {
+	case <-exp.reloaded:
+	default:
+		t.Error("expected the refresh loop to be notified")
+	}
+
+	got := exp.currentConfig()
+	if got.RefreshInterval != 5*time.Minute {
+		t.Errorf("expected refresh interval 5m after reload, got %v", got.RefreshInterval)
+	}
+	if got.ListenAddress != cfg.ListenAddress {
+		t.Errorf("expected listen address to need a restart, got %q", got.ListenAddress)
+	}
+	if exp.client() != api {
+		t.Error("expected the client to be kept when its settings did not change")
+	}
+	body := scrape()
+	for _, want := range []string{`fleet="arctia"`, "icebreaker_config_last_reload_successful 1"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q after reload:\n%s", want, body)
+		}
+	}
+
+	write("settings:\n  fetch-strategy: bogus\n")
+	if err := exp.Reload(); err == nil || !strings.Contains(err.Error(), "fetch-strategy") {
+		t.Fatalf("expected invalid config to be rejected, got %v", err)
+	}
+	if exp.currentConfig().RefreshInterval != 5*time.Minute {
+		t.Error("expected the previous config to stay in place")
+	}
+	if body := scrape(); !strings.Contains(body, "icebreaker_config_last_reload_successful 0") {
+		t.Errorf("expected failed reload to be reported:\n%s", body)
+	}
+}
+
+func TestReloadNewTargetsNotModified(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vessels", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = io.WriteString(w, `[{"mmsi":230252000,"name":"OTSO"},{"mmsi":230253000,"name":"KONTIO"}]`)
+	})
+	mux.HandleFunc("/locations", func(w http.ResponseWriter, _ *http.Request) {
+		feature := func(mmsi int, lat float64) string {
+			return fmt.Sprintf(`{"type":"Feature","mmsi":%d,"geometry":{"type":"Point","coordinates":[24.0,%g]},"properties":{"mmsi":%d,"timestampExternal":1700000000000}}`, mmsi, lat, mmsi)
+		}
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[`+feature(230252000, 65)+`,`+feature(230253000, 64)+`]}`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "config.yml")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("vessels:\n  - name: OTSO\n")
+	cfg, err := config.Parse([]string{"-config.file", path, "-vessels-url", srv.URL + "/vessels", "-locations-url", srv.URL + "/locations"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := New(cfg)
+	exp.Refresh(context.Background())
+	if n := len(exp.GetSnapshot().Positions); n != 1 {
+		t.Fatalf("expected one position before reload, got %d", n)
+	}
+
+	write("vessels:\n  - name: OTSO\n  - name: KONTIO\n")
+	if err := exp.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	exp.Refresh(context.Background())
+	if n := len(exp.GetSnapshot().Positions); n != 2 {
+		t.Errorf("expected the added vessel despite an unchanged vessels list, got %d positions", n)
+	}
+}
+
+func TestReloadHandlerMethod(t *testing.T) {
+	exp := New(config.Config{})
+	rr := httptest.NewRecorder()
+	exp.ReloadHandler(rr, httptest.NewRequest(http.MethodGet, "/-/reload", nil))
+	if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("expected 405 with Allow: POST, got %d %q", rr.Code, rr.Header().Get("Allow"))
+	}
+}
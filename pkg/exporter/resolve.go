@@ -0,0 +1,51 @@
+package exporter
+
+import (
+	"sync"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// mmsiResolver caches the name to MMSI mapping used by the targeted fetch
+// strategy so the full vessels list is only downloaded when needed.
+type mmsiResolver struct {
+	mu       sync.Mutex
+	vessels  []models.VesselMetadata
+	resolved time.Time
+	stale    bool
+}
+
+// cached returns the resolved vessels, or false when they have to be
+// resolved again because they expired or were invalidated.
+func (r *mmsiResolver) cached(ttl time.Duration, now time.Time) ([]models.VesselMetadata, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stale || r.resolved.IsZero() || (ttl > 0 && now.Sub(r.resolved) >= ttl) {
+		return nil, false
+	}
+	return r.vessels, true
+}
+
+func (r *mmsiResolver) store(vessels []models.VesselMetadata, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.vessels = vessels
+	r.resolved = now
+	r.stale = false
+}
+
+// invalidate forces a resolution on the next refresh, e.g. when a vessel
+// was renamed or an MMSI no longer reports a position.
+func (r *mmsiResolver) invalidate() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stale = true
+}
+
+// current returns the last resolution, stale or not.
+func (r *mmsiResolver) current() ([]models.VesselMetadata, time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.vessels, r.resolved
+}
@@ -0,0 +1,100 @@
+package exporter
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+	"github.com/joluc/icebreaker-exporter/pkg/storage"
+)
+
+// UseStorage restores the state persisted under dir and persists refreshes,
+// live positions and resolved MMSIs there from then on. It must be called
+// before the refresh loop starts.
+func (e *Exporter) UseStorage(dir string) error {
+	store, state, err := storage.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open storage: %w", err)
+	}
+	if state.Discarded > 0 {
+		slog.Warn("discarded incomplete records at the end of the storage log", "bytes", state.Discarded)
+	}
+
+	cfg := e.currentConfig()
+	snapshot := state.Snapshot
+	// Drop vessels that are no longer configured.
+	snapshot.Positions = nil
+	for _, pos := range state.Snapshot.Positions {
+		if _, ok := cfg.Targets.Match(pos.MMSI, pos.Name, pos.IMO); ok {
+			snapshot.Positions = append(snapshot.Positions, pos)
+		}
+	}
+	e.mu.Lock()
+	e.snapshot = snapshot
+	e.mu.Unlock()
+
+	e.history.Restore(state.Tracks)
+	if !state.Resolved.At.IsZero() && state.Resolved.Key == targetsKey(cfg.Vessels) {
+		e.resolver.store(state.Resolved.Vessels, state.Resolved.At)
+		e.persistedResolve = state.Resolved.At
+	}
+	e.store = store
+
+	slog.Info("restored state from storage", "path", dir, "positions", len(snapshot.Positions), "tracks", len(state.Tracks))
+	return nil
+}
+
+// targetsKey identifies the vessel definitions a resolution is valid for.
+func targetsKey(vessels []config.Vessel) string {
+	keys := make([]string, 0, len(vessels))
+	for _, v := range vessels {
+		keys = append(keys, config.NormalizeName(v.Name)+"/"+v.MMSI+"/"+strconv.Itoa(v.IMO))
+	}
+	return strings.Join(keys, ",")
+}
+
+func (e *Exporter) persistRefresh(s models.Snapshot) {
+	if e.store == nil {
+		return
+	}
+	if err := e.store.SaveSnapshot(s); err != nil {
+		slog.Warn("failed to persist snapshot", "error", err)
+	}
+
+	if vessels, at := e.resolver.current(); !at.IsZero() && !at.Equal(e.persistedResolve) {
+		resolved := storage.Resolved{Key: targetsKey(e.currentConfig().Vessels), Vessels: vessels, At: at}
+		if err := e.store.SaveResolved(resolved); err != nil {
+			slog.Warn("failed to persist resolved MMSIs", "error", err)
+		} else {
+			e.persistedResolve = at
+		}
+	}
+
+	if e.store.NeedsCompaction() {
+		// Live positions are applied to the snapshot and history before they
+		// are saved, so the state taken while appends are blocked has them.
+		err := e.store.Compact(func() storage.State {
+			vessels, at := e.resolver.current()
+			return storage.State{
+				Snapshot: e.GetSnapshot(),
+				Resolved: storage.Resolved{Key: targetsKey(e.currentConfig().Vessels), Vessels: vessels, At: at},
+				Tracks:   e.history.Tracks(),
+			}
+		})
+		if err != nil {
+			slog.Warn("failed to compact storage", "error", err)
+		}
+	}
+}
+
+func (e *Exporter) persistPosition(pos models.IcebreakerPosition) {
+	if e.store == nil {
+		return
+	}
+	if err := e.store.SavePosition(pos); err != nil {
+		slog.Warn("failed to persist position", "mmsi", pos.MMSI, "error", err)
+	}
+}
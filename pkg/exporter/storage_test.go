@@ -0,0 +1,54 @@
+package exporter
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+)
+
+func TestUseStorageRestoresState(t *testing.T) {
+	api, cfg := newTestAPI(t)
+	cfg.Vessels = config.ParseVesselNames("OTSO")
+	cfg.FetchStrategy = config.FetchTargeted
+	cfg.Parser = config.ParserTyped
+	cfg.HistoryRetention = 100 * 365 * 24 * time.Hour
+	cfg.HistoryMaxPoints = 10
+	dir := t.TempDir()
+
+	exp := New(cfg)
+	if err := exp.UseStorage(dir); err != nil {
+		t.Fatal(err)
+	}
+	exp.Refresh(context.Background())
+	if exp.GetSnapshot().LastRefreshError != "" {
+		t.Fatalf("refresh failed: %s", exp.GetSnapshot().LastRefreshError)
+	}
+	exp.store.Close()
+
+	restarted := New(cfg)
+	if err := restarted.UseStorage(dir); err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	restarted.HealthHandler(rr, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected restored state to be healthy, got %d", rr.Code)
+	}
+	if s := restarted.GetSnapshot(); len(s.Positions) != 1 || s.Positions[0].MMSI != "230124000" {
+		t.Errorf("expected the OTSO position to be restored, got %+v", s.Positions)
+	}
+	if got := restarted.history.Track("230124000", time.Time{}); len(got) != 1 {
+		t.Errorf("expected the track to be restored, got %+v", got)
+	}
+
+	// The restored resolution is reused instead of downloading the vessels list.
+	calls := api.vesselCalls.Load()
+	restarted.Refresh(context.Background())
+	if api.vesselCalls.Load() != calls {
+		t.Error("expected the persisted MMSI resolution to be reused")
+	}
+}
@@ -0,0 +1,296 @@
+package exporter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/digitraffic"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+	"github.com/joluc/icebreaker-exporter/pkg/mqtt"
+	"github.com/joluc/icebreaker-exporter/pkg/websocket"
+)
+
+// errConfigReloaded ends an MQTT session so that it subscribes to the
+// vessels of the reloaded configuration.
+var errConfigReloaded = errors.New("configuration reloaded")
+
+// errTargetsChanged ends an MQTT session so that it subscribes to the
+// vessels a refresh newly found or no longer finds.
+var errTargetsChanged = errors.New("tracked vessels changed")
+
+const (
+	mqttKeepAlive    = 30 * time.Second
+	mqttMinReconnect = time.Second
+)
+
+// StreamLoop keeps the snapshot current from the Digitraffic MQTT feed. The
+// initial REST refresh resolves the MMSIs to subscribe to; whenever the
+// stream is unavailable the exporter falls back to REST polling at
+// RefreshInterval while it keeps trying to reconnect. While streaming, a
+// refresh every ResolveInterval finds targets that were not located before;
+// it keeps streamed positions that are newer than the REST ones.
+// With assist detection the other vessels are still downloaded at
+// RefreshInterval while streaming.
+func (e *Exporter) StreamLoop(ctx context.Context) {
+	e.Refresh(ctx)
+	lastPoll := time.Now()
+
+	backoff := min(mqttMinReconnect, e.currentConfig().RefreshInterval)
+	for {
+		connected, err := e.stream(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		interval := e.currentConfig().RefreshInterval
+		switch {
+		case errors.Is(err, errConfigReloaded):
+			slog.Info("resubscribing to mqtt stream after config reload")
+		case errors.Is(err, errTargetsChanged):
+			slog.Info("resubscribing to mqtt stream for changed vessels")
+		default:
+			slog.Warn("mqtt stream unavailable, falling back to polling", "error", err)
+		}
+
+		if connected {
+			// We just lost a working stream or the vessel list changed: poll
+			// immediately to cover the gap and resolve the MMSIs.
+			backoff = min(mqttMinReconnect, interval)
+			e.Refresh(ctx)
+			lastPoll = time.Now()
+		} else if time.Since(lastPoll) >= interval {
+			e.Refresh(ctx)
+			lastPoll = time.Now()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, interval)
+	}
+}
+
+// stream runs one MQTT session. It reports whether the subscription was
+// established before the session ended. A config reload ends the session
+// with errConfigReloaded, a refresh that changes the tracked vessels with
+// errTargetsChanged.
+func (e *Exporter) stream(ctx context.Context) (bool, error) {
+	select {
+	case <-e.reloaded:
+		// The vessel list changed while the stream was down.
+		e.Refresh(ctx)
+	default:
+	}
+
+	cfg := e.currentConfig()
+	mmsis := e.trackedMMSIs()
+	if len(mmsis) == 0 {
+		return false, errors.New("no vessel MMSIs resolved yet")
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, cfg.RequestTimeout)
+	defer cancel()
+
+	conn, err := websocket.Dial(dialCtx, cfg.MQTTURL, []string{"mqtt"}, nil)
+	if err != nil {
+		return false, fmt.Errorf("dial %s: %w", cfg.MQTTURL, err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(cfg.RequestTimeout))
+	client, err := mqtt.Connect(conn, mqtt.Options{
+		ClientID:  mqttClientID(),
+		KeepAlive: mqttKeepAlive,
+	})
+	if err != nil {
+		_ = conn.Close()
+		return false, err
+	}
+	_ = conn.SetReadDeadline(time.Time{})
+	defer client.Close()
+
+	topics := make([]string, 0, 2*len(mmsis))
+	for _, mmsi := range mmsis {
+		topics = append(topics, digitraffic.TopicPrefix+mmsi+digitraffic.LocationSuffix, digitraffic.TopicPrefix+mmsi+digitraffic.MetadataSuffix)
+	}
+	if err := client.Subscribe(topics...); err != nil {
+		return false, fmt.Errorf("subscribe: %w", err)
+	}
+
+	e.streamConnected.Store(true)
+	defer e.streamConnected.Store(false)
+	slog.Info("streaming vessel updates from digitraffic mqtt", "vessels", len(mmsis))
+
+	sessionCtx, stop := context.WithCancelCause(ctx)
+	defer stop(nil)
+	if cfg.AssistEnabled {
+		go e.trafficLoop(sessionCtx, cfg.RefreshInterval)
+	}
+	go e.watchTargets(sessionCtx, stop, cfg.ResolveInterval, mmsis)
+
+	err = client.Run(sessionCtx, e.handleStreamMessage)
+	if cause := context.Cause(sessionCtx); errors.Is(cause, errConfigReloaded) || errors.Is(cause, errTargetsChanged) {
+		return true, cause
+	}
+	return true, err
+}
+
+// watchTargets ends the session on a config reload, or when a refresh every
+// interval finds other vessels than the subscribed mmsis. Zero interval
+// disables the refreshes.
+func (e *Exporter) watchTargets(ctx context.Context, stop context.CancelCauseFunc, interval time.Duration, mmsis []string) {
+	var resolve <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		resolve = ticker.C
+	}
+	subscribed := slices.Sorted(slices.Values(mmsis))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-e.reloaded:
+			stop(errConfigReloaded)
+			return
+		case <-resolve:
+			e.Refresh(ctx)
+			if tracked := slices.Sorted(slices.Values(e.trackedMMSIs())); ctx.Err() == nil && !slices.Equal(tracked, subscribed) {
+				stop(errTargetsChanged)
+				return
+			}
+		}
+	}
+}
+
+func (e *Exporter) handleStreamMessage(msg mqtt.Message) {
+	atomic.AddUint64(&e.streamMessages, 1)
+
+	rest, ok := strings.CutPrefix(msg.Topic, digitraffic.TopicPrefix)
+	if !ok {
+		return
+	}
+	mmsi, kind, ok := strings.Cut(rest, "/")
+	if !ok || mmsi == "" {
+		return
+	}
+
+	switch kind {
+	case "location":
+		var m digitraffic.StreamLocation
+		if err := json.Unmarshal(msg.Payload, &m); err != nil {
+			slog.Warn("invalid mqtt location message", "mmsi", mmsi, "error", err)
+			return
+		}
+		// Stream freshness is tracked on its own so that a live stream
+		// does not hide failing REST refreshes behind LastRefresh.
+		e.streamLastUpdate.Store(time.Now().Unix())
+		e.applyLiveLocation(m.Location(mmsi))
+	case "metadata":
+		var m digitraffic.StreamMetadata
+		if err := json.Unmarshal(msg.Payload, &m); err != nil {
+			slog.Warn("invalid mqtt metadata message", "mmsi", mmsi, "error", err)
+			return
+		}
+		e.applyStreamMetadata(mmsi, m)
+	}
+}
+
+// applyLiveLocation replaces the position of an already tracked vessel
+// unless the update is older than what we have. It is shared by all push
+// sources (MQTT and local AIS receivers). The positions slice is
+// copied so that snapshots handed out by GetSnapshot stay immutable.
+func (e *Exporter) applyLiveLocation(loc models.LocationRecord) {
+	if !e.tracks(loc.MMSI) {
+		return
+	}
+	loc = e.checks.check(e.currentConfig(), loc)
+	previous, pos, ok := e.updateLiveLocation(loc)
+	if !ok {
+		return
+	}
+	if pos.Anomaly == "" {
+		e.history.Add(pos.MMSI, pos.TrackPoint())
+		e.motion.observe(pos, e.checks.reanchored(pos))
+		e.navstate.observe(pos)
+	}
+	e.publishChanges([]models.IcebreakerPosition{previous}, []models.IcebreakerPosition{pos})
+	e.updateZones(plausible([]models.IcebreakerPosition{pos}))
+	e.persistPosition(pos)
+}
+
+func (e *Exporter) updateLiveLocation(loc models.LocationRecord) (previous, updated models.IcebreakerPosition, ok bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	i := slices.IndexFunc(e.snapshot.Positions, func(p models.IcebreakerPosition) bool { return p.MMSI == loc.MMSI })
+	if i < 0 {
+		return previous, updated, false
+	}
+	current := e.snapshot.Positions[i]
+	if loc.Timestamp < current.Timestamp {
+		return previous, updated, false
+	}
+
+	positions := slices.Clone(e.snapshot.Positions)
+	positions[i] = newPosition(models.VesselMetadata{Name: current.Name, Country: current.Country, StaticData: current.StaticData}, loc)
+	e.snapshot.Positions = positions
+	return current, positions[i], true
+}
+
+func (e *Exporter) applyStreamMetadata(mmsi string, m digitraffic.StreamMetadata) {
+	meta := m.Metadata()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	i := slices.IndexFunc(e.snapshot.Positions, func(p models.IcebreakerPosition) bool { return p.MMSI == mmsi })
+	if i < 0 {
+		return
+	}
+	current := e.snapshot.Positions[i]
+	static := current.StaticData.Merge(meta.StaticData)
+	if (meta.Name == "" || meta.Name == current.Name) && static == current.StaticData {
+		return
+	}
+
+	positions := slices.Clone(e.snapshot.Positions)
+	positions[i].StaticData = static
+	if meta.Name != "" {
+		positions[i].Name = meta.Name
+	}
+	e.snapshot.Positions = positions
+
+	if _, ok := e.currentConfig().Targets.Match(mmsi, positions[i].Name, positions[i].IMO); !ok {
+		e.resolver.invalidate()
+	}
+}
+
+func (e *Exporter) trackedMMSIs() []string {
+	s := e.GetSnapshot()
+	out := make([]string, 0, len(s.Positions))
+	for _, pos := range s.Positions {
+		out = append(out, pos.MMSI)
+	}
+	return out
+}
+
+// tracks reports whether the snapshot has a position of the vessel.
+func (e *Exporter) tracks(mmsi string) bool {
+	return slices.ContainsFunc(e.GetSnapshot().Positions, func(p models.IcebreakerPosition) bool { return p.MMSI == mmsi })
+}
+
+func mqttClientID() string {
+	var b [6]byte
+	_, _ = rand.Read(b[:])
+	return "icebreaker-exporter-" + hex.EncodeToString(b[:])
+}
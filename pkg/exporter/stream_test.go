@@ -0,0 +1,227 @@
+package exporter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/digitraffic"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+	"github.com/joluc/icebreaker-exporter/pkg/mqtt"
+	"github.com/joluc/icebreaker-exporter/pkg/mqtt/mqtttest"
+)
+
+const (
+	testVesselsJSON   = `[{"mmsi":230124000,"name":"OTSO"},{"mmsi":111111111,"name":"RANDOM"}]`
+	testLocationsJSON = `{"type":"FeatureCollection","features":[{"type":"Feature","mmsi":230124000,"geometry":{"type":"Point","coordinates":[24.9,60.1]},"properties":{"mmsi":230124000,"sog":1.0,"cog":10.0,"navStat":0,"rot":0,"heading":12,"timestamp":30,"timestampExternal":1700000000000}}]}`
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamLoop(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	var restCalls atomic.Int64
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vessels", func(w http.ResponseWriter, _ *http.Request) {
+		restCalls.Add(1)
+		_, _ = io.WriteString(w, testVesselsJSON)
+	})
+	mux.HandleFunc("/locations", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, testLocationsJSON)
+	})
+	mux.Handle("/mqtt", broker)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	exp := New(config.Config{
+		VesselsURL:      srv.URL + "/vessels",
+		LocationsURL:    srv.URL + "/locations",
+		MQTTURL:         "ws" + strings.TrimPrefix(srv.URL, "http") + "/mqtt",
+		RefreshInterval: 50 * time.Millisecond,
+		RequestTimeout:  time.Second,
+		Targets:         config.NewTargets(config.ParseVesselNames("OTSO")),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		exp.StreamLoop(ctx)
+		close(done)
+	}()
+
+	waitFor(t, "subscription", func() bool {
+		subs := broker.Subscriptions()
+		return len(subs) == 2 && subs[0] == "vessels-v2/230124000/location" && subs[1] == "vessels-v2/230124000/metadata"
+	})
+
+	broker.Publish("vessels-v2/230124000/location", []byte(`{"time":1700000100,"sog":12.3,"cog":180.5,"navStat":0,"rot":0,"heading":181,"lon":25.5,"lat":61.5}`))
+	waitFor(t, "streamed position", func() bool {
+		s := exp.GetSnapshot()
+		return len(s.Positions) == 1 && s.Positions[0].Latitude == 61.5
+	})
+	pos := exp.GetSnapshot().Positions[0]
+	if pos.Name != "OTSO" || pos.Timestamp != 1700000100 || *pos.SpeedOverGround != 12.3 || *pos.Heading != 181 {
+		t.Errorf("unexpected streamed position %+v", pos)
+	}
+
+	// Older reports must not overwrite newer ones.
+	broker.Publish("vessels-v2/230124000/location", []byte(`{"time":1700000050,"lon":1,"lat":1}`))
+	broker.Publish("vessels-v2/230124000/metadata", []byte(`{"name":"OTSO II"}`))
+	waitFor(t, "metadata update", func() bool { return exp.GetSnapshot().Positions[0].Name == "OTSO II" })
+	if lat := exp.GetSnapshot().Positions[0].Latitude; lat != 61.5 {
+		t.Errorf("stale location applied, latitude=%v", lat)
+	}
+
+	before := restCalls.Load()
+	broker.DisconnectAll()
+	waitFor(t, "REST fallback", func() bool { return restCalls.Load() > before })
+	waitFor(t, "reconnect", func() bool { return broker.Connects() >= 2 })
+
+	rr := httptest.NewRecorder()
+	exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rr.Body.String(), "icebreaker_stream_messages_total 3") {
+		t.Errorf("missing stream message counter:\n%s", rr.Body.String())
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("StreamLoop did not stop after cancel")
+	}
+}
+
+func TestStreamLoopResubscribesNewTargets(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	var located atomic.Bool
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vessels", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, `[{"mmsi":230124000,"name":"OTSO"},{"mmsi":230125000,"name":"KONTIO"}]`)
+	})
+	mux.HandleFunc("/locations", func(w http.ResponseWriter, _ *http.Request) {
+		if !located.Load() {
+			_, _ = io.WriteString(w, testLocationsJSON)
+			return
+		}
+		_, _ = io.WriteString(w, `{"type":"FeatureCollection","features":[`+
+			`{"type":"Feature","mmsi":230124000,"geometry":{"type":"Point","coordinates":[24.9,60.1]},"properties":{"mmsi":230124000,"timestampExternal":1700000000000}},`+
+			`{"type":"Feature","mmsi":230125000,"geometry":{"type":"Point","coordinates":[25.0,60.2]},"properties":{"mmsi":230125000,"timestampExternal":1700000000000}}]}`)
+	})
+	mux.Handle("/mqtt", broker)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	exp := New(config.Config{
+		VesselsURL:      srv.URL + "/vessels",
+		LocationsURL:    srv.URL + "/locations",
+		MQTTURL:         "ws" + strings.TrimPrefix(srv.URL, "http") + "/mqtt",
+		RefreshInterval: time.Minute,
+		ResolveInterval: 50 * time.Millisecond,
+		RequestTimeout:  time.Second,
+		Targets:         config.NewTargets(config.ParseVesselNames("OTSO,KONTIO")),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go exp.StreamLoop(ctx)
+
+	waitFor(t, "subscription", func() bool { return len(broker.Subscriptions()) == 2 })
+	located.Store(true)
+	waitFor(t, "resubscription", func() bool { return len(broker.Subscriptions()) == 4 })
+	if n := broker.Connects(); n != 2 {
+		t.Errorf("expected one reconnect, got %d connects", n)
+	}
+}
+
+func TestStreamLoopKeepsNewerStreamedPositions(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	var locationCalls atomic.Int64
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/vessels", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, testVesselsJSON)
+	})
+	mux.HandleFunc("/locations", func(w http.ResponseWriter, _ *http.Request) {
+		locationCalls.Add(1)
+		_, _ = io.WriteString(w, testLocationsJSON)
+	})
+	mux.Handle("/mqtt", broker)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	exp := New(config.Config{
+		VesselsURL:      srv.URL + "/vessels",
+		LocationsURL:    srv.URL + "/locations",
+		MQTTURL:         "ws" + strings.TrimPrefix(srv.URL, "http") + "/mqtt",
+		RefreshInterval: time.Minute,
+		ResolveInterval: 20 * time.Millisecond,
+		RequestTimeout:  time.Second,
+		Targets:         config.NewTargets(config.ParseVesselNames("OTSO")),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go exp.StreamLoop(ctx)
+
+	waitFor(t, "subscription", func() bool { return len(broker.Subscriptions()) == 2 })
+	broker.Publish("vessels-v2/230124000/location", []byte(`{"time":1700000100,"lon":25.5,"lat":61.5}`))
+	waitFor(t, "streamed position", func() bool { return exp.GetSnapshot().Positions[0].Latitude == 61.5 })
+	published := exp.feed.published.Load()
+
+	calls := locationCalls.Load()
+	waitFor(t, "refreshes", func() bool { return locationCalls.Load() >= calls+3 })
+	if pos := exp.GetSnapshot().Positions[0]; pos.Latitude != 61.5 || pos.Timestamp != 1700000100 {
+		t.Errorf("streamed position replaced by an older REST one: %+v", pos)
+	}
+	if n := exp.feed.published.Load(); n != published {
+		t.Errorf("expected no feed events from the refreshes, got %d", n-published)
+	}
+}
+
+func TestStreamLocationKeepsRefreshError(t *testing.T) {
+	exp := New(config.Config{MQTTURL: "ws://localhost/mqtt"})
+	exp.snapshot = models.Snapshot{
+		Positions:        []models.IcebreakerPosition{{MMSI: "230124000", Name: "OTSO", Timestamp: 1700000000}},
+		LastRefreshError: "digitraffic unavailable",
+	}
+
+	exp.handleStreamMessage(mqtt.Message{
+		Topic:   digitraffic.TopicPrefix + "230124000/location",
+		Payload: []byte(`{"time":1700000100,"lon":25.5,"lat":61.5}`),
+	})
+
+	s := exp.GetSnapshot()
+	if s.Positions[0].Latitude != 61.5 {
+		t.Fatalf("streamed position not applied: %+v", s.Positions[0])
+	}
+	if s.LastRefreshError == "" || !s.LastRefresh.IsZero() {
+		t.Errorf("stream update touched the REST refresh status: %+v", s)
+	}
+	if exp.streamLastUpdate.Load() == 0 {
+		t.Error("stream freshness not recorded")
+	}
+
+	rec := httptest.NewRecorder()
+	exp.HealthHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("healthz = %d while REST refreshes fail", rec.Code)
+	}
+}
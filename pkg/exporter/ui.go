@@ -0,0 +1,52 @@
+package exporter
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"strings"
+)
+
+// web holds the map UI. It loads nothing from third-party hosts: map tiles
+// come from -web.tile-url, and without it the bundled coastline is drawn.
+//
+//go:embed web
+var web embed.FS
+
+var indexTemplate = template.Must(template.ParseFS(web, "web/index.html"))
+
+// RootHandler serves the map UI: the page at / and its assets below it.
+// The page reaches the API through relative URLs, so it also works behind a
+// reverse proxy that adds a path prefix.
+func (e *Exporter) RootHandler() http.HandlerFunc {
+	assets, err := fs.Sub(web, "web")
+	if err != nil {
+		panic(err)
+	}
+	files := http.FileServerFS(assets)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Path != "/" {
+			files.ServeHTTP(w, r)
+			return
+		}
+
+		cfg := e.currentConfig()
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = indexTemplate.Execute(w, struct {
+			MetricsPath     string
+			TileURL         string
+			TileAttribution string
+		}{
+			MetricsPath:     strings.TrimPrefix(cfg.MetricsPath, "/"),
+			TileURL:         cfg.WebTileURL,
+			TileAttribution: cfg.WebTileAttribution,
+		})
+	}
+}
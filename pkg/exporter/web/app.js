@@ -0,0 +1,557 @@
+// Map UI of the icebreaker exporter. It draws on a canvas in Web Mercator
+// without third-party libraries, so that it works without internet access:
+// map tiles come from -web.tile-url, or the bundled coastline is drawn.
+"use strict";
+
+const TILE_SIZE = 256;
+const MIN_ZOOM = 2;
+const MAX_ZOOM = 16;
+const TRAIL_SECONDS = 6 * 3600;
+const STALE_SECONDS = 30 * 60;
+const POLL_MILLISECONDS = 60 * 1000;
+
+// ITU-R M.1371 navigation status texts and their marker colours.
+const NAV_STATUS = [
+  ["Under way using engine", "#2e9d4f"],
+  ["At anchor", "#2f6fd6"],
+  ["Not under command", "#d62f2f"],
+  ["Restricted manoeuvrability", "#e08a1e"],
+  ["Constrained by draught", "#9b59b6"],
+  ["Moored", "#6c7a89"],
+  ["Aground", "#8b1a1a"],
+  ["Engaged in fishing", "#1aa3a3"],
+  ["Under way sailing", "#7cc242"],
+  ["Reserved for HSC", "#a0a8b0"],
+  ["Reserved for WIG", "#a0a8b0"],
+  ["Towing astern", "#d4ac0d"],
+  ["Pushing ahead or towing alongside", "#d4ac0d"],
+  ["Reserved", "#a0a8b0"],
+  ["AIS-SART, MOB or EPIRB active", "#e91e63"],
+  ["Not defined", "#a0a8b0"],
+];
+const UNKNOWN_STATUS = ["Unknown", "#a0a8b0"];
+// Statuses shown in the legend; the others are rare for icebreakers.
+const LEGEND = [0, 1, 5, 3, 2, 12, 15];
+
+const tileURL = document.body.dataset.tiles;
+const canvas = document.getElementById("map");
+const ctx = canvas.getContext("2d");
+const listEl = document.getElementById("vessels");
+const detailsEl = document.getElementById("details");
+const statusEl = document.getElementById("status");
+
+const view = { lon: 22, lat: 62, zoom: 5 };
+const vessels = new Map(); // MMSI -> vessel as served by /api/v1/vessels
+const trails = new Map(); // MMSI -> [[lon, lat, timestamp]]
+const tiles = new Map();
+let coastline = [];
+let status = null;
+let live = false;
+let selected = null;
+let fitted = false;
+
+function navStatus(v) {
+  return NAV_STATUS[v.navigation_status] || UNKNOWN_STATUS;
+}
+
+function reportAge(v) {
+  return Date.now() / 1000 - v.timestamp;
+}
+
+function formatAge(seconds) {
+  seconds = Math.max(0, Math.round(seconds));
+  if (seconds < 60) return seconds + " s";
+  if (seconds < 3600) return Math.floor(seconds / 60) + " min";
+  if (seconds < 86400) return Math.floor(seconds / 3600) + " h";
+  return Math.floor(seconds / 86400) + " d";
+}
+
+function formatNumber(value, digits, unit) {
+  return value === null || value === undefined ? "–" : value.toFixed(digits) + unit;
+}
+
+// Projection
+
+function worldSize(zoom) {
+  return TILE_SIZE * Math.pow(2, zoom);
+}
+
+function project(lon, lat, zoom) {
+  const size = worldSize(zoom);
+  const sin = Math.sin((Math.max(-85.05, Math.min(85.05, lat)) * Math.PI) / 180);
+  return [((lon + 180) / 360) * size, (0.5 - Math.log((1 + sin) / (1 - sin)) / (4 * Math.PI)) * size];
+}
+
+function unproject(x, y, zoom) {
+  const size = worldSize(zoom);
+  const n = Math.PI - (2 * Math.PI * y) / size;
+  return [(x / size) * 360 - 180, (180 / Math.PI) * Math.atan(Math.sinh(n))];
+}
+
+function toScreen(lon, lat) {
+  const [cx, cy] = project(view.lon, view.lat, view.zoom);
+  const [x, y] = project(lon, lat, view.zoom);
+  return [x - cx + canvas.clientWidth / 2, y - cy + canvas.clientHeight / 2];
+}
+
+function toLonLat(sx, sy) {
+  const [cx, cy] = project(view.lon, view.lat, view.zoom);
+  return unproject(cx + sx - canvas.clientWidth / 2, cy + sy - canvas.clientHeight / 2, view.zoom);
+}
+
+// setCenter moves the map so that lon, lat ends up at screen position sx, sy.
+function setCenter(lon, lat, sx, sy) {
+  const [x, y] = project(lon, lat, view.zoom);
+  [view.lon, view.lat] = unproject(x - sx + canvas.clientWidth / 2, y - sy + canvas.clientHeight / 2, view.zoom);
+}
+
+function zoomAt(zoom, sx, sy) {
+  const [lon, lat] = toLonLat(sx, sy);
+  view.zoom = Math.max(MIN_ZOOM, Math.min(MAX_ZOOM, zoom));
+  setCenter(lon, lat, sx, sy);
+  redraw();
+}
+
+function fitVessels() {
+  const list = [...vessels.values()];
+  if (list.length === 0) return;
+  const lons = list.map((v) => v.longitude);
+  const lats = list.map((v) => v.latitude);
+  const [minX, maxY] = project(Math.min(...lons), Math.min(...lats), 0);
+  const [maxX, minY] = project(Math.max(...lons), Math.max(...lats), 0);
+  const w = canvas.clientWidth - 80;
+  const h = canvas.clientHeight - 80;
+  const zoom = Math.log2(Math.min(w / Math.max(maxX - minX, 1e-6), h / Math.max(maxY - minY, 1e-6)));
+  view.zoom = Math.max(MIN_ZOOM, Math.min(9, zoom));
+  [view.lon, view.lat] = unproject((minX + maxX) / 2, (minY + maxY) / 2, 0);
+  redraw();
+}
+
+// Drawing
+
+let frameRequested = false;
+
+function redraw() {
+  if (!frameRequested) {
+    frameRequested = true;
+    requestAnimationFrame(draw);
+  }
+}
+
+function resize() {
+  const ratio = window.devicePixelRatio || 1;
+  canvas.width = canvas.clientWidth * ratio;
+  canvas.height = canvas.clientHeight * ratio;
+  ctx.setTransform(ratio, 0, 0, ratio, 0, 0);
+  redraw();
+}
+
+function draw() {
+  frameRequested = false;
+  const w = canvas.clientWidth;
+  const h = canvas.clientHeight;
+  ctx.fillStyle = "#dce8f2";
+  ctx.fillRect(0, 0, w, h);
+  if (tileURL) {
+    drawTiles(w, h);
+  } else {
+    drawCoastline();
+  }
+  drawTrails();
+  drawVessels();
+}
+
+function tile(z, x, y) {
+  const key = z + "/" + x + "/" + y;
+  let img = tiles.get(key);
+  if (!img) {
+    if (tiles.size > 512) tiles.clear();
+    img = new Image();
+    img.onload = redraw;
+    img.src = tileURL.replace("{z}", z).replace("{x}", x).replace("{y}", y);
+    tiles.set(key, img);
+  }
+  return img;
+}
+
+function drawTiles(w, h) {
+  const z = Math.round(view.zoom);
+  const scale = Math.pow(2, view.zoom - z);
+  const [cx, cy] = project(view.lon, view.lat, z);
+  const left = cx - w / 2 / scale;
+  const top = cy - h / 2 / scale;
+  const n = Math.pow(2, z);
+  const size = TILE_SIZE * scale;
+  for (let ty = Math.floor(top / TILE_SIZE); ty * TILE_SIZE < top + h / scale; ty++) {
+    if (ty < 0 || ty >= n) continue;
+    for (let tx = Math.floor(left / TILE_SIZE); tx * TILE_SIZE < left + w / scale; tx++) {
+      const img = tile(z, ((tx % n) + n) % n, ty);
+      if (img.complete && img.naturalWidth > 0) {
+        ctx.drawImage(img, (tx * TILE_SIZE - left) * scale, (ty * TILE_SIZE - top) * scale, size + 0.5, size + 0.5);
+      }
+    }
+  }
+}
+
+function drawCoastline() {
+  ctx.strokeStyle = "#7d8b99";
+  ctx.lineWidth = 1.2;
+  for (const line of coastline) {
+    ctx.beginPath();
+    line.forEach(([lon, lat], i) => {
+      const [x, y] = toScreen(lon, lat);
+      if (i === 0) ctx.moveTo(x, y);
+      else ctx.lineTo(x, y);
+    });
+    ctx.stroke();
+  }
+}
+
+function drawTrails() {
+  ctx.lineWidth = 2;
+  for (const [mmsi, trail] of trails) {
+    const v = vessels.get(mmsi);
+    if (!v || trail.length < 2) continue;
+    ctx.strokeStyle = navStatus(v)[1];
+    ctx.globalAlpha = mmsi === selected ? 0.9 : 0.5;
+    ctx.beginPath();
+    trail.forEach(([lon, lat], i) => {
+      const [x, y] = toScreen(lon, lat);
+      if (i === 0) ctx.moveTo(x, y);
+      else ctx.lineTo(x, y);
+    });
+    ctx.stroke();
+  }
+  ctx.globalAlpha = 1;
+}
+
+function drawVessels() {
+  ctx.font = "12px system-ui, sans-serif";
+  ctx.textBaseline = "middle";
+  for (const v of vessels.values()) {
+    const [x, y] = toScreen(v.longitude, v.latitude);
+    const direction = v.heading_degrees ?? v.course_over_ground_degrees;
+    ctx.globalAlpha = reportAge(v) > STALE_SECONDS ? 0.45 : 1;
+    ctx.fillStyle = navStatus(v)[1];
+    ctx.strokeStyle = "#fff";
+    ctx.lineWidth = 1.5;
+
+    ctx.save();
+    ctx.translate(x, y);
+    ctx.beginPath();
+    if (direction !== null && direction !== undefined) {
+      ctx.rotate((direction * Math.PI) / 180);
+      ctx.moveTo(0, -11);
+      ctx.lineTo(7, 8);
+      ctx.lineTo(0, 4);
+      ctx.lineTo(-7, 8);
+      ctx.closePath();
+    } else {
+      ctx.arc(0, 0, 6, 0, 2 * Math.PI);
+    }
+    ctx.fill();
+    ctx.stroke();
+    ctx.restore();
+
+    if (v.mmsi === selected) {
+      ctx.strokeStyle = "#1d3b57";
+      ctx.lineWidth = 2;
+      ctx.beginPath();
+      ctx.arc(x, y, 15, 0, 2 * Math.PI);
+      ctx.stroke();
+    }
+    ctx.fillStyle = "#1d2630";
+    ctx.fillText(v.name, x + 13, y);
+  }
+  ctx.globalAlpha = 1;
+}
+
+// Sidebar
+
+function renderList() {
+  const list = [...vessels.values()].sort((a, b) => a.name.localeCompare(b.name));
+  listEl.replaceChildren(
+    ...list.map((v) => {
+      const li = document.createElement("li");
+      const age = reportAge(v);
+      li.classList.toggle("selected", v.mmsi === selected);
+      li.classList.toggle("stale", age > STALE_SECONDS);
+
+      const swatch = document.createElement("span");
+      swatch.className = "swatch";
+      swatch.style.background = navStatus(v)[1];
+      const name = document.createElement("span");
+      name.className = "name";
+      name.textContent = v.name;
+      const ageEl = document.createElement("span");
+      ageEl.className = "age";
+      ageEl.textContent = formatAge(age) + " ago";
+      ageEl.title = new Date(v.timestamp * 1000).toLocaleString();
+      const meta = document.createElement("div");
+      meta.className = "meta";
+      meta.textContent = [v.country, navStatus(v)[0], formatNumber(v.speed_over_ground_knots, 1, " kn")].join(" · ");
+
+      li.append(swatch, name, ageEl, meta);
+      li.addEventListener("click", () => {
+        select(v.mmsi);
+        setCenter(v.longitude, v.latitude, canvas.clientWidth / 2, canvas.clientHeight / 2);
+        redraw();
+      });
+      return li;
+    }),
+  );
+  renderDetails();
+}
+
+function renderDetails() {
+  const v = vessels.get(selected);
+  if (!v) {
+    detailsEl.hidden = true;
+    return;
+  }
+  const rows = [
+    ["MMSI", v.mmsi],
+    ["IMO", v.imo],
+    ["Country", v.country_name || v.country],
+    ["Operator", v.operator],
+    ["Fleet", v.fleet],
+    ["Status", navStatus(v)[0]],
+    ["Position", v.latitude.toFixed(4) + ", " + v.longitude.toFixed(4)],
+    ["Implausible", v.position_anomaly],
+    ["Sea area", v.sea_area],
+    ["Nearest port", v.nearest_port && v.nearest_port.name + " (" + v.nearest_port.distance_nautical_miles.toFixed(1) + " nmi)"],
+    ["Speed", formatNumber(v.speed_over_ground_knots, 1, " kn")],
+    ["Course", formatNumber(v.course_over_ground_degrees, 0, "°")],
+    ["Heading", formatNumber(v.heading_degrees, 0, "°")],
+    ["Destination", v.destination],
+    ["Reported", new Date(v.timestamp * 1000).toLocaleString() + " (" + formatAge(reportAge(v)) + " ago)"],
+  ];
+  const title = document.createElement("h2");
+  title.textContent = v.name;
+  const dl = document.createElement("dl");
+  for (const [label, value] of rows) {
+    if (value === undefined || value === "" || value === 0) continue;
+    const dt = document.createElement("dt");
+    dt.textContent = label;
+    const dd = document.createElement("dd");
+    dd.textContent = value;
+    dl.append(dt, dd);
+  }
+  detailsEl.replaceChildren(title, dl);
+  detailsEl.hidden = false;
+}
+
+function renderStatus() {
+  if (!status) return;
+  const refreshed = status.last_refresh ? formatAge((Date.now() - Date.parse(status.last_refresh)) / 1000) + " ago" : "never";
+  statusEl.textContent = (status.up ? "Up" : "Down") + " · refreshed " + refreshed + (live ? " · live" : "");
+  statusEl.title = status.last_refresh_error || "";
+  statusEl.classList.toggle("down", !status.up);
+}
+
+function renderLegend() {
+  const legend = document.getElementById("legend");
+  legend.replaceChildren(
+    ...LEGEND.map((code) => {
+      const li = document.createElement("li");
+      const swatch = document.createElement("span");
+      swatch.className = "swatch";
+      swatch.style.background = NAV_STATUS[code][1];
+      li.append(swatch, NAV_STATUS[code][0]);
+      return li;
+    }),
+  );
+  document.getElementById("attribution").textContent = tileURL ? document.body.dataset.attribution : "Coastline simplified";
+}
+
+function select(mmsi) {
+  selected = mmsi;
+  renderList();
+  redraw();
+}
+
+// Data
+
+async function getJSON(url) {
+  const resp = await fetch(url, { headers: { Accept: "application/json" } });
+  if (!resp.ok) throw new Error(url + ": " + resp.status);
+  return resp.json();
+}
+
+function addTrailPoint(v) {
+  let trail = trails.get(v.mmsi);
+  if (!trail) {
+    trail = [];
+    trails.set(v.mmsi, trail);
+  }
+  const last = trail[trail.length - 1];
+  if (!last || v.timestamp > last[2]) trail.push([v.longitude, v.latitude, v.timestamp]);
+  const cutoff = Date.now() / 1000 - TRAIL_SECONDS;
+  while (trail.length > 0 && trail[0][2] < cutoff) trail.shift();
+}
+
+async function loadTrail(mmsi) {
+  const since = Math.floor(Date.now() / 1000 - TRAIL_SECONDS);
+  try {
+    const track = await getJSON("api/v1/vessels/" + encodeURIComponent(mmsi) + "/track?since=" + since);
+    const points = track.geometry.coordinates.map(([lon, lat], i) => [lon, lat, track.properties.timestamps[i]]);
+    const known = trails.get(mmsi) || [];
+    const latest = points.length > 0 ? points[points.length - 1][2] : 0;
+    trails.set(mmsi, points.concat(known.filter((p) => p[2] > latest)));
+    redraw();
+  } catch {
+    // The history is disabled or has no points yet.
+  }
+}
+
+function setVessels(list) {
+  const current = new Set();
+  for (const v of list) {
+    current.add(v.mmsi);
+    const isNew = !vessels.has(v.mmsi);
+    vessels.set(v.mmsi, v);
+    addTrailPoint(v);
+    if (isNew) loadTrail(v.mmsi);
+  }
+  for (const mmsi of vessels.keys()) {
+    if (!current.has(mmsi)) {
+      vessels.delete(mmsi);
+      trails.delete(mmsi);
+    }
+  }
+  if (!fitted && vessels.size > 0) {
+    fitted = true;
+    fitVessels();
+  }
+  renderList();
+  renderStatus();
+  redraw();
+}
+
+async function poll() {
+  try {
+    const fc = await getJSON("api/v1/vessels.geojson");
+    status = fc.status;
+    setVessels(fc.features.map((f) => f.properties));
+  } catch (err) {
+    statusEl.textContent = "Exporter unreachable";
+    statusEl.classList.add("down");
+  }
+}
+
+// connect follows the live feed. EventSource reconnects by itself and resumes
+// with Last-Event-ID; while it is down the vessels are polled.
+function connect() {
+  let timer = null;
+  const stopPolling = () => {
+    clearInterval(timer);
+    timer = null;
+  };
+  if (!window.EventSource) {
+    setInterval(poll, POLL_MILLISECONDS);
+    return;
+  }
+  const source = new EventSource("api/v1/stream");
+  source.addEventListener("open", () => {
+    live = true;
+    stopPolling();
+    renderStatus();
+  });
+  source.addEventListener("error", () => {
+    live = false;
+    renderStatus();
+    if (timer === null) timer = setInterval(poll, POLL_MILLISECONDS);
+  });
+  source.addEventListener("snapshot", (ev) => {
+    const data = JSON.parse(ev.data);
+    status = data.status;
+    setVessels(data.vessels);
+  });
+  source.addEventListener("position", (ev) => {
+    const v = JSON.parse(ev.data);
+    vessels.set(v.mmsi, v);
+    addTrailPoint(v);
+    renderList();
+    redraw();
+  });
+}
+
+// Interaction
+
+let drag = null;
+
+canvas.addEventListener("pointerdown", (ev) => {
+  drag = { x: ev.offsetX, y: ev.offsetY, moved: false };
+  canvas.setPointerCapture(ev.pointerId);
+});
+
+canvas.addEventListener("pointermove", (ev) => {
+  if (!drag) return;
+  const dx = ev.offsetX - drag.x;
+  const dy = ev.offsetY - drag.y;
+  if (!drag.moved && Math.hypot(dx, dy) < 3) return;
+  drag.moved = true;
+  canvas.classList.add("dragging");
+  const [lon, lat] = toLonLat(drag.x, drag.y);
+  setCenter(lon, lat, ev.offsetX, ev.offsetY);
+  drag.x = ev.offsetX;
+  drag.y = ev.offsetY;
+  redraw();
+});
+
+canvas.addEventListener("pointerup", (ev) => {
+  const click = drag && !drag.moved;
+  drag = null;
+  canvas.classList.remove("dragging");
+  if (!click) return;
+  let hit = null;
+  let best = 15;
+  for (const v of vessels.values()) {
+    const [x, y] = toScreen(v.longitude, v.latitude);
+    const d = Math.hypot(x - ev.offsetX, y - ev.offsetY);
+    if (d < best) {
+      best = d;
+      hit = v.mmsi;
+    }
+  }
+  select(hit);
+});
+
+canvas.addEventListener(
+  "wheel",
+  (ev) => {
+    ev.preventDefault();
+    zoomAt(view.zoom - ev.deltaY * 0.002, ev.offsetX, ev.offsetY);
+  },
+  { passive: false },
+);
+
+document.getElementById("zoom-in").addEventListener("click", () => zoomAt(view.zoom + 1, canvas.clientWidth / 2, canvas.clientHeight / 2));
+document.getElementById("zoom-out").addEventListener("click", () => zoomAt(view.zoom - 1, canvas.clientWidth / 2, canvas.clientHeight / 2));
+document.getElementById("fit").addEventListener("click", fitVessels);
+window.addEventListener("resize", resize);
+
+// Report ages change while nothing else does.
+setInterval(() => {
+  renderList();
+  renderStatus();
+  redraw();
+}, 10 * 1000);
+
+async function start() {
+  resize();
+  renderLegend();
+  if (!tileURL) {
+    try {
+      const fc = await getJSON("coastline.geojson");
+      coastline = fc.features.map((f) => f.geometry.coordinates);
+      redraw();
+    } catch {
+      // The map still works without the outline.
+    }
+  }
+  await poll();
+  connect();
+}
+
+start();
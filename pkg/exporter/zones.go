@@ -0,0 +1,123 @@
+package exporter
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// feedZone events report a vessel entering or leaving a zone.
+const feedZone = "zone"
+
+type zoneKey struct {
+	zone, mmsi string
+}
+
+// zoneTracker records which vessels are inside which zones.
+type zoneTracker struct {
+	mu sync.Mutex
+	// entered holds the report timestamp of the entry while a vessel is
+	// inside a zone.
+	entered map[zoneKey]int64
+	entries map[zoneKey]uint64
+}
+
+// zoneEvent is published on the live feed when a vessel crosses a zone
+// boundary.
+type zoneEvent struct {
+	Zone      string `json:"zone"`
+	MMSI      string `json:"mmsi"`
+	Name      string `json:"name"`
+	Event     string `json:"event"`
+	Timestamp int64  `json:"timestamp"`
+}
+
+func newZoneTracker() *zoneTracker {
+	return &zoneTracker{entered: map[zoneKey]int64{}, entries: map[zoneKey]uint64{}}
+}
+
+// observe evaluates pos against every zone and returns the entries ("enter")
+// and exits ("exit") it caused.
+func (t *zoneTracker) observe(zones []config.Zone, pos models.IcebreakerPosition) []zoneEvent {
+	p := geo.Point{Lon: pos.Longitude, Lat: pos.Latitude}
+	ts := pos.Timestamp
+	if ts <= 0 {
+		ts = time.Now().Unix()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var events []zoneEvent
+	for _, zone := range zones {
+		key := zoneKey{zone: zone.Name, mmsi: pos.MMSI}
+		_, was := t.entered[key]
+		switch inside := zone.Shape.Contains(p); {
+		case inside && !was:
+			t.entered[key] = ts
+			t.entries[key]++
+			events = append(events, zoneEvent{Zone: zone.Name, MMSI: pos.MMSI, Name: pos.Name, Event: "enter", Timestamp: ts})
+		case !inside && was:
+			delete(t.entered, key)
+			events = append(events, zoneEvent{Zone: zone.Name, MMSI: pos.MMSI, Name: pos.Name, Event: "exit", Timestamp: ts})
+		}
+	}
+	return events
+}
+
+// retain forgets the state of zones that are no longer configured and of
+// vessels that are no longer tracked.
+func (t *zoneTracker) retain(zones []config.Zone, positions []models.IcebreakerPosition) {
+	names := make(map[string]struct{}, len(zones))
+	for _, z := range zones {
+		names[z.Name] = struct{}{}
+	}
+	mmsis := make(map[string]struct{}, len(positions))
+	for _, pos := range positions {
+		mmsis[pos.MMSI] = struct{}{}
+	}
+	keep := func(key zoneKey) bool {
+		_, zone := names[key.zone]
+		_, vessel := mmsis[key.mmsi]
+		return zone && vessel
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for key := range t.entered {
+		if !keep(key) {
+			delete(t.entered, key)
+		}
+	}
+	for key := range t.entries {
+		if !keep(key) {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// state returns whether the vessel is inside the zone, since when, and how
+// often it entered it.
+func (t *zoneTracker) state(zone, mmsi string) (inside bool, entered int64, entries uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := zoneKey{zone: zone, mmsi: mmsi}
+	entered, inside = t.entered[key]
+	return inside, entered, t.entries[key]
+}
+
+// updateZones evaluates the zones for the given positions, logs boundary
+// crossings and publishes them on the live feed.
+func (e *Exporter) updateZones(positions []models.IcebreakerPosition) {
+	zones := e.currentConfig().Zones
+	for _, pos := range positions {
+		for _, ev := range e.zones.observe(zones, pos) {
+			slog.Info("vessel crossed zone boundary", "event", ev.Event, "zone", ev.Zone, "vessel", ev.Name, "mmsi", ev.MMSI)
+			e.feed.publish(feedZone, ev)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package exporter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+var testZones = []config.Zone{
+	{Name: "Bay of Bothnia", Shape: geo.MultiPolygon{{geo.Ring{{Lon: 21, Lat: 63.5}, {Lon: 25.5, Lat: 63.5}, {Lon: 25.5, Lat: 66}, {Lon: 21, Lat: 66}}}}},
+	{Name: "Kemi approach", Shape: geo.MultiPolygon{{geo.Ring{{Lon: 24.2, Lat: 65.5}, {Lon: 24.8, Lat: 65.5}, {Lon: 24.8, Lat: 65.8}, {Lon: 24.2, Lat: 65.8}}}}},
+}
+
+func TestZoneTracker(t *testing.T) {
+	tracker := newZoneTracker()
+	otso := models.IcebreakerPosition{Name: "OTSO", MMSI: "230252000", Latitude: 65.6, Longitude: 24.5, Timestamp: 100}
+
+	events := tracker.observe(testZones, otso)
+	if len(events) != 2 || events[0].Event != "enter" || events[1].Zone != "Kemi approach" {
+		t.Fatalf("expected entries into both zones, got %+v", events)
+	}
+	if events := tracker.observe(testZones, otso); len(events) != 0 {
+		t.Errorf("expected no events while staying inside, got %+v", events)
+	}
+
+	otso.Latitude, otso.Timestamp = 65.0, 200
+	events = tracker.observe(testZones, otso)
+	if len(events) != 1 || events[0].Event != "exit" || events[0].Zone != "Kemi approach" || events[0].Timestamp != 200 {
+		t.Fatalf("expected an exit from the approach, got %+v", events)
+	}
+	otso.Latitude, otso.Timestamp = 65.6, 300
+	tracker.observe(testZones, otso)
+	if inside, entered, entries := tracker.state("Kemi approach", otso.MMSI); !inside || entered != 300 || entries != 2 {
+		t.Errorf("unexpected state: inside %v, entered %d, entries %d", inside, entered, entries)
+	}
+	if inside, entered, entries := tracker.state("Bay of Bothnia", otso.MMSI); !inside || entered != 100 || entries != 1 {
+		t.Errorf("unexpected state: inside %v, entered %d, entries %d", inside, entered, entries)
+	}
+
+	tracker.retain(testZones[:1], []models.IcebreakerPosition{otso})
+	if _, _, entries := tracker.state("Kemi approach", otso.MMSI); entries != 0 {
+		t.Error("expected the state of a removed zone to be dropped")
+	}
+	tracker.retain(testZones, nil)
+	if inside, _, _ := tracker.state("Bay of Bothnia", otso.MMSI); inside {
+		t.Error("expected the state of an untracked vessel to be dropped")
+	}
+}
+
+func TestMetricsHandlerZones(t *testing.T) {
+	exp := New(config.Config{Zones: testZones})
+	now := time.Now().Unix()
+	otso := models.IcebreakerPosition{Name: "OTSO", MMSI: "230252000", Country: "FI", Latitude: 65.6, Longitude: 24.5, Timestamp: now - 600}
+	ymer := models.IcebreakerPosition{Name: "YMER", MMSI: "265547250", Country: "SE", Latitude: 60.0, Longitude: 20.0, Timestamp: now}
+	exp.snapshot = models.Snapshot{LastRefresh: time.Now(), Positions: []models.IcebreakerPosition{otso, ymer}}
+	exp.updateZones(exp.snapshot.Positions)
+
+	rr := httptest.NewRecorder()
+	exp.MetricsHandler(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rr.Body.String()
+	for _, want := range []string{
+		`icebreaker_in_zone{zone="Kemi approach",vessel_name="OTSO",mmsi="230252000",country="FI"} 1`,
+		`icebreaker_in_zone{zone="Kemi approach",vessel_name="YMER",mmsi="265547250",country="SE"} 0`,
+		`icebreaker_zone_entries_total{zone="Bay of Bothnia",vessel_name="OTSO",mmsi="230252000",country="FI"} 1`,
+		`icebreaker_zone_entries_total{zone="Bay of Bothnia",vessel_name="YMER",mmsi="265547250",country="SE"} 0`,
+		`icebreaker_zone_dwell_seconds{zone="Bay of Bothnia",vessel_name="OTSO",mmsi="230252000",country="FI"} 60`, // 600 or 601 when the second ticks over
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in output:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, `icebreaker_zone_dwell_seconds{zone="Bay of Bothnia",vessel_name="YMER"`) {
+		t.Error("expected no dwell time outside the zone")
+	}
+}
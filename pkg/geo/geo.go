@@ -0,0 +1,140 @@
+// Package geo has the geometry behind zones, sea areas and ports:
+// great-circle distances, polygons on longitude/latitude coordinates and
+// their GeoJSON encoding.
+package geo
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Point is a WGS 84 position.
+type Point struct {
+	Lon, Lat float64
+}
+
+// Ring is a closed line of a polygon. The closing point may be repeated or
+// left out.
+type Ring []Point
+
+// Polygon is an outer ring followed by the rings of its holes.
+type Polygon []Ring
+
+// MultiPolygon is a union of polygons.
+type MultiPolygon []Polygon
+
+// Contains reports whether p lies inside any of the polygons.
+func (m MultiPolygon) Contains(p Point) bool {
+	for _, poly := range m {
+		if poly.Contains(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate reports polygons that cannot be evaluated.
+func (m MultiPolygon) Validate() error {
+	if len(m) == 0 {
+		return errors.New("no polygons")
+	}
+	for i, poly := range m {
+		if err := poly.Validate(); err != nil {
+			if len(m) == 1 {
+				return err
+			}
+			return fmt.Errorf("polygon %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// Contains reports whether p lies inside the outer ring and outside every
+// hole. Points on an edge may fall on either side.
+func (poly Polygon) Contains(p Point) bool {
+	if len(poly) == 0 || !poly[0].contains(p) {
+		return false
+	}
+	for _, hole := range poly[1:] {
+		if hole.contains(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate reports polygons that cannot be evaluated.
+func (poly Polygon) Validate() error {
+	if len(poly) == 0 {
+		return errors.New("no rings")
+	}
+	for i, ring := range poly {
+		if err := ring.validate(); err != nil {
+			if i == 0 {
+				return fmt.Errorf("outer ring: %w", err)
+			}
+			return fmt.Errorf("hole %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (r Ring) validate() error {
+	distinct := 0
+	for i, p := range r {
+		if math.IsNaN(p.Lon) || math.IsNaN(p.Lat) || p.Lon < -180 || p.Lon > 180 || p.Lat < -90 || p.Lat > 90 {
+			return fmt.Errorf("point %d (%g, %g) is not a longitude, latitude pair", i+1, p.Lon, p.Lat)
+		}
+		if i == 0 || p != r[i-1] {
+			distinct++
+		}
+	}
+	if len(r) > 1 && r[0] == r[len(r)-1] {
+		distinct--
+	}
+	if distinct < 3 {
+		return errors.New("at least three distinct points are required")
+	}
+	return nil
+}
+
+// contains is an even-odd ray casting test. Longitudes are unwrapped along
+// the ring, so a ring that crosses the antimeridian is evaluated as one
+// continuous shape rather than one spanning the globe the other way round.
+func (r Ring) contains(p Point) bool {
+	if len(r) < 3 {
+		return false
+	}
+	lons := make([]float64, len(r))
+	lons[0] = r[0].Lon
+	minLon, maxLon := lons[0], lons[0]
+	for i := 1; i < len(r); i++ {
+		lons[i] = lons[i-1] + wrap(r[i].Lon-r[i-1].Lon)
+		minLon = min(minLon, lons[i])
+		maxLon = max(maxLon, lons[i])
+	}
+	lon := (minLon+maxLon)/2 + wrap(p.Lon-(minLon+maxLon)/2)
+
+	inside := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		yi, yj := r[i].Lat, r[j].Lat
+		if (yi > p.Lat) == (yj > p.Lat) {
+			continue
+		}
+		x := lons[i] + (p.Lat-yi)/(yj-yi)*(lons[j]-lons[i])
+		if lon < x {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// wrap maps a longitude difference into [-180, 180).
+func wrap(d float64) float64 {
+	d = math.Mod(d+180, 360)
+	if d < 0 {
+		d += 360
+	}
+	return d - 180
+}
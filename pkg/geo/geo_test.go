@@ -0,0 +1,165 @@
+package geo
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func square(minLon, minLat, maxLon, maxLat float64) Ring {
+	return Ring{{minLon, minLat}, {maxLon, minLat}, {maxLon, maxLat}, {minLon, maxLat}, {minLon, minLat}}
+}
+
+func TestPolygonContains(t *testing.T) {
+	withHole := Polygon{square(20, 60, 26, 66), square(22, 62, 24, 64)}
+	// Crosses the antimeridian: 170°E to 170°W.
+	dateLine := Polygon{Ring{{170, -10}, {-170, -10}, {-170, 10}, {170, 10}}}
+	concave := Polygon{Ring{{0, 0}, {10, 0}, {10, 10}, {5, 4}, {0, 10}}}
+
+	tests := []struct {
+		name string
+		poly Polygon
+		p    Point
+		want bool
+	}{
+		{"inside", withHole, Point{21, 61}, true},
+		{"in hole", withHole, Point{23, 63}, false},
+		{"outside", withHole, Point{27, 61}, false},
+		{"east of antimeridian", dateLine, Point{175, 0}, true},
+		{"west of antimeridian", dateLine, Point{-175, 5}, true},
+		{"on antimeridian", dateLine, Point{180, 0}, true},
+		{"far side of the globe", dateLine, Point{0, 0}, false},
+		{"just outside the crossing", dateLine, Point{-165, 0}, false},
+		{"concave notch", concave, Point{5, 8}, false},
+		{"concave arm", concave, Point{1, 8}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.poly.Contains(tt.p); got != tt.want {
+			t.Errorf("%s: Contains(%v) = %v, want %v", tt.name, tt.p, got, tt.want)
+		}
+	}
+
+	multi := MultiPolygon{Polygon{square(0, 0, 1, 1)}, Polygon{square(5, 5, 6, 6)}}
+	if !multi.Contains(Point{5.5, 5.5}) || multi.Contains(Point{3, 3}) {
+		t.Error("unexpected MultiPolygon result")
+	}
+}
+
+func TestPolygonValidate(t *testing.T) {
+	if err := (Polygon{square(20, 60, 26, 66)}).Validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	// A closed triangle repeats its first point.
+	if err := (Polygon{Ring{{0, 0}, {1, 0}, {0, 1}, {0, 0}}}).Validate(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	for name, poly := range map[string]Polygon{
+		"no rings":      {},
+		"two points":    {Ring{{0, 0}, {1, 1}, {0, 0}}},
+		"bad latitude":  {Ring{{0, 0}, {1, 95}, {2, 0}}},
+		"bad hole":      {square(0, 0, 2, 2), Ring{{1, 1}}},
+		"lat lon order": {Ring{{60, 200}, {61, 200}, {61, 201}}},
+	} {
+		if err := poly.Validate(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestDecodeGeoJSON(t *testing.T) {
+	doc := `{"type":"FeatureCollection","features":[
+		{"type":"Feature","properties":{"name":"Bay of Bothnia"},"geometry":{"type":"Polygon","coordinates":[[[21,63.5],[25.5,63.5],[25.5,66],[21,66],[21,63.5]]]}},
+		{"type":"Feature","properties":{},"geometry":{"type":"MultiPolygon","coordinates":[[[[0,0],[1,0],[1,1],[0,0]]],[[[5,5],[6,5],[6,6],[5,5]]]]}}
+	]}`
+	features, err := DecodeGeoJSON(strings.NewReader(doc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(features) != 2 || features[0].Name() != "Bay of Bothnia" || features[1].Name() != "" || len(features[1].Shape) != 2 {
+		t.Fatalf("unexpected features %+v", features)
+	}
+	if !features[0].Shape.Contains(Point{Lon: 24, Lat: 65}) {
+		t.Error("expected Oulu roads in the Bay of Bothnia")
+	}
+
+	bare, err := DecodeGeoJSON(strings.NewReader(`{"type":"Polygon","coordinates":[[[0,0],[1,0],[1,1]]]}`))
+	if err != nil || len(bare) != 1 {
+		t.Fatalf("bare geometry: %v %+v", err, bare)
+	}
+
+	for _, doc := range []string{
+		`{"type":"Point","coordinates":[0,0]}`,
+		`{"type":"Feature","properties":{}}`,
+		`{"type":"Polygon","coordinates":[[[0,0],[1,0]]]}`,
+		`{"type":"Polygon","coordinates":[[[0]]]}`,
+	} {
+		if _, err := DecodeGeoJSON(strings.NewReader(doc)); err == nil {
+			t.Errorf("expected an error for %s", doc)
+		}
+	}
+}
+
+func TestDistance(t *testing.T) {
+	helsinki := Point{Lon: 24.96, Lat: 60.16}
+	tallinn := Point{Lon: 24.77, Lat: 59.45}
+	if d := Distance(helsinki, tallinn) / MetersPerNauticalMile; d < 42 || d > 44 {
+		t.Errorf("Helsinki–Tallinn: got %.1f nmi, want about 43", d)
+	}
+	// One minute of latitude is one nautical mile.
+	if d := Distance(Point{Lon: 20, Lat: 60}, Point{Lon: 20, Lat: 60 + 1.0/60}); d < 1850 || d > 1856 {
+		t.Errorf("one minute of latitude: got %.1f m", d)
+	}
+	if d := Distance(Point{Lon: 179.9, Lat: 0}, Point{Lon: -179.9, Lat: 0}); d > 23000 {
+		t.Errorf("across the antimeridian: got %.0f m", d)
+	}
+	if d := Distance(helsinki, helsinki); d != 0 {
+		t.Errorf("same point: got %v", d)
+	}
+}
+
+func TestBearing(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Point
+		want float64
+	}{
+		{"north", Point{Lon: 25, Lat: 60}, Point{Lon: 25, Lat: 61}, 0},
+		{"south", Point{Lon: 25, Lat: 61}, Point{Lon: 25, Lat: 60}, 180},
+		{"east on the equator", Point{Lon: 0, Lat: 0}, Point{Lon: 1, Lat: 0}, 90},
+		{"west across the antimeridian", Point{Lon: -179.5, Lat: 0}, Point{Lon: 179.5, Lat: 0}, 270},
+		{"Helsinki–St Petersburg", Point{Lon: 24.96, Lat: 60.16}, Point{Lon: 30.21, Lat: 59.88}, 93.8},
+	}
+	for _, tt := range tests {
+		if got := Bearing(tt.a, tt.b); math.Abs(got-tt.want) > 0.1 {
+			t.Errorf("%s: got %.2f°, want %.1f°", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGeodesicDistance(t *testing.T) {
+	dms := func(d, m, s float64) float64 { return d + m/60 + s/3600 }
+	tests := []struct {
+		name string
+		a, b Point
+		want float64 // metres
+	}{
+		// Vincenty (1975), Flinders Peak to Buninyong.
+		{"Flinders Peak–Buninyong", Point{Lon: dms(144, 25, 29.52440), Lat: -dms(37, 57, 3.72030)}, Point{Lon: dms(143, 55, 35.38390), Lat: -dms(37, 39, 10.15610)}, 54972.271},
+		// One degree of the equator is a/180·π.
+		{"equator, one degree", Point{Lon: 0, Lat: 0}, Point{Lon: 1, Lat: 0}, 111319.491},
+		// Meridian arc from the equator to 1°N.
+		{"meridian, one degree", Point{Lon: 25, Lat: 0}, Point{Lon: 25, Lat: 1}, 110574.389},
+		{"across the antimeridian", Point{Lon: 179.5, Lat: 0}, Point{Lon: -179.5, Lat: 0}, 111319.491},
+		{"same point", Point{Lon: 24.96, Lat: 60.16}, Point{Lon: 24.96, Lat: 60.16}, 0},
+	}
+	for _, tt := range tests {
+		if got := GeodesicDistance(tt.a, tt.b); math.Abs(got-tt.want) > 0.01 {
+			t.Errorf("%s: got %.3f m, want %.3f m", tt.name, got, tt.want)
+		}
+	}
+
+	// Nearly antipodal points fall back to the sphere instead of failing.
+	if d := GeodesicDistance(Point{Lon: 0, Lat: 0}, Point{Lon: 179.7, Lat: 0.5}); d < 19.9e6 || d > 20.1e6 {
+		t.Errorf("nearly antipodal: got %.0f m", d)
+	}
+}
@@ -0,0 +1,136 @@
+package geo
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Feature is a polygonal GeoJSON feature.
+type Feature struct {
+	Properties map[string]any
+	Shape      MultiPolygon
+}
+
+// Name returns the "name" property, or "" if there is none.
+func (f Feature) Name() string {
+	name, _ := f.Properties["name"].(string)
+	return name
+}
+
+type geoJSON struct {
+	Type        string          `json:"type"`
+	Features    []geoJSON       `json:"features"`
+	Geometry    *geoJSON        `json:"geometry"`
+	Properties  map[string]any  `json:"properties"`
+	Coordinates json.RawMessage `json:"coordinates"`
+}
+
+// DecodeGeoJSON reads the Polygon and MultiPolygon features of a GeoJSON
+// (RFC 7946) document: a FeatureCollection, a Feature or a bare geometry.
+// Other geometry types are an error.
+func DecodeGeoJSON(r io.Reader) ([]Feature, error) {
+	var doc geoJSON
+	if err := json.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	switch doc.Type {
+	case "FeatureCollection":
+		out := make([]Feature, 0, len(doc.Features))
+		for i, f := range doc.Features {
+			feature, err := decodeFeature(f)
+			if err != nil {
+				return nil, fmt.Errorf("feature %d: %w", i+1, err)
+			}
+			out = append(out, feature)
+		}
+		return out, nil
+	case "Feature":
+		feature, err := decodeFeature(doc)
+		if err != nil {
+			return nil, err
+		}
+		return []Feature{feature}, nil
+	default:
+		shape, err := decodeGeometry(doc)
+		if err != nil {
+			return nil, err
+		}
+		return []Feature{{Shape: shape}}, nil
+	}
+}
+
+func decodeFeature(f geoJSON) (Feature, error) {
+	if f.Type != "Feature" {
+		return Feature{}, fmt.Errorf("expected a Feature, got %q", f.Type)
+	}
+	if f.Geometry == nil {
+		return Feature{}, errors.New("no geometry")
+	}
+	shape, err := decodeGeometry(*f.Geometry)
+	if err != nil {
+		return Feature{}, err
+	}
+	return Feature{Properties: f.Properties, Shape: shape}, nil
+}
+
+func decodeGeometry(g geoJSON) (MultiPolygon, error) {
+	var shape MultiPolygon
+	switch g.Type {
+	case "Polygon":
+		var coords [][][]float64
+		if err := json.Unmarshal(g.Coordinates, &coords); err != nil {
+			return nil, fmt.Errorf("polygon coordinates: %w", err)
+		}
+		poly, err := polygonFromCoordinates(coords)
+		if err != nil {
+			return nil, err
+		}
+		shape = MultiPolygon{poly}
+	case "MultiPolygon":
+		var coords [][][][]float64
+		if err := json.Unmarshal(g.Coordinates, &coords); err != nil {
+			return nil, fmt.Errorf("multipolygon coordinates: %w", err)
+		}
+		for _, c := range coords {
+			poly, err := polygonFromCoordinates(c)
+			if err != nil {
+				return nil, err
+			}
+			shape = append(shape, poly)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported geometry type %q", g.Type)
+	}
+	if err := shape.Validate(); err != nil {
+		return nil, err
+	}
+	return shape, nil
+}
+
+// PolygonFromCoordinates builds a polygon from GeoJSON style rings of
+// [longitude, latitude] positions.
+func PolygonFromCoordinates(rings [][][]float64) (Polygon, error) {
+	poly, err := polygonFromCoordinates(rings)
+	if err != nil {
+		return nil, err
+	}
+	return poly, poly.Validate()
+}
+
+func polygonFromCoordinates(rings [][][]float64) (Polygon, error) {
+	poly := make(Polygon, 0, len(rings))
+	for _, coords := range rings {
+		ring := make(Ring, 0, len(coords))
+		for _, c := range coords {
+			if len(c) < 2 {
+				return nil, fmt.Errorf("position %v needs a longitude and a latitude", c)
+			}
+			ring = append(ring, Point{Lon: c[0], Lat: c[1]})
+		}
+		poly = append(poly, ring)
+	}
+	return poly, nil
+}
@@ -0,0 +1,203 @@
+// Package history keeps a bounded in-memory track of recent positions per
+// vessel.
+package history
+
+import (
+	"sync"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// History records vessel tracks. Each track keeps at most maxPoints points
+// and drops points older than retention. It is safe for concurrent use.
+type History struct {
+	mu        sync.RWMutex
+	retention time.Duration
+	maxPoints int
+	tracks    map[string]*ring
+	now       func() time.Time
+}
+
+// New returns a History. A zero retention or maxPoints disables recording.
+func New(retention time.Duration, maxPoints int) *History {
+	return &History{
+		retention: retention,
+		maxPoints: maxPoints,
+		tracks:    map[string]*ring{},
+		now:       time.Now,
+	}
+}
+
+// SetLimits changes the retention and point limit. Existing tracks are
+// trimmed to the new limits.
+func (h *History) SetLimits(retention time.Duration, maxPoints int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.retention = retention
+	h.maxPoints = maxPoints
+	for mmsi, r := range h.tracks {
+		if !h.enabled() {
+			delete(h.tracks, mmsi)
+			continue
+		}
+		r.resize(maxPoints)
+	}
+	h.expire()
+}
+
+func (h *History) enabled() bool {
+	return h.retention > 0 && h.maxPoints > 0
+}
+
+// Record adds the positions of a refresh to the tracks.
+func (h *History) Record(positions []models.IcebreakerPosition) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, pos := range positions {
+		h.add(pos.MMSI, pos.TrackPoint())
+	}
+	h.expire()
+}
+
+// Add appends a point to the track of mmsi.
+func (h *History) Add(mmsi string, p models.TrackPoint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.add(mmsi, p)
+	h.expire()
+}
+
+// add appends p unless it is not newer than the last point of the track; the
+// same report is seen again by every refresh until the vessel sends a new one.
+func (h *History) add(mmsi string, p models.TrackPoint) {
+	if !h.enabled() || p.Timestamp <= 0 || p.Timestamp < h.cutoff() {
+		return
+	}
+	r, ok := h.tracks[mmsi]
+	if !ok {
+		r = newRing(h.maxPoints)
+		h.tracks[mmsi] = r
+	}
+	if last, ok := r.last(); ok && p.Timestamp <= last.Timestamp {
+		return
+	}
+	r.push(p)
+}
+
+// expire drops points older than the retention and empty tracks.
+func (h *History) expire() {
+	cutoff := h.cutoff()
+	for mmsi, r := range h.tracks {
+		r.dropBefore(cutoff)
+		if r.n == 0 {
+			delete(h.tracks, mmsi)
+		}
+	}
+}
+
+func (h *History) cutoff() int64 {
+	return h.now().Add(-h.retention).Unix()
+}
+
+// Track returns the points of mmsi reported at or after since, oldest first.
+func (h *History) Track(mmsi string, since time.Time) []models.TrackPoint {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	r, ok := h.tracks[mmsi]
+	if !ok {
+		return nil
+	}
+	from := max(since.Unix(), h.cutoff())
+	var out []models.TrackPoint
+	for i := range r.n {
+		p := r.at(i)
+		if p.Timestamp >= from {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Tracks returns a copy of all tracks, oldest point first.
+func (h *History) Tracks() map[string][]models.TrackPoint {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	out := make(map[string][]models.TrackPoint, len(h.tracks))
+	for mmsi, r := range h.tracks {
+		points := make([]models.TrackPoint, r.n)
+		for i := range r.n {
+			points[i] = r.at(i)
+		}
+		out[mmsi] = points
+	}
+	return out
+}
+
+// Restore adds previously recorded tracks, e.g. loaded from disk at startup.
+// The points of each track must be oldest first.
+func (h *History) Restore(tracks map[string][]models.TrackPoint) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for mmsi, points := range tracks {
+		for _, p := range points {
+			h.add(mmsi, p)
+		}
+	}
+	h.expire()
+}
+
+// ring is a fixed capacity circular buffer of track points, oldest first.
+type ring struct {
+	points   []models.TrackPoint
+	start, n int
+}
+
+func newRing(capacity int) *ring {
+	return &ring{points: make([]models.TrackPoint, capacity)}
+}
+
+func (r *ring) at(i int) models.TrackPoint {
+	return r.points[(r.start+i)%len(r.points)]
+}
+
+func (r *ring) last() (models.TrackPoint, bool) {
+	if r.n == 0 {
+		return models.TrackPoint{}, false
+	}
+	return r.at(r.n - 1), true
+}
+
+// push appends p, overwriting the oldest point when full.
+func (r *ring) push(p models.TrackPoint) {
+	if r.n < len(r.points) {
+		r.points[(r.start+r.n)%len(r.points)] = p
+		r.n++
+		return
+	}
+	r.points[r.start] = p
+	r.start = (r.start + 1) % len(r.points)
+}
+
+func (r *ring) dropBefore(cutoff int64) {
+	for r.n > 0 && r.at(0).Timestamp < cutoff {
+		r.start = (r.start + 1) % len(r.points)
+		r.n--
+	}
+}
+
+// resize changes the capacity, keeping the newest points.
+func (r *ring) resize(capacity int) {
+	keep := min(r.n, capacity)
+	points := make([]models.TrackPoint, capacity)
+	for i := range keep {
+		points[i] = r.at(r.n - keep + i)
+	}
+	r.points, r.start, r.n = points, 0, keep
+}
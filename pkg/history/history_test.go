@@ -0,0 +1,74 @@
+package history
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+func at(ts int64) models.TrackPoint {
+	return models.TrackPoint{Latitude: 65, Longitude: float64(ts), Timestamp: ts}
+}
+
+func timestamps(points []models.TrackPoint) []int64 {
+	out := make([]int64, 0, len(points))
+	for _, p := range points {
+		out = append(out, p.Timestamp)
+	}
+	return out
+}
+
+func TestHistoryRing(t *testing.T) {
+	h := New(time.Hour, 3)
+	h.now = func() time.Time { return time.Unix(1000, 0) }
+
+	for _, ts := range []int64{100, 200, 200, 150, 300, 400, 500} {
+		h.Add("230252000", at(ts))
+	}
+	if got := timestamps(h.Track("230252000", time.Time{})); !slices.Equal(got, []int64{300, 400, 500}) {
+		t.Errorf("expected the newest three distinct points, got %v", got)
+	}
+	if got := timestamps(h.Track("230252000", time.Unix(400, 0))); !slices.Equal(got, []int64{400, 500}) {
+		t.Errorf("expected points since 400, got %v", got)
+	}
+	if got := h.Track("230289000", time.Time{}); got != nil {
+		t.Errorf("expected no track for unknown vessel, got %v", got)
+	}
+
+	h.SetLimits(time.Hour, 2)
+	if got := timestamps(h.Track("230252000", time.Time{})); !slices.Equal(got, []int64{400, 500}) {
+		t.Errorf("expected resize to keep the newest points, got %v", got)
+	}
+	h.Add("230252000", at(600))
+	if got := timestamps(h.Track("230252000", time.Time{})); !slices.Equal(got, []int64{500, 600}) {
+		t.Errorf("expected the resized ring to wrap, got %v", got)
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	now := time.Unix(10000, 0)
+	h := New(time.Hour, 100)
+	h.now = func() time.Time { return now }
+
+	h.Record([]models.IcebreakerPosition{
+		{MMSI: "230252000", Timestamp: now.Add(-2 * time.Hour).Unix()},
+		{MMSI: "230289000", Timestamp: now.Add(-30 * time.Minute).Unix()},
+	})
+	if got := h.Track("230252000", time.Time{}); len(got) != 0 {
+		t.Errorf("expected expired point to be ignored, got %v", got)
+	}
+
+	now = now.Add(time.Hour)
+	h.Record(nil)
+	if _, ok := h.tracks["230289000"]; ok {
+		t.Error("expected the expired track to be dropped")
+	}
+
+	h.SetLimits(0, 100)
+	h.Add("230252000", at(now.Unix()))
+	if len(h.tracks) != 0 {
+		t.Error("expected a zero retention to disable recording")
+	}
+}
@@ -0,0 +1,45 @@
+// Package land tells positions on land around the Baltic Sea from positions
+// at sea. It is meant for plausibility checks of AIS reports, so it errs on
+// the side of the sea.
+package land
+
+import (
+	"bytes"
+	_ "embed"
+	"sync"
+
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+)
+
+// land.geojson holds simplified interiors of the countries around the
+// Baltic Sea. The outlines keep roughly ten kilometres off the coast, so
+// harbours, river mouths and archipelagos are never land. The lakes with
+// shipping, Vänern, Vättern and Saimaa, are cut out as holes; smaller
+// lakes count as land.
+//
+//go:embed land.geojson
+var landGeoJSON []byte
+
+var shapes = sync.OnceValue(func() []geo.MultiPolygon {
+	features, err := geo.DecodeGeoJSON(bytes.NewReader(landGeoJSON))
+	if err != nil {
+		panic("land: malformed land.geojson: " + err.Error())
+	}
+	out := make([]geo.MultiPolygon, 0, len(features))
+	for _, f := range features {
+		out = append(out, f.Shape)
+	}
+	return out
+})
+
+// Contains reports whether the position is well inland of Finland, Sweden,
+// Estonia, Latvia, Lithuania, Poland or the Leningrad Oblast.
+func Contains(lon, lat float64) bool {
+	p := geo.Point{Lon: lon, Lat: lat}
+	for _, shape := range shapes() {
+		if shape.Contains(p) {
+			return true
+		}
+	}
+	return false
+}
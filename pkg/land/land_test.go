@@ -0,0 +1,83 @@
+package land
+
+import (
+	"testing"
+
+	"github.com/joluc/icebreaker-exporter/pkg/config"
+	"github.com/joluc/icebreaker-exporter/pkg/port"
+)
+
+func TestContains(t *testing.T) {
+	tests := []struct {
+		place    string
+		lon, lat float64
+		want     bool
+	}{
+		{"Tampere", 23.76, 61.50, true},
+		{"Jyväskylä", 25.75, 62.24, true},
+		{"Rovaniemi", 25.73, 66.50, true},
+		{"Kiruna", 20.22, 67.86, true},
+		{"Östersund", 14.64, 63.18, true},
+		{"Viljandi", 25.59, 58.36, true},
+		{"Vilnius", 25.28, 54.69, true},
+		{"Warsaw", 21.01, 52.23, true},
+		{"Luga", 29.85, 58.74, true},
+		{"Bay of Bothnia", 23.0, 65.0, false},
+		{"Gulf of Finland", 25.0, 59.9, false},
+		{"Lake Ladoga", 31.5, 60.8, false},
+		{"Gulf of Riga", 23.5, 57.5, false},
+		{"Trondheimsfjord", 11.3, 63.75, false},
+		{"Lake Vänern off Lidköping", 13.15, 58.51, false},
+		{"Lake Vänern", 13.3, 58.9, false},
+		{"Lake Vänern off Karlstad", 13.5, 59.37, false},
+		{"Lake Vättern", 14.55, 58.3, false},
+		{"Saimaa off Savonlinna", 28.88, 61.87, false},
+		{"Lappeenranta harbour", 28.19, 61.07, false},
+	}
+	for _, tt := range tests {
+		if got := Contains(tt.lon, tt.lat); got != tt.want {
+			t.Errorf("%s (%g, %g): got %v, want %v", tt.place, tt.lon, tt.lat, got, tt.want)
+		}
+	}
+}
+
+func TestPortsAreNotLand(t *testing.T) {
+	for _, p := range port.All() {
+		if Contains(p.Location.Lon, p.Location.Lat) {
+			t.Errorf("%s (%s) is on land", p.Name, p.LOCODE)
+		}
+	}
+}
+
+// homeAreas are where the default vessels are stationed in winter.
+var homeAreas = map[string][2]float64{
+	"OTSO":             {24.97, 60.16}, // Helsinki
+	"KONTIO":           {24.97, 60.16},
+	"POLARIS":          {24.97, 60.16},
+	"URHO":             {24.97, 60.16},
+	"SISU":             {24.97, 60.16},
+	"VOIMA":            {24.97, 60.16},
+	"FENNICA":          {24.97, 60.16},
+	"NORDICA":          {24.97, 60.16},
+	"ALE":              {13.3, 58.9},   // Lake Vänern
+	"ATLE":             {22.17, 65.58}, // Luleå
+	"FREJ":             {22.17, 65.58},
+	"ODEN":             {22.17, 65.58},
+	"YMER":             {22.17, 65.58},
+	"IDUN":             {22.17, 65.58},
+	"KRONPRINS HAAKON": {18.96, 69.65}, // Tromsø
+	"SVALBARD":         {15.6, 78.23},  // Longyearbyen
+}
+
+func TestDefaultVesselsAreNotOnLand(t *testing.T) {
+	for _, v := range config.ParseVesselNames(config.DefaultVessels) {
+		home, ok := homeAreas[v.Name]
+		if !ok {
+			t.Errorf("%s: no home area", v.Name)
+			continue
+		}
+		if Contains(home[0], home[1]) {
+			t.Errorf("%s: home area (%g, %g) is on land", v.Name, home[0], home[1])
+		}
+	}
+}
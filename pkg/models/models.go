@@ -7,6 +7,50 @@ type VesselMetadata struct {
 	Name    string    // Name of the vessel
 	Country string    // Inferred country
 	Updated time.Time // When the metadata was last updated
+	StaticData
+}
+
+// StaticData is the AIS static and voyage related data of a vessel. Zero
+// values mean the field was not reported.
+type StaticData struct {
+	IMO         int
+	CallSign    string
+	ShipType    int // AIS ship and cargo type code
+	Destination string
+	ETA         time.Time
+	Draught     float64 // metres
+	Length      float64 // metres
+	Beam        float64 // metres
+}
+
+// Merge overlays the reported fields of other on s. It combines partial
+// reports such as the two parts of AIS message type 24.
+func (s StaticData) Merge(other StaticData) StaticData {
+	if other.IMO != 0 {
+		s.IMO = other.IMO
+	}
+	if other.CallSign != "" {
+		s.CallSign = other.CallSign
+	}
+	if other.ShipType != 0 {
+		s.ShipType = other.ShipType
+	}
+	if other.Destination != "" {
+		s.Destination = other.Destination
+	}
+	if !other.ETA.IsZero() {
+		s.ETA = other.ETA
+	}
+	if other.Draught != 0 {
+		s.Draught = other.Draught
+	}
+	if other.Length != 0 {
+		s.Length = other.Length
+	}
+	if other.Beam != 0 {
+		s.Beam = other.Beam
+	}
+	return s
 }
 
 type LocationRecord struct {
@@ -15,12 +59,16 @@ type LocationRecord struct {
 	Latitude  float64
 	Longitude float64
 	Timestamp int64
-	// AIS movement fields
-	SpeedOverGround  float64 // knots
-	CourseOverGround float64 // degrees 0-360
-	Heading          float64 // degrees 0-360
-	NavigationStatus int     // 0-15
-	RateOfTurn       float64 // degrees per minute
+	// AIS movement fields; nil when the source did not report a value or
+	// reported the AIS "not available" sentinel.
+	SpeedOverGround  *float64 // knots
+	CourseOverGround *float64 // degrees 0-360
+	Heading          *float64 // degrees 0-360
+	NavigationStatus *int     // 0-15
+	RateOfTurn       *float64 // degrees per minute
+	// Anomaly is why the report failed the plausibility checks; empty for
+	// plausible reports.
+	Anomaly string
 }
 
 type IcebreakerPosition struct {
@@ -30,12 +78,15 @@ type IcebreakerPosition struct {
 	Latitude  float64
 	Longitude float64
 	Timestamp int64 // Unix timestamp of the location record
-	// AIS movement fields
-	SpeedOverGround  float64 // knots
-	CourseOverGround float64 // degrees 0-360
-	Heading          float64 // degrees 0-360
-	NavigationStatus int     // 0-15
-	RateOfTurn       float64 // degrees per minute
+	// AIS movement fields; nil when not available.
+	SpeedOverGround  *float64 // knots
+	CourseOverGround *float64 // degrees 0-360
+	Heading          *float64 // degrees 0-360
+	NavigationStatus *int     // 0-15
+	RateOfTurn       *float64 // degrees per minute
+	// Anomaly is copied from the location record.
+	Anomaly string
+	StaticData
 }
 
 type Snapshot struct {
@@ -43,4 +94,31 @@ type Snapshot struct {
 	LastRefresh      time.Time
 	RefreshDuration  time.Duration
 	LastRefreshError string
+	// RefreshBytes and RefreshRecords are what the latest refresh
+	// transferred from Digitraffic.
+	RefreshBytes   uint64
+	RefreshRecords uint64
+}
+
+// TrackPoint is one recorded position of a vessel track.
+type TrackPoint struct {
+	Latitude  float64
+	Longitude float64
+	Timestamp int64 // Unix timestamp of the location record
+	// nil when not available.
+	SpeedOverGround  *float64 // knots
+	CourseOverGround *float64 // degrees 0-360
+	NavigationStatus *int     // 0-15
+}
+
+// TrackPoint returns the position as a point of the vessel track.
+func (p IcebreakerPosition) TrackPoint() TrackPoint {
+	return TrackPoint{
+		Latitude:         p.Latitude,
+		Longitude:        p.Longitude,
+		Timestamp:        p.Timestamp,
+		SpeedOverGround:  p.SpeedOverGround,
+		CourseOverGround: p.CourseOverGround,
+		NavigationStatus: p.NavigationStatus,
+	}
 }
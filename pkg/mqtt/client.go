@@ -0,0 +1,221 @@
+// Package mqtt implements a minimal MQTT 3.1.1 subscriber, enough to follow
+// the Digitraffic vessel topics. Only QoS 0 subscriptions are requested;
+// QoS 1 deliveries are acknowledged but not deduplicated.
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type Options struct {
+	ClientID  string
+	Username  string
+	Password  string
+	KeepAlive time.Duration
+}
+
+type Client struct {
+	rw        io.ReadWriteCloser
+	br        *bufio.Reader
+	keepAlive time.Duration
+
+	wmu    sync.Mutex
+	nextID uint16
+
+	lastRecv  atomic.Int64
+	closeOnce sync.Once
+}
+
+// Connect performs the CONNECT/CONNACK exchange over rw. The caller is
+// expected to have already established the transport (TCP, TLS or WebSocket).
+func Connect(rw io.ReadWriteCloser, opts Options) (*Client, error) {
+	c := &Client{
+		rw:        rw,
+		br:        bufio.NewReader(rw),
+		keepAlive: opts.KeepAlive,
+	}
+
+	flags := byte(0x02) // clean session
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+
+	body := AppendString(nil, "MQTT")
+	body = append(body, 4, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive/time.Second))
+	body = AppendString(body, opts.ClientID)
+	if opts.Username != "" {
+		body = AppendString(body, opts.Username)
+		if opts.Password != "" {
+			body = AppendString(body, opts.Password)
+		}
+	}
+
+	if err := c.write(Packet{Type: TypeConnect, Body: body}); err != nil {
+		return nil, fmt.Errorf("mqtt: send connect: %w", err)
+	}
+
+	p, err := ReadPacket(c.br)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt: read connack: %w", err)
+	}
+	if p.Type != TypeConnack || len(p.Body) < 2 {
+		return nil, fmt.Errorf("mqtt: expected CONNACK, got packet type %d", p.Type)
+	}
+	if code := p.Body[1]; code != 0 {
+		return nil, fmt.Errorf("mqtt: connection refused with code %d", code)
+	}
+
+	c.lastRecv.Store(time.Now().UnixNano())
+	return c, nil
+}
+
+// Subscribe requests QoS 0 delivery for the given topic filters. The SUBACK
+// is checked by Run.
+func (c *Client) Subscribe(topics ...string) error {
+	if len(topics) == 0 {
+		return nil
+	}
+
+	c.wmu.Lock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	id := c.nextID
+	c.wmu.Unlock()
+
+	body := binary.BigEndian.AppendUint16(nil, id)
+	for _, topic := range topics {
+		body = AppendString(body, topic)
+		body = append(body, 0)
+	}
+	return c.write(Packet{Type: TypeSubscribe, Flags: 0x02, Body: body})
+}
+
+// Run delivers incoming messages to handler until the connection fails or
+// ctx is cancelled. Keep-alive pings are sent while it runs.
+func (c *Client) Run(parent context.Context, handler func(Message)) error {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		pingErr error
+	)
+	if c.keepAlive > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pingErr = c.keepAliveLoop(ctx)
+			if pingErr != nil {
+				c.closeTransport()
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		<-ctx.Done()
+		c.closeTransport()
+	}()
+
+	err := c.readLoop(handler)
+	cancel()
+	wg.Wait()
+
+	if parentErr := parent.Err(); parentErr != nil {
+		return parentErr
+	}
+	if pingErr != nil {
+		return pingErr
+	}
+	return err
+}
+
+// Close sends DISCONNECT and closes the transport.
+func (c *Client) Close() error {
+	_ = c.write(Packet{Type: TypeDisconnect})
+	c.closeTransport()
+	return nil
+}
+
+func (c *Client) readLoop(handler func(Message)) error {
+	for {
+		p, err := ReadPacket(c.br)
+		if err != nil {
+			return err
+		}
+		c.lastRecv.Store(time.Now().UnixNano())
+
+		switch p.Type {
+		case TypePublish:
+			msg, id, err := ParsePublish(p)
+			if err != nil {
+				return err
+			}
+			if (p.Flags>>1)&0x03 == 1 {
+				if err := c.write(Packet{Type: TypePuback, Body: binary.BigEndian.AppendUint16(nil, id)}); err != nil {
+					return err
+				}
+			}
+			handler(msg)
+		case TypeSuback:
+			if len(p.Body) < 3 {
+				return errors.New("mqtt: malformed SUBACK")
+			}
+			for _, code := range p.Body[2:] {
+				if code == 0x80 {
+					return errors.New("mqtt: subscription rejected by broker")
+				}
+			}
+		case TypePingresp, TypeUnsuback, TypePuback:
+		default:
+			return fmt.Errorf("mqtt: unexpected packet type %d", p.Type)
+		}
+	}
+}
+
+func (c *Client) keepAliveLoop(ctx context.Context) error {
+	ticker := time.NewTicker(c.keepAlive / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			last := time.Unix(0, c.lastRecv.Load())
+			if time.Since(last) > c.keepAlive*3/2 {
+				return errors.New("mqtt: keep-alive timeout")
+			}
+			if err := c.write(Packet{Type: TypePingreq}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *Client) write(p Packet) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return WritePacket(c.rw, p)
+}
+
+func (c *Client) closeTransport() {
+	c.closeOnce.Do(func() {
+		_ = c.rw.Close()
+	})
+}
@@ -0,0 +1,202 @@
+package mqtt_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/mqtt"
+	"github.com/joluc/icebreaker-exporter/pkg/mqtt/mqtttest"
+	"github.com/joluc/icebreaker-exporter/pkg/websocket"
+)
+
+func TestClientSubscribeAndReceive(t *testing.T) {
+	broker := mqtttest.NewBroker()
+	srv := httptest.NewServer(broker)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), []string{"mqtt"}, nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	client, err := mqtt.Connect(conn, mqtt.Options{ClientID: "test", KeepAlive: time.Second})
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	if err := client.Subscribe("vessels-v2/+/location"); err != nil {
+		t.Fatalf("Subscribe() error = %v", err)
+	}
+
+	received := make(chan mqtt.Message, 1)
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- client.Run(ctx, func(m mqtt.Message) { received <- m })
+	}()
+
+	for len(broker.Subscriptions()) == 0 {
+		select {
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for subscription")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	if n := broker.Publish("vessels-v2/230124000/location", []byte(`{"lat":60.1}`)); n != 1 {
+		t.Fatalf("Publish() delivered to %d clients, want 1", n)
+	}
+	broker.Publish("vessels-v2/230124000/metadata", []byte(`{}`))
+
+	select {
+	case m := <-received:
+		if m.Topic != "vessels-v2/230124000/location" || string(m.Payload) != `{"lat":60.1}` {
+			t.Errorf("unexpected message %q %q", m.Topic, m.Payload)
+		}
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for message")
+	}
+
+	broker.DisconnectAll()
+	select {
+	case err := <-runErr:
+		if err == nil {
+			t.Error("expected Run to report the dropped connection")
+		}
+	case <-ctx.Done():
+		t.Fatal("Run did not return after disconnect")
+	}
+}
+
+func TestClientPacketsAcrossWebSocketMessages(t *testing.T) {
+	// Brokers may split a packet over WebSocket messages or put several
+	// packets into one.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := websocket.Upgrade(w, r, "mqtt")
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		br := bufio.NewReader(conn)
+		if p, err := mqtt.ReadPacket(br); err != nil || p.Type != mqtt.TypeConnect {
+			return
+		}
+		var connack bytes.Buffer
+		_ = mqtt.WritePacket(&connack, mqtt.Packet{Type: mqtt.TypeConnack, Body: []byte{0, 0}})
+		_ = conn.WriteMessage(websocket.OpBinary, connack.Bytes()[:1])
+		_ = conn.WriteMessage(websocket.OpBinary, connack.Bytes()[1:])
+
+		var publishes bytes.Buffer
+		_ = mqtt.WritePacket(&publishes, mqtt.EncodePublish(mqtt.Message{Topic: "a", Payload: []byte("1")}))
+		_ = mqtt.WritePacket(&publishes, mqtt.EncodePublish(mqtt.Message{Topic: "b", Payload: bytes.Repeat([]byte("2"), 200)}))
+		split := publishes.Len() - 100
+		_ = conn.WriteMessage(websocket.OpBinary, publishes.Bytes()[:split])
+		_ = conn.WriteMessage(websocket.OpBinary, publishes.Bytes()[split:])
+		for {
+			if _, err := mqtt.ReadPacket(br); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), []string{"mqtt"}, nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	client, err := mqtt.Connect(conn, mqtt.Options{ClientID: "test"})
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	received := make(chan mqtt.Message, 2)
+	go func() { _ = client.Run(ctx, func(m mqtt.Message) { received <- m }) }()
+	for _, want := range []mqtt.Message{{Topic: "a", Payload: []byte("1")}, {Topic: "b", Payload: bytes.Repeat([]byte("2"), 200)}} {
+		select {
+		case m := <-received:
+			if m.Topic != want.Topic || !bytes.Equal(m.Payload, want.Payload) {
+				t.Errorf("got message %q with %d bytes, want %q with %d bytes", m.Topic, len(m.Payload), want.Topic, len(want.Payload))
+			}
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for message")
+		}
+	}
+}
+
+func TestClientKeepAlive(t *testing.T) {
+	const keepAlive = 100 * time.Millisecond
+	local, remote := net.Pipe()
+
+	// The broker answers the first three pings, then goes silent.
+	var pings atomic.Int64
+	go func() {
+		br := bufio.NewReader(remote)
+		for {
+			p, err := mqtt.ReadPacket(br)
+			if err != nil {
+				return
+			}
+			switch p.Type {
+			case mqtt.TypeConnect:
+				_ = mqtt.WritePacket(remote, mqtt.Packet{Type: mqtt.TypeConnack, Body: []byte{0, 0}})
+			case mqtt.TypePingreq:
+				if pings.Add(1) <= 3 {
+					_ = mqtt.WritePacket(remote, mqtt.Packet{Type: mqtt.TypePingresp})
+				}
+			}
+		}
+	}()
+
+	client, err := mqtt.Connect(local, mqtt.Options{ClientID: "test", KeepAlive: keepAlive})
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	err = client.Run(ctx, func(mqtt.Message) {})
+	if err == nil || ctx.Err() != nil {
+		t.Fatalf("expected a keep-alive timeout, got %v", err)
+	}
+	// The answered pings, sent every keepAlive/2, keep the connection for at
+	// least 1.5 keep-alive periods; the unanswered ones end it soon after.
+	if elapsed := time.Since(start); elapsed < 3*keepAlive/2 || elapsed > 10*keepAlive {
+		t.Errorf("connection ended after %v", elapsed)
+	}
+	if n := pings.Load(); n < 4 {
+		t.Errorf("expected pings to continue after the answered ones, got %d", n)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"vessels-v2/230124000/location", "vessels-v2/230124000/location", true},
+		{"vessels-v2/+/location", "vessels-v2/230124000/location", true},
+		{"vessels-v2/#", "vessels-v2/230124000/metadata", true},
+		{"vessels-v2/+/location", "vessels-v2/230124000/metadata", false},
+		{"vessels-v2/+", "vessels-v2/230124000/location", false},
+	}
+	for _, tt := range tests {
+		if got := mqtttest.Match(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package mqtttest provides an in-process MQTT-over-WebSocket broker
+// stand-in for tests, in the spirit of net/http/httptest.
+package mqtttest
+
+import (
+	"bufio"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/joluc/icebreaker-exporter/pkg/mqtt"
+	"github.com/joluc/icebreaker-exporter/pkg/websocket"
+)
+
+// Broker accepts MQTT clients over WebSocket, records their subscriptions
+// and forwards messages passed to Publish. Serve it with httptest.NewServer.
+type Broker struct {
+	mu       sync.Mutex
+	clients  map[*session]struct{}
+	connects int
+}
+
+type session struct {
+	conn *websocket.Conn
+	wmu  sync.Mutex
+
+	mu     sync.Mutex
+	topics []string
+}
+
+func NewBroker() *Broker {
+	return &Broker{clients: map[*session]struct{}{}}
+}
+
+func (b *Broker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r, "mqtt")
+	if err != nil {
+		return
+	}
+	s := &session{conn: conn}
+	defer func() {
+		b.mu.Lock()
+		delete(b.clients, s)
+		b.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	br := bufio.NewReader(conn)
+	for {
+		p, err := mqtt.ReadPacket(br)
+		if err != nil {
+			return
+		}
+		switch p.Type {
+		case mqtt.TypeConnect:
+			b.mu.Lock()
+			b.clients[s] = struct{}{}
+			b.connects++
+			b.mu.Unlock()
+			s.write(mqtt.Packet{Type: mqtt.TypeConnack, Body: []byte{0, 0}})
+		case mqtt.TypeSubscribe:
+			if len(p.Body) < 2 {
+				return
+			}
+			id := p.Body[:2]
+			rest := p.Body[2:]
+			var codes []byte
+			for len(rest) > 0 {
+				topic, tail, err := mqtt.ReadString(rest)
+				if err != nil || len(tail) < 1 {
+					return
+				}
+				rest = tail[1:]
+				s.mu.Lock()
+				s.topics = append(s.topics, topic)
+				s.mu.Unlock()
+				codes = append(codes, 0)
+			}
+			s.write(mqtt.Packet{Type: mqtt.TypeSuback, Body: append(append([]byte{}, id...), codes...)})
+		case mqtt.TypePingreq:
+			s.write(mqtt.Packet{Type: mqtt.TypePingresp})
+		case mqtt.TypeDisconnect:
+			return
+		}
+	}
+}
+
+// Publish delivers payload to every client subscribed to a matching filter
+// and reports how many clients received it.
+func (b *Broker) Publish(topic string, payload []byte) int {
+	b.mu.Lock()
+	sessions := make([]*session, 0, len(b.clients))
+	for s := range b.clients {
+		sessions = append(sessions, s)
+	}
+	b.mu.Unlock()
+
+	delivered := 0
+	for _, s := range sessions {
+		if !s.subscribed(topic) {
+			continue
+		}
+		s.write(mqtt.EncodePublish(mqtt.Message{Topic: topic, Payload: payload}))
+		delivered++
+	}
+	return delivered
+}
+
+// Subscriptions returns the sorted topic filters of all connected clients.
+func (b *Broker) Subscriptions() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var out []string
+	for s := range b.clients {
+		s.mu.Lock()
+		out = append(out, s.topics...)
+		s.mu.Unlock()
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Connects returns the number of CONNECT exchanges seen so far.
+func (b *Broker) Connects() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.connects
+}
+
+// DisconnectAll drops every client connection, simulating a broker outage.
+func (b *Broker) DisconnectAll() {
+	b.mu.Lock()
+	sessions := make([]*session, 0, len(b.clients))
+	for s := range b.clients {
+		sessions = append(sessions, s)
+	}
+	b.clients = map[*session]struct{}{}
+	b.mu.Unlock()
+
+	for _, s := range sessions {
+		_ = s.conn.Close()
+	}
+}
+
+func (s *session) write(p mqtt.Packet) {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	_ = mqtt.WritePacket(s.conn, p)
+}
+
+func (s *session) subscribed(topic string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, filter := range s.topics {
+		if Match(filter, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether topic matches an MQTT filter with + and # wildcards.
+func Match(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, part := range f {
+		if part == "#" {
+			return true
+		}
+		if i >= len(t) {
+			return false
+		}
+		if part != "+" && part != t[i] {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
@@ -0,0 +1,140 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// PacketType is the MQTT 3.1.1 control packet type.
+type PacketType byte
+
+const (
+	TypeConnect     PacketType = 1
+	TypeConnack     PacketType = 2
+	TypePublish     PacketType = 3
+	TypePuback      PacketType = 4
+	TypeSubscribe   PacketType = 8
+	TypeSuback      PacketType = 9
+	TypeUnsubscribe PacketType = 10
+	TypeUnsuback    PacketType = 11
+	TypePingreq     PacketType = 12
+	TypePingresp    PacketType = 13
+	TypeDisconnect  PacketType = 14
+)
+
+// maxPacketSize bounds the remaining length accepted from the wire.
+const maxPacketSize = 1 << 20
+
+// Packet is a raw control packet: the fixed header type and flags plus the
+// variable header and payload as a single body.
+type Packet struct {
+	Type  PacketType
+	Flags byte
+	Body  []byte
+}
+
+// ReadPacket reads one control packet.
+func ReadPacket(r *bufio.Reader) (Packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return Packet{}, err
+	}
+
+	var length, multiplier int = 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return Packet{}, errors.New("mqtt: malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return Packet{}, err
+		}
+		length += int(b&0x7F) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	if length > maxPacketSize {
+		return Packet{}, fmt.Errorf("mqtt: packet of %d bytes exceeds limit", length)
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return Packet{}, err
+	}
+	return Packet{Type: PacketType(first >> 4), Flags: first & 0x0F, Body: body}, nil
+}
+
+// WritePacket encodes p in a single Write call.
+func WritePacket(w io.Writer, p Packet) error {
+	buf := make([]byte, 0, len(p.Body)+5)
+	buf = append(buf, byte(p.Type)<<4|p.Flags&0x0F)
+	n := len(p.Body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			break
+		}
+	}
+	buf = append(buf, p.Body...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// AppendString appends a length-prefixed UTF-8 string.
+func AppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// ReadString consumes a length-prefixed string from b.
+func ReadString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errors.New("mqtt: short string")
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return "", nil, errors.New("mqtt: short string")
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+// Message is an application message delivered by the broker.
+type Message struct {
+	Topic   string
+	Payload []byte
+}
+
+// ParsePublish decodes a PUBLISH packet. The packet identifier of QoS 1/2
+// messages is returned so the caller can acknowledge it.
+func ParsePublish(p Packet) (Message, uint16, error) {
+	topic, rest, err := ReadString(p.Body)
+	if err != nil {
+		return Message{}, 0, err
+	}
+	var id uint16
+	if qos := (p.Flags >> 1) & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return Message{}, 0, errors.New("mqtt: missing packet identifier")
+		}
+		id = binary.BigEndian.Uint16(rest)
+		rest = rest[2:]
+	}
+	return Message{Topic: topic, Payload: rest}, id, nil
+}
+
+// EncodePublish builds a QoS 0 PUBLISH packet.
+func EncodePublish(m Message) Packet {
+	body := AppendString(nil, m.Topic)
+	body = append(body, m.Payload...)
+	return Packet{Type: TypePublish, Body: body}
+}
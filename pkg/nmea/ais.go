@@ -0,0 +1,180 @@
+package nmea
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/ais"
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+const (
+	lonNotAvailable = 181 * 600000
+	latNotAvailable = 91 * 600000
+)
+
+// Report is the result of decoding one AIS message. Exactly one of Location
+// and Vessel is set.
+type Report struct {
+	MessageType int
+	Location    *models.LocationRecord
+	Vessel      *models.VesselMetadata
+}
+
+// decodePayload decodes a reassembled payload received at received, which
+// is zero when the time is unknown.
+func decodePayload(data string, fillBits int, received time.Time) (*Report, error) {
+	p, err := dearmour(data, fillBits)
+	if err != nil {
+		return nil, err
+	}
+	if p.len() < 38 {
+		return nil, fmt.Errorf("%w: payload too short (%d bits)", ErrMalformed, p.len())
+	}
+
+	msgType := int(p.uint(0, 6))
+	mmsi := strconv.FormatUint(p.uint(8, 30), 10)
+
+	switch msgType {
+	case 1, 2, 3:
+		if p.len() < 168 {
+			return nil, fmt.Errorf("%w: type %d payload too short (%d bits)", ErrMalformed, msgType, p.len())
+		}
+		loc, ok := decodePosition(p, mmsi, received, positionLayout{
+			lon: 61, lat: 89, sog: 50, cog: 116, heading: 128, second: 137,
+		})
+		if !ok {
+			return nil, nil
+		}
+		loc.NavigationStatus = ais.NavigationStatus(int(p.uint(38, 4)))
+		loc.RateOfTurn = ais.RateOfTurn(float64(p.int(42, 8)))
+		return &Report{MessageType: msgType, Location: &loc}, nil
+
+	case 18, 19:
+		if p.len() < 168 {
+			return nil, fmt.Errorf("%w: type %d payload too short (%d bits)", ErrMalformed, msgType, p.len())
+		}
+		loc, ok := decodePosition(p, mmsi, received, positionLayout{
+			lon: 57, lat: 85, sog: 46, cog: 112, heading: 124, second: 133,
+		})
+		if !ok {
+			return nil, nil
+		}
+		// Class B reports carry neither navigation status nor rate of turn.
+		if msgType == 19 && p.len() >= 263 {
+			// Extended Class B reports carry the vessel name as well.
+			loc.Name = p.string(143, 120)
+		}
+		return &Report{MessageType: msgType, Location: &loc}, nil
+
+	case 5:
+		if p.len() < 420 {
+			return nil, fmt.Errorf("%w: type 5 payload too short (%d bits)", ErrMalformed, p.len())
+		}
+		name := p.string(112, 120)
+		if name == "" {
+			return nil, nil
+		}
+		ref := received
+		if ref.IsZero() {
+			ref = time.Now()
+		}
+		v := &models.VesselMetadata{
+			MMSI:    mmsi,
+			Name:    name,
+			Country: ais.CountryCode(mmsi),
+			Updated: received,
+			StaticData: models.StaticData{
+				IMO:         int(p.uint(40, 30)),
+				CallSign:    p.string(70, 42),
+				ShipType:    int(p.uint(232, 8)),
+				ETA:         ais.ETA(int(p.uint(274, 20)), ref),
+				Draught:     float64(p.uint(294, 8)) / 10,
+				Destination: p.string(302, 120),
+			},
+		}
+		v.Length, v.Beam = dimensions(p, 240)
+		return &Report{MessageType: msgType, Vessel: v}, nil
+
+	case 24:
+		if p.len() < 160 {
+			return nil, fmt.Errorf("%w: type 24 payload too short (%d bits)", ErrMalformed, p.len())
+		}
+		if part := p.uint(38, 2); part != 0 {
+			// Part B carries ship type, call sign and dimensions but no
+			// name; consumers merge it with part A.
+			v := &models.VesselMetadata{
+				MMSI:    mmsi,
+				Country: ais.CountryCode(mmsi),
+				Updated: received,
+				StaticData: models.StaticData{
+					ShipType: int(p.uint(40, 8)),
+					CallSign: p.string(90, 42),
+				},
+			}
+			v.Length, v.Beam = dimensions(p, 132)
+			return &Report{MessageType: msgType, Vessel: v}, nil
+		}
+		name := p.string(40, 120)
+		if name == "" {
+			return nil, nil
+		}
+		return &Report{MessageType: msgType, Vessel: &models.VesselMetadata{
+			MMSI:    mmsi,
+			Name:    name,
+			Country: ais.CountryCode(mmsi),
+			Updated: received,
+		}}, nil
+	}
+
+	return nil, nil
+}
+
+// dimensions decodes the 30-bit reference point block (bow, stern, port,
+// starboard) starting at bit start.
+func dimensions(p payload, start int) (length, beam float64) {
+	return ais.Dimensions(int(p.uint(start, 9)), int(p.uint(start+9, 9)), int(p.uint(start+18, 6)), int(p.uint(start+24, 6)))
+}
+
+// positionLayout holds the bit offsets of the kinematic fields, which differ
+// between Class A and Class B position reports.
+type positionLayout struct {
+	lon, lat, sog, cog, heading, second int
+}
+
+func decodePosition(p payload, mmsi string, received time.Time, l positionLayout) (models.LocationRecord, bool) {
+	lon := p.int(l.lon, 28)
+	lat := p.int(l.lat, 27)
+	if lon == lonNotAvailable || lat == latNotAvailable {
+		return models.LocationRecord{}, false
+	}
+
+	return models.LocationRecord{
+		MMSI:             mmsi,
+		Latitude:         float64(lat) / 600000,
+		Longitude:        float64(lon) / 600000,
+		Timestamp:        reportTimestamp(received, int(p.uint(l.second, 6))),
+		SpeedOverGround:  ais.Speed(float64(p.uint(l.sog, 10)) / 10),
+		CourseOverGround: ais.Course(float64(p.uint(l.cog, 12)) / 10),
+		Heading:          ais.Heading(float64(p.uint(l.heading, 9))),
+	}, true
+}
+
+// reportTimestamp combines the receive time with the UTC second carried in
+// the message. Values of 60 and above mean the second is not available. An
+// unknown receive time gives an unknown timestamp, zero.
+func reportTimestamp(received time.Time, second int) int64 {
+	if received.IsZero() {
+		return 0
+	}
+	ts := received.Unix()
+	if second > 59 {
+		return ts
+	}
+	diff := int64(received.UTC().Second() - second)
+	if diff < 0 {
+		diff += 60
+	}
+	return ts - diff
+}
@@ -0,0 +1,75 @@
+package nmea
+
+import (
+	"fmt"
+	"strings"
+)
+
+// payload is a de-armoured AIS message as a bit string.
+type payload struct {
+	bits []byte // one bit per byte, MSB first
+}
+
+// dearmour converts the 6-bit ASCII armouring of an AIVDM payload into bits,
+// dropping fillBits padding bits from the end.
+func dearmour(data string, fillBits int) (payload, error) {
+	bits := make([]byte, 0, len(data)*6)
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if c < 48 || c > 119 || (c > 87 && c < 96) {
+			return payload{}, fmt.Errorf("%w: invalid payload character %q", ErrMalformed, c)
+		}
+		v := c - 48
+		if v > 40 {
+			v -= 8
+		}
+		for shift := 5; shift >= 0; shift-- {
+			bits = append(bits, (v>>shift)&1)
+		}
+	}
+	if fillBits < 0 || fillBits > 5 || fillBits > len(bits) {
+		return payload{}, fmt.Errorf("%w: invalid fill bits %d", ErrMalformed, fillBits)
+	}
+	return payload{bits: bits[:len(bits)-fillBits]}, nil
+}
+
+func (p payload) len() int { return len(p.bits) }
+
+// uint reads an unsigned field. Bits beyond the end of the payload read as
+// zero, which is how receivers treat truncated messages.
+func (p payload) uint(start, width int) uint64 {
+	var v uint64
+	for i := start; i < start+width; i++ {
+		v <<= 1
+		if i < len(p.bits) {
+			v |= uint64(p.bits[i])
+		}
+	}
+	return v
+}
+
+// int reads a two's complement signed field.
+func (p payload) int(start, width int) int64 {
+	v := p.uint(start, width)
+	if width > 0 && v&(1<<(width-1)) != 0 {
+		return int64(v) - int64(1)<<width
+	}
+	return int64(v)
+}
+
+// string reads a 6-bit text field, stopping at the '@' terminator and
+// trimming trailing padding.
+func (p payload) string(start, width int) string {
+	var b strings.Builder
+	for i := start; i+6 <= start+width && i+6 <= len(p.bits); i += 6 {
+		v := byte(p.uint(i, 6))
+		if v == 0 {
+			break
+		}
+		if v < 32 {
+			v += 64
+		}
+		b.WriteByte(v)
+	}
+	return strings.TrimRight(b.String(), " ")
+}
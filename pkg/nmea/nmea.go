@@ -0,0 +1,217 @@
+// Package nmea decodes AIS messages carried in NMEA 0183 !AIVDM/!AIVDO
+// sentences into the same records the Digitraffic parser produces.
+package nmea
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrChecksum  = errors.New("nmea: checksum mismatch")
+	ErrMalformed = errors.New("nmea: malformed sentence")
+)
+
+// fragmentTTL bounds how long an incomplete multi-sentence message is kept.
+const fragmentTTL = 30 * time.Second
+
+// Sentence is one parsed !AIVDM or !AIVDO line.
+type Sentence struct {
+	Talker         string // e.g. "AIVDM"
+	FragmentCount  int
+	FragmentNumber int
+	SequentialID   string
+	Channel        string
+	Payload        string
+	FillBits       int
+	// Time is the c: timestamp of a leading NMEA 4.0 tag block; zero when
+	// there is none.
+	Time time.Time
+}
+
+// ParseSentence validates the checksum and splits an AIVDM/AIVDO sentence
+// into its fields. Of a leading NMEA 4.0 tag block (\...\) only the c:
+// timestamp is used.
+func ParseSentence(line string) (Sentence, error) {
+	line = strings.TrimSpace(line)
+	var received time.Time
+	if rest, ok := strings.CutPrefix(line, `\`); ok {
+		if tags, sentence, ok := strings.Cut(rest, `\`); ok {
+			received = tagTime(tags)
+			line = sentence
+		}
+	}
+	if i := strings.IndexByte(line, '!'); i > 0 {
+		line = line[i:]
+	}
+	if !strings.HasPrefix(line, "!") {
+		return Sentence{}, fmt.Errorf("%w: missing '!' start delimiter", ErrMalformed)
+	}
+
+	body, checksum, ok := strings.Cut(line[1:], "*")
+	if !ok || len(checksum) < 2 {
+		return Sentence{}, fmt.Errorf("%w: missing checksum", ErrMalformed)
+	}
+	want, err := strconv.ParseUint(checksum[:2], 16, 8)
+	if err != nil {
+		return Sentence{}, fmt.Errorf("%w: invalid checksum %q", ErrMalformed, checksum)
+	}
+	var got byte
+	for i := 0; i < len(body); i++ {
+		got ^= body[i]
+	}
+	if got != byte(want) {
+		return Sentence{}, fmt.Errorf("%w: got %02X, want %02X", ErrChecksum, got, want)
+	}
+
+	fields := strings.Split(body, ",")
+	if len(fields) != 7 {
+		return Sentence{}, fmt.Errorf("%w: expected 7 fields, got %d", ErrMalformed, len(fields))
+	}
+	talker := fields[0]
+	if len(talker) != 5 || (talker[2:] != "VDM" && talker[2:] != "VDO") {
+		return Sentence{}, fmt.Errorf("%w: unsupported sentence %q", ErrMalformed, talker)
+	}
+
+	count, err1 := strconv.Atoi(fields[1])
+	number, err2 := strconv.Atoi(fields[2])
+	fill, err3 := strconv.Atoi(fields[6])
+	if err1 != nil || err2 != nil || err3 != nil || count < 1 || number < 1 || number > count {
+		return Sentence{}, fmt.Errorf("%w: invalid fragment fields", ErrMalformed)
+	}
+
+	return Sentence{
+		Talker:         talker,
+		FragmentCount:  count,
+		FragmentNumber: number,
+		SequentialID:   fields[3],
+		Channel:        fields[4],
+		Payload:        fields[5],
+		FillBits:       fill,
+		Time:           received,
+	}, nil
+}
+
+// tagTime returns the c: timestamp of a tag block, in Unix seconds or, as
+// some receivers write it, milliseconds. It returns the zero time when there
+// is none.
+func tagTime(tags string) time.Time {
+	tags, _, _ = strings.Cut(tags, "*")
+	for _, tag := range strings.Split(tags, ",") {
+		value, ok := strings.CutPrefix(tag, "c:")
+		if !ok {
+			continue
+		}
+		ts, err := strconv.ParseInt(value, 10, 64)
+		switch {
+		case err != nil || ts <= 0:
+			return time.Time{}
+		case ts >= 1e11:
+			return time.UnixMilli(ts)
+		default:
+			return time.Unix(ts, 0)
+		}
+	}
+	return time.Time{}
+}
+
+type fragmentKey struct {
+	talker string
+	seqID  string
+	count  int
+}
+
+type fragmentBuffer struct {
+	parts    []string
+	fill     int
+	started  time.Time
+	received time.Time
+}
+
+// Decoder turns a stream of sentences into reports, reassembling
+// multi-fragment messages. It is not safe for concurrent use; run one
+// Decoder per input stream.
+type Decoder struct {
+	fragments map[fragmentKey]*fragmentBuffer
+	now       func() time.Time
+	// replay is set for recorded sentences, which were not received now.
+	replay bool
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{
+		fragments: map[fragmentKey]*fragmentBuffer{},
+		now:       time.Now,
+	}
+}
+
+// NewReplayDecoder returns a Decoder for recorded sentences. Their reports
+// carry the time of the tag block; without one the time is unknown and the
+// location timestamps are zero.
+func NewReplayDecoder() *Decoder {
+	d := NewDecoder()
+	d.replay = true
+	return d
+}
+
+// received returns when the sentence was received: the time of its tag
+// block, or now for live sentences. It is zero for recorded sentences
+// without a tag block.
+func (d *Decoder) received(s Sentence, now time.Time) time.Time {
+	switch {
+	case !s.Time.IsZero():
+		return s.Time
+	case d.replay:
+		return time.Time{}
+	default:
+		return now
+	}
+}
+
+// Decode consumes one line. It returns nil without error while a
+// multi-sentence message is still incomplete and for message types the
+// exporter does not use.
+func (d *Decoder) Decode(line string) (*Report, error) {
+	s, err := ParseSentence(line)
+	if err != nil {
+		return nil, err
+	}
+
+	now := d.now()
+	if s.FragmentCount == 1 {
+		return decodePayload(s.Payload, s.FillBits, d.received(s, now))
+	}
+
+	d.expire(now)
+	key := fragmentKey{talker: s.Talker, seqID: s.SequentialID, count: s.FragmentCount}
+	buf := d.fragments[key]
+	if s.FragmentNumber == 1 {
+		// Receivers tag the first fragment of a message.
+		buf = &fragmentBuffer{parts: make([]string, 0, s.FragmentCount), started: now, received: d.received(s, now)}
+		d.fragments[key] = buf
+	}
+	if buf == nil || len(buf.parts) != s.FragmentNumber-1 {
+		// Out-of-order or orphaned fragment: drop what we have.
+		delete(d.fragments, key)
+		return nil, fmt.Errorf("%w: unexpected fragment %d of %d", ErrMalformed, s.FragmentNumber, s.FragmentCount)
+	}
+	buf.parts = append(buf.parts, s.Payload)
+	buf.fill = s.FillBits
+
+	if s.FragmentNumber < s.FragmentCount {
+		return nil, nil
+	}
+	delete(d.fragments, key)
+	return decodePayload(strings.Join(buf.parts, ""), buf.fill, buf.received)
+}
+
+func (d *Decoder) expire(now time.Time) {
+	for key, buf := range d.fragments {
+		if now.Sub(buf.started) > fragmentTTL {
+			delete(d.fragments, key)
+		}
+	}
+}
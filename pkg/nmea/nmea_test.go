@@ -0,0 +1,207 @@
+package nmea
+
+import (
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+// Sample sentences from the gpsd AIVDM/AIVDO protocol decoding reference.
+const (
+	sampleType1   = "!AIVDM,1,1,,B,177KQJ5000G?tO`K>RA1wUbN0TKH,0*5C"
+	sampleType5a  = "!AIVDM,2,1,1,A,55?MbV02;H;s<HtKR20EHE:0@T4@Dn2222222216L961O5Gf0NSQEp6ClRp8,0*1C"
+	sampleType5b  = "!AIVDM,2,2,1,A,88888888880,2*25"
+	sampleType18  = "!AIVDM,1,1,,A,B52K>;h00Fc>jpUlNV@ikwpUoP06,0*4C"
+	sampleType19  = "!AIVDM,1,1,,B,C5N3SRgPEnJGEBT>NhWAwwo862PaLELTBJ:V00000000S0D:R220,0*0B"
+	sampleType24A = "!AIVDM,1,1,,A,H42O55i18tMET00000000000000,2*6D"
+	sampleType24B = "!AIVDM,1,1,,A,H42O55lti4hhhilD3nink000?050,0*40"
+)
+
+func newTestDecoder() *Decoder {
+	d := NewDecoder()
+	d.now = func() time.Time { return time.Date(2024, 1, 15, 12, 0, 20, 0, time.UTC) }
+	return d
+}
+
+func approx(a, b float64) bool { return math.Abs(a-b) < 1e-5 }
+
+func TestParseSentence(t *testing.T) {
+	s, err := ParseSentence(`\s:station1,c:1700000000*5A\` + sampleType5a)
+	if err != nil {
+		t.Fatalf("ParseSentence() error = %v", err)
+	}
+	if s.Talker != "AIVDM" || s.FragmentCount != 2 || s.FragmentNumber != 1 || s.SequentialID != "1" || s.Channel != "A" {
+		t.Errorf("unexpected sentence %+v", s)
+	}
+	if !s.Time.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Time = %v, want the tag block time", s.Time)
+	}
+
+	if _, err := ParseSentence(strings.Replace(sampleType1, "*5C", "*5D", 1)); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected ErrChecksum, got %v", err)
+	}
+	if _, err := ParseSentence("$GPGGA,123519,4807.038,N*47"); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected ErrMalformed, got %v", err)
+	}
+}
+
+func TestDecodeClassAPosition(t *testing.T) {
+	r, err := newTestDecoder().Decode(sampleType1)
+	if err != nil || r == nil || r.Location == nil {
+		t.Fatalf("Decode() = %+v, %v", r, err)
+	}
+	loc := r.Location
+	if loc.MMSI != "477553000" || *loc.NavigationStatus != 5 {
+		t.Errorf("unexpected identity/status %+v", loc)
+	}
+	if !approx(loc.Latitude, 47.582833) || !approx(loc.Longitude, -122.345833) {
+		t.Errorf("unexpected position %.6f,%.6f", loc.Latitude, loc.Longitude)
+	}
+	if *loc.SpeedOverGround != 0 || *loc.CourseOverGround != 51 || *loc.Heading != 181 || *loc.RateOfTurn != 0 {
+		t.Errorf("unexpected movement %+v", loc)
+	}
+	// Second 15 of the minute, received at second 20.
+	if want := time.Date(2024, 1, 15, 12, 0, 15, 0, time.UTC).Unix(); loc.Timestamp != want {
+		t.Errorf("Timestamp = %d, want %d", loc.Timestamp, want)
+	}
+}
+
+func TestDecodeMultiFragmentStaticData(t *testing.T) {
+	d := newTestDecoder()
+	r, err := d.Decode(sampleType5a)
+	if err != nil || r != nil {
+		t.Fatalf("first fragment: Decode() = %+v, %v; want pending", r, err)
+	}
+	r, err = d.Decode(sampleType5b)
+	if err != nil || r == nil || r.Vessel == nil {
+		t.Fatalf("second fragment: Decode() = %+v, %v", r, err)
+	}
+	if r.Vessel.MMSI != "351759000" || r.Vessel.Name != "EVER DIADEM" {
+		t.Errorf("unexpected vessel %+v", r.Vessel)
+	}
+	want := models.StaticData{
+		IMO:         9134270,
+		CallSign:    "3FOF8",
+		ShipType:    70,
+		Destination: "NEW YORK",
+		ETA:         time.Date(2024, 5, 15, 14, 0, 0, 0, time.UTC),
+		Draught:     12.2,
+		Length:      295,
+		Beam:        32,
+	}
+	if r.Vessel.StaticData != want {
+		t.Errorf("unexpected static data %+v, want %+v", r.Vessel.StaticData, want)
+	}
+
+	// An orphaned second fragment is rejected.
+	if _, err := d.Decode(sampleType5b); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected ErrMalformed for orphaned fragment, got %v", err)
+	}
+}
+
+func TestDecodeClassB(t *testing.T) {
+	d := newTestDecoder()
+
+	r, err := d.Decode(sampleType18)
+	if err != nil || r == nil || r.Location == nil {
+		t.Fatalf("type 18: Decode() = %+v, %v", r, err)
+	}
+	if r.Location.MMSI != "338087471" || !approx(r.Location.Latitude, 40.68454) || !approx(r.Location.Longitude, -74.072132) {
+		t.Errorf("type 18: unexpected location %+v", r.Location)
+	}
+	if *r.Location.SpeedOverGround != 0.1 || *r.Location.CourseOverGround != 79.6 {
+		t.Errorf("type 18: unexpected movement %+v", r.Location)
+	}
+	// Heading 511 is "not available"; Class B carries no status or turn rate.
+	if r.Location.Heading != nil || r.Location.NavigationStatus != nil || r.Location.RateOfTurn != nil {
+		t.Errorf("type 18: expected unavailable fields to be nil, got %+v", r.Location)
+	}
+
+	r, err = d.Decode(sampleType19)
+	if err != nil || r == nil || r.Location == nil {
+		t.Fatalf("type 19: Decode() = %+v, %v", r, err)
+	}
+	if r.Location.MMSI != "367059850" || r.Location.Name != "CAPT.J.RIMES" || *r.Location.SpeedOverGround != 8.7 {
+		t.Errorf("type 19: unexpected location %+v", r.Location)
+	}
+
+	r, err = d.Decode(sampleType24A)
+	if err != nil || r == nil || r.Vessel == nil {
+		t.Fatalf("type 24A: Decode() = %+v, %v", r, err)
+	}
+	if r.Vessel.MMSI != "271041815" || r.Vessel.Name != "PROGUY" {
+		t.Errorf("type 24A: unexpected vessel %+v", r.Vessel)
+	}
+
+	r, err = d.Decode(sampleType24B)
+	if err != nil || r == nil || r.Vessel == nil {
+		t.Fatalf("type 24B: Decode() = %+v, %v", r, err)
+	}
+	if r.Vessel.MMSI != "271041815" || r.Vessel.Name != "" || r.Vessel.CallSign != "TC6163" || r.Vessel.ShipType != 60 || r.Vessel.Length != 15 || r.Vessel.Beam != 5 {
+		t.Errorf("type 24B: unexpected vessel %+v", r.Vessel)
+	}
+}
+
+func TestScan(t *testing.T) {
+	input := strings.Join([]string{sampleType1, "", "garbage", sampleType5a, sampleType5b}, "\n")
+
+	var reports, failures int
+	err := Scan(strings.NewReader(input), newTestDecoder(), func(r *Report, err error) {
+		if err != nil {
+			failures++
+			return
+		}
+		reports++
+	})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if reports != 2 || failures != 1 {
+		t.Errorf("got %d reports and %d failures, want 2 and 1", reports, failures)
+	}
+}
+
+func TestReadFileReplaysTagBlockTimes(t *testing.T) {
+	// Recorded on 2020-09-13 at 12:26:40 UTC.
+	input := strings.Join([]string{
+		`\s:rx1,c:1600000000*00\` + sampleType1,
+		sampleType1,
+		`\c:1600000000000*6E\` + sampleType5a,
+		sampleType5b,
+	}, "\n")
+	path := filepath.Join(t.TempDir(), "ais.nmea")
+	if err := os.WriteFile(path, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var reports []*Report
+	err := ReadFile(path, func(r *Report, err error) {
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+			return
+		}
+		reports = append(reports, r)
+	})
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if len(reports) != 3 {
+		t.Fatalf("got %d reports, want 3", len(reports))
+	}
+	// Second 15 of the minute of the tag block.
+	if want := time.Date(2020, 9, 13, 12, 26, 15, 0, time.UTC).Unix(); reports[0].Location.Timestamp != want {
+		t.Errorf("tagged report: Timestamp = %d, want %d", reports[0].Location.Timestamp, want)
+	}
+	if ts := reports[1].Location.Timestamp; ts != 0 {
+		t.Errorf("untagged report: Timestamp = %d, want unknown", ts)
+	}
+	if want := time.Unix(1600000000, 0); !reports[2].Vessel.Updated.Equal(want) {
+		t.Errorf("tagged fragments: Updated = %v, want %v", reports[2].Vessel.Updated, want)
+	}
+}
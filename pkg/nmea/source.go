@@ -0,0 +1,119 @@
+package nmea
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Handler is called for every decoded report and for every line that could
+// not be decoded. Handlers passed to ListenTCP must be safe for concurrent
+// use, since each connection is served by its own goroutine.
+type Handler func(report *Report, err error)
+
+// Scan decodes r line by line until EOF.
+func Scan(r io.Reader, d *Decoder, fn Handler) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		feed(d, sc.Text(), fn)
+	}
+	return sc.Err()
+}
+
+// ReadFile decodes a file of recorded sentences, e.g. a receiver log. The
+// reports carry the time of the tag blocks; see NewReplayDecoder.
+func ReadFile(path string, fn Handler) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return Scan(f, NewReplayDecoder(), fn)
+}
+
+// ListenTCP accepts connections from AIS receivers pushing sentences over
+// TCP until ctx is cancelled.
+func ListenTCP(ctx context.Context, addr string, fn Handler) error {
+	var lc net.ListenConfig
+	ln, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("accepting nmea sentences over tcp", "address", ln.Addr().String())
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer conn.Close()
+			stop := context.AfterFunc(ctx, func() { conn.Close() })
+			defer stop()
+
+			if err := Scan(conn, NewDecoder(), fn); err != nil && !errors.Is(err, net.ErrClosed) {
+				slog.Warn("nmea tcp connection failed", "remote", conn.RemoteAddr().String(), "error", err)
+			}
+		}()
+	}
+}
+
+// ListenUDP reads datagrams, each holding one or more sentences, until ctx
+// is cancelled.
+func ListenUDP(ctx context.Context, addr string, fn Handler) error {
+	var lc net.ListenConfig
+	pc, err := lc.ListenPacket(ctx, "udp", addr)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+	slog.Info("accepting nmea sentences over udp", "address", pc.LocalAddr().String())
+
+	stop := context.AfterFunc(ctx, func() { pc.Close() })
+	defer stop()
+
+	d := NewDecoder()
+	buf := make([]byte, 64*1024)
+	for {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for _, line := range strings.Split(string(buf[:n]), "\n") {
+			feed(d, line, fn)
+		}
+	}
+}
+
+func feed(d *Decoder, line string, fn Handler) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	report, err := d.Decode(line)
+	if err != nil || report != nil {
+		fn(report, err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package port finds the nearest port to a position. The ports are an
+// embedded UN/LOCODE subset covering Finland, Sweden, Norway, Estonia and
+// the Russian Baltic coast.
+package port
+
+import (
+	_ "embed"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+)
+
+//go:embed ports.tsv
+var portTable string
+
+// Port is a UN/LOCODE location with port facilities.
+type Port struct {
+	LOCODE   string
+	Name     string
+	Location geo.Point
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the port's country.
+func (p Port) Country() string {
+	return p.LOCODE[:2]
+}
+
+var ports = sync.OnceValue(func() *index {
+	var out []Port
+	for _, line := range strings.Split(portTable, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 || len(fields[0]) != 5 {
+			panic("port: malformed port table line: " + line)
+		}
+		lat, err1 := strconv.ParseFloat(fields[2], 64)
+		lon, err2 := strconv.ParseFloat(fields[3], 64)
+		if err1 != nil || err2 != nil {
+			panic("port: malformed port table line: " + line)
+		}
+		out = append(out, Port{LOCODE: fields[0], Name: fields[1], Location: geo.Point{Lon: lon, Lat: lat}})
+	}
+	return newIndex(out)
+})
+
+// All returns the embedded ports in table order.
+func All() []Port {
+	return slices.Clone(ports().ports)
+}
+
+// Nearest returns the port closest to p and the great-circle distance to it
+// in metres.
+func Nearest(p geo.Point) (Port, float64) {
+	idx := ports()
+	i := idx.nearest(toVector(p))
+	port := idx.ports[i]
+	return port, geo.Distance(p, port.Location)
+}
+
+// vector is a point on the unit sphere. The straight-line distance between
+// two vectors grows with their great-circle distance, so the nearest vector
+// is also the nearest port, and the k-d tree can work in three flat
+// dimensions regardless of latitude or the antimeridian.
+type vector [3]float64
+
+func toVector(p geo.Point) vector {
+	lat, lon := p.Lat*math.Pi/180, p.Lon*math.Pi/180
+	return vector{math.Cos(lat) * math.Cos(lon), math.Cos(lat) * math.Sin(lon), math.Sin(lat)}
+}
+
+func (v vector) dist2(w vector) float64 {
+	dx, dy, dz := v[0]-w[0], v[1]-w[1], v[2]-w[2]
+	return dx*dx + dy*dy + dz*dz
+}
+
+// index is a k-d tree over the ports, so lookups stay logarithmic as the
+// table grows.
+type index struct {
+	ports []Port
+	nodes []node
+	root  int
+}
+
+type node struct {
+	port        int
+	v           vector
+	axis        int
+	left, right int // -1 if absent
+}
+
+func newIndex(ports []Port) *index {
+	idx := &index{ports: ports, nodes: make([]node, 0, len(ports))}
+	order := make([]int, len(ports))
+	for i := range order {
+		order[i] = i
+	}
+	idx.root = idx.build(order, 0)
+	return idx
+}
+
+func (idx *index) build(order []int, depth int) int {
+	if len(order) == 0 {
+		return -1
+	}
+	axis := depth % 3
+	slices.SortFunc(order, func(a, b int) int {
+		va, vb := toVector(idx.ports[a].Location), toVector(idx.ports[b].Location)
+		switch {
+		case va[axis] < vb[axis]:
+			return -1
+		case va[axis] > vb[axis]:
+			return 1
+		}
+		return a - b
+	})
+	mid := len(order) / 2
+	n := len(idx.nodes)
+	idx.nodes = append(idx.nodes, node{port: order[mid], v: toVector(idx.ports[order[mid]].Location), axis: axis})
+	left := idx.build(slices.Clone(order[:mid]), depth+1)
+	right := idx.build(slices.Clone(order[mid+1:]), depth+1)
+	idx.nodes[n].left, idx.nodes[n].right = left, right
+	return n
+}
+
+// nearest returns the index of the port closest to v. The table is never
+// empty.
+func (idx *index) nearest(v vector) int {
+	best, bestDist := -1, math.Inf(1)
+	var search func(n int)
+	search = func(n int) {
+		if n < 0 {
+			return
+		}
+		nd := idx.nodes[n]
+		if d := v.dist2(nd.v); d < bestDist || (d == bestDist && nd.port < best) {
+			best, bestDist = nd.port, d
+		}
+		diff := v[nd.axis] - nd.v[nd.axis]
+		near, far := nd.left, nd.right
+		if diff > 0 {
+			near, far = far, near
+		}
+		search(near)
+		if diff*diff <= bestDist {
+			search(far)
+		}
+	}
+	search(idx.root)
+	return best
+}
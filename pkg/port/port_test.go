@@ -0,0 +1,68 @@
+package port
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+)
+
+func TestNearest(t *testing.T) {
+	tests := []struct {
+		place  string
+		p      geo.Point
+		locode string
+		maxNM  float64
+	}{
+		{"Kemi Ajos", geo.Point{Lon: 24.50, Lat: 65.65}, "FIKEM", 2},
+		{"Oulu roads", geo.Point{Lon: 24.9, Lat: 65.1}, "FIOUL", 15},
+		{"Helsinki anchorage", geo.Point{Lon: 25.0, Lat: 60.05}, "FIHEL", 8},
+		{"Luleå archipelago", geo.Point{Lon: 22.4, Lat: 65.45}, "SELLA", 12},
+		{"off Svalbard", geo.Point{Lon: 14.0, Lat: 78.3}, "NOLYR", 25},
+		{"Neva bay", geo.Point{Lon: 30.0, Lat: 59.92}, "RULED", 8},
+	}
+	for _, tt := range tests {
+		port, dist := Nearest(tt.p)
+		if port.LOCODE != tt.locode || dist/geo.MetersPerNauticalMile > tt.maxNM {
+			t.Errorf("%s: got %s (%s) at %.1f nmi, want %s within %g nmi", tt.place, port.LOCODE, port.Name, dist/geo.MetersPerNauticalMile, tt.locode, tt.maxNM)
+		}
+	}
+	if port, _ := Nearest(geo.Point{Lon: 30.0, Lat: 59.92}); port.Country() != "RU" || port.Name != "Saint Petersburg" {
+		t.Errorf("unexpected port %+v", port)
+	}
+}
+
+// The k-d tree must agree with a linear scan.
+func TestNearestMatchesLinearScan(t *testing.T) {
+	all := All()
+	rng := rand.New(rand.NewPCG(1, 2))
+	for range 2000 {
+		p := geo.Point{Lon: rng.Float64()*360 - 180, Lat: rng.Float64()*180 - 90}
+		got, gotDist := Nearest(p)
+
+		want, wantDist := all[0], geo.Distance(p, all[0].Location)
+		for _, port := range all[1:] {
+			if d := geo.Distance(p, port.Location); d < wantDist {
+				want, wantDist = port, d
+			}
+		}
+		if got.LOCODE != want.LOCODE && gotDist-wantDist > 1e-6 {
+			t.Fatalf("%v: index found %s at %.0f m, linear scan %s at %.0f m", p, got.LOCODE, gotDist, want.LOCODE, wantDist)
+		}
+	}
+}
+
+func TestAll(t *testing.T) {
+	seen := map[string]bool{}
+	for _, p := range All() {
+		if seen[p.LOCODE] {
+			t.Errorf("duplicate LOCODE %s", p.LOCODE)
+		}
+		seen[p.LOCODE] = true
+		switch p.Country() {
+		case "FI", "SE", "NO", "EE", "RU":
+		default:
+			t.Errorf("%s: unexpected country", p.LOCODE)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Package seaarea names the Baltic Sea area of a position, following the
+// sea areas of the Finnish Meteorological Institute ice reports (Bay of
+// Bothnia, The Quark, Sea of Bothnia, ..., Skagerrak).
+package seaarea
+
+import (
+	"bytes"
+	_ "embed"
+	"sync"
+
+	"github.com/joluc/icebreaker-exporter/pkg/geo"
+)
+
+// areas.geojson holds simplified outlines of the areas. They extend over
+// the coast, so only their boundaries at sea matter; where outlines overlap
+// the area listed first wins.
+//
+//go:embed areas.geojson
+var areasGeoJSON []byte
+
+type area struct {
+	name  string
+	shape geo.MultiPolygon
+}
+
+var areas = sync.OnceValue(func() []area {
+	features, err := geo.DecodeGeoJSON(bytes.NewReader(areasGeoJSON))
+	if err != nil {
+		panic("seaarea: malformed areas.geojson: " + err.Error())
+	}
+	out := make([]area, 0, len(features))
+	for _, f := range features {
+		out = append(out, area{name: f.Name(), shape: f.Shape})
+	}
+	return out
+})
+
+// Of returns the name of the sea area at the position, or "" outside the
+// Baltic Sea, Kattegat and Skagerrak.
+func Of(lon, lat float64) string {
+	p := geo.Point{Lon: lon, Lat: lat}
+	for _, a := range areas() {
+		if a.shape.Contains(p) {
+			return a.name
+		}
+	}
+	return ""
+}
+
+// Names returns the names of all sea areas, from north to south.
+func Names() []string {
+	out := make([]string, 0, len(areas()))
+	for _, a := range areas() {
+		out = append(out, a.name)
+	}
+	return out
+}
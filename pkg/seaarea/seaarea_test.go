@@ -0,0 +1,47 @@
+package seaarea
+
+import "testing"
+
+func TestOf(t *testing.T) {
+	tests := []struct {
+		place    string
+		lon, lat float64
+		want     string
+	}{
+		{"Kemi roads", 24.45, 65.6, "Bay of Bothnia"},
+		{"Oulu", 25.2, 65.05, "Bay of Bothnia"},
+		{"Vaasa–Umeå", 21.0, 63.5, "The Quark"},
+		{"off Pori", 20.8, 61.6, "Sea of Bothnia"},
+		{"off Gävle", 17.6, 60.9, "Sea of Bothnia"},
+		{"Sea of Åland", 19.1, 60.1, "Sea of Åland"},
+		{"Turku archipelago", 21.8, 60.2, "Archipelago Sea"},
+		{"off Helsinki", 25.0, 59.9, "Gulf of Finland"},
+		{"Kotka", 26.9, 60.4, "Gulf of Finland"},
+		{"Pärnu bay", 24.1, 58.2, "Gulf of Riga"},
+		{"off Gotska Sandön", 19.5, 58.5, "Northern Baltic Proper"},
+		{"east of Gotland", 19.8, 57.3, "Central Baltic Proper"},
+		{"Gdańsk bay", 19.0, 54.6, "Southern Baltic Proper"},
+		{"Kiel bay", 10.5, 54.6, "Western Baltic"},
+		{"off Gothenburg", 11.5, 57.6, "Kattegat"},
+		{"off Skagen", 10.5, 58.0, "Skagerrak"},
+		{"Svalbard", 15.6, 78.2, ""},
+		{"North Sea", 3.0, 56.0, ""},
+	}
+	for _, tt := range tests {
+		if got := Of(tt.lon, tt.lat); got != tt.want {
+			t.Errorf("%s (%g, %g): got %q, want %q", tt.place, tt.lon, tt.lat, got, tt.want)
+		}
+	}
+}
+
+func TestNames(t *testing.T) {
+	names := Names()
+	if len(names) != 13 || names[0] != "Bay of Bothnia" || names[len(names)-1] != "Skagerrak" {
+		t.Errorf("unexpected names %q", names)
+	}
+	for _, name := range names {
+		if name == "" {
+			t.Error("unnamed sea area")
+		}
+	}
+}
@@ -0,0 +1,403 @@
+// Package storage persists the exporter state in an append-only log so that
+// positions, track history and resolved MMSIs survive restarts.
+//
+// Each record is a big-endian uint32 payload length, the CRC-32C of the
+// payload and the JSON payload. A torn or corrupt tail, left by a crash in
+// the middle of a write, is discarded when the log is opened. Compaction
+// writes the current state to a temporary file and renames it over the log.
+//
+// Refresh results are synced to disk right away. Live positions arrive with
+// every AIS message, so they are synced at most every positionSyncInterval;
+// a power loss may lose the positions of that interval.
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+const (
+	logName = "state.log"
+	tmpName = "state.log.tmp"
+
+	headerSize = 8
+	// maxRecordSize guards against allocating huge buffers for a corrupt
+	// length field.
+	maxRecordSize = 64 << 20
+	// compactMinSize is the smallest log that is compacted; above it the log
+	// is compacted once it doubled since the last compaction.
+	compactMinSize = 1 << 20
+	// positionSyncInterval bounds how long a live position stays unsynced.
+	positionSyncInterval = time.Second
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Resolved is a persisted name to MMSI resolution. Key identifies the vessel
+// definitions it was resolved for.
+type Resolved struct {
+	Key     string
+	Vessels []models.VesselMetadata
+	At      time.Time
+}
+
+// State is the persisted exporter state.
+type State struct {
+	Snapshot models.Snapshot
+	Resolved Resolved
+	// Tracks holds the recorded points per MMSI in the order they were
+	// written, oldest first. It may contain duplicates.
+	Tracks map[string][]models.TrackPoint
+	// Discarded is the size of a torn or corrupt tail dropped by Open.
+	Discarded int64
+}
+
+type record struct {
+	Kind     string                     `json:"kind"`
+	Time     time.Time                  `json:"time"`
+	Snapshot *models.Snapshot           `json:"snapshot,omitempty"`
+	Position *models.IcebreakerPosition `json:"position,omitempty"`
+	Resolved *Resolved                  `json:"resolved,omitempty"`
+	MMSI     string                     `json:"mmsi,omitempty"`
+	Points   []models.TrackPoint        `json:"points,omitempty"`
+}
+
+const (
+	kindSnapshot = "snapshot"
+	kindPosition = "position"
+	kindResolved = "resolved"
+	kindTrack    = "track"
+)
+
+// Store appends state updates to the log in a directory.
+type Store struct {
+	dir string
+
+	mu       sync.Mutex
+	f        *os.File
+	size     int64
+	baseSize int64
+	// syncPending is set while a sync of live positions is scheduled;
+	// syncErr is its error, returned by the next append.
+	syncPending bool
+	syncErr     error
+}
+
+// Open opens or creates the log in dir and returns the state it holds.
+func Open(dir string) (*Store, State, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, State{}, err
+	}
+	// A leftover temporary file is an interrupted compaction; the log itself
+	// is still complete.
+	if err := os.Remove(filepath.Join(dir, tmpName)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, State{}, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, logName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, State{}, err
+	}
+	state, valid, err := replay(f)
+	if err != nil {
+		f.Close()
+		return nil, State{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, State{}, err
+	}
+	if state.Discarded = info.Size() - valid; state.Discarded > 0 {
+		if err := f.Truncate(valid); err != nil {
+			f.Close()
+			return nil, State{}, fmt.Errorf("truncate torn log: %w", err)
+		}
+	}
+	if _, err := f.Seek(valid, io.SeekStart); err != nil {
+		f.Close()
+		return nil, State{}, err
+	}
+	return &Store{dir: dir, f: f, size: valid, baseSize: valid}, state, nil
+}
+
+// Load reads the state in dir without modifying the log, so it can be used
+// while an exporter has the log open.
+func Load(dir string) (State, error) {
+	f, err := os.Open(filepath.Join(dir, logName))
+	if err != nil {
+		return State{}, err
+	}
+	defer f.Close()
+
+	state, valid, err := replay(f)
+	if err != nil {
+		return State{}, err
+	}
+	if info, err := f.Stat(); err == nil {
+		state.Discarded = info.Size() - valid
+	}
+	return state, nil
+}
+
+// replay applies the records of the log and returns the offset after the
+// last valid one.
+func replay(r io.Reader) (State, int64, error) {
+	state := State{Tracks: map[string][]models.TrackPoint{}}
+	br := bufio.NewReader(r)
+	var offset int64
+	for {
+		payload, err := readRecord(br)
+		if errors.Is(err, io.EOF) || errors.Is(err, errCorrupt) {
+			return state, offset, nil
+		}
+		if err != nil {
+			return State{}, 0, err
+		}
+		var rec record
+		if err := json.Unmarshal(payload, &rec); err != nil {
+			return state, offset, nil
+		}
+		state.apply(rec)
+		offset += headerSize + int64(len(payload))
+	}
+}
+
+var errCorrupt = errors.New("corrupt record")
+
+func readRecord(r io.Reader) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errCorrupt
+		}
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(header[:4])
+	if n > maxRecordSize {
+		return nil, errCorrupt
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, errCorrupt
+		}
+		return nil, err
+	}
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errCorrupt
+	}
+	return payload, nil
+}
+
+func (s *State) apply(rec record) {
+	switch rec.Kind {
+	case kindSnapshot:
+		if rec.Snapshot == nil {
+			return
+		}
+		s.Snapshot = *rec.Snapshot
+		for _, pos := range s.Snapshot.Positions {
+			s.addPoint(pos)
+		}
+	case kindPosition:
+		if rec.Position == nil {
+			return
+		}
+		for i, pos := range s.Snapshot.Positions {
+			if pos.MMSI == rec.Position.MMSI {
+				s.Snapshot.Positions[i] = *rec.Position
+				break
+			}
+		}
+		s.addPoint(*rec.Position)
+	case kindResolved:
+		if rec.Resolved != nil {
+			s.Resolved = *rec.Resolved
+		}
+	case kindTrack:
+		s.Tracks[rec.MMSI] = append(s.Tracks[rec.MMSI], rec.Points...)
+	}
+}
+
+func (s *State) addPoint(pos models.IcebreakerPosition) {
+	s.Tracks[pos.MMSI] = append(s.Tracks[pos.MMSI], pos.TrackPoint())
+}
+
+// SaveSnapshot records the result of a refresh.
+func (s *Store) SaveSnapshot(snapshot models.Snapshot) error {
+	return s.append(record{Kind: kindSnapshot, Time: time.Now(), Snapshot: &snapshot}, true)
+}
+
+// SavePosition records a live position update of a tracked vessel. It is
+// synced to disk within positionSyncInterval.
+func (s *Store) SavePosition(pos models.IcebreakerPosition) error {
+	return s.append(record{Kind: kindPosition, Time: time.Now(), Position: &pos}, false)
+}
+
+// SaveResolved records a name to MMSI resolution.
+func (s *Store) SaveResolved(resolved Resolved) error {
+	return s.append(record{Kind: kindResolved, Time: time.Now(), Resolved: &resolved}, true)
+}
+
+// append writes rec to the log. With sync it returns once rec is on disk,
+// otherwise a sync is scheduled.
+func (s *Store) append(rec record, sync bool) error {
+	buf, err := encode(rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return os.ErrClosed
+	}
+	n, err := s.f.Write(buf)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if sync {
+		return s.f.Sync()
+	}
+	if !s.syncPending {
+		s.syncPending = true
+		time.AfterFunc(positionSyncInterval, s.syncPositions)
+	}
+	err, s.syncErr = s.syncErr, nil
+	return err
+}
+
+// syncPositions syncs the live positions written since the last sync.
+func (s *Store) syncPositions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.syncPending = false
+	if s.f == nil {
+		return
+	}
+	if err := s.f.Sync(); err != nil {
+		s.syncErr = err
+	}
+}
+
+func encode(rec record) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, headerSize, headerSize+len(payload))
+	binary.BigEndian.PutUint32(buf[:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.Checksum(payload, crcTable))
+	return append(buf, payload...), nil
+}
+
+// NeedsCompaction reports whether the log grew enough since the last
+// compaction to be worth rewriting.
+func (s *Store) NeedsCompaction() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size >= max(compactMinSize, 2*s.baseSize)
+}
+
+// Compact replaces the log with one holding only the state returned by
+// current. current is called with appends blocked, so it has to reflect
+// every update saved before; updates saved after are appended to the new
+// log. The old log stays in place until the new one is completely written.
+func (s *Store) Compact(current func() State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return os.ErrClosed
+	}
+
+	state := current()
+	now := time.Now()
+	records := make([]record, 0, len(state.Tracks)+2)
+	if !state.Resolved.At.IsZero() {
+		records = append(records, record{Kind: kindResolved, Time: now, Resolved: &state.Resolved})
+	}
+	for mmsi, points := range state.Tracks {
+		if len(points) > 0 {
+			records = append(records, record{Kind: kindTrack, Time: now, MMSI: mmsi, Points: points})
+		}
+	}
+	records = append(records, record{Kind: kindSnapshot, Time: now, Snapshot: &state.Snapshot})
+
+	tmpPath := filepath.Join(s.dir, tmpName)
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	size, err := writeRecords(tmp, records)
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, filepath.Join(s.dir, logName)); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	syncDir(s.dir)
+
+	s.f.Close()
+	s.f, s.size, s.baseSize = tmp, size, size
+	return nil
+}
+
+func writeRecords(f *os.File, records []record) (int64, error) {
+	w := bufio.NewWriter(f)
+	var size int64
+	for _, rec := range records {
+		buf, err := encode(rec)
+		if err != nil {
+			return 0, err
+		}
+		n, err := w.Write(buf)
+		size += int64(n)
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return 0, err
+	}
+	return size, f.Sync()
+}
+
+// syncDir makes a rename in dir durable. Not all platforms support it, so
+// errors are ignored.
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	d.Close()
+}
+
+// Close closes the log.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := errors.Join(s.f.Sync(), s.f.Close())
+	s.f = nil
+	return err
+}
@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/joluc/icebreaker-exporter/pkg/models"
+)
+
+func testSnapshot() models.Snapshot {
+	return models.Snapshot{
+		LastRefresh: time.Unix(1700000000, 0).UTC(),
+		Positions: []models.IcebreakerPosition{
+			{Name: "OTSO", MMSI: "230252000", Latitude: 65.0, Longitude: 25.2, Timestamp: 1700000000},
+		},
+	}
+}
+
+func TestStoreReplay(t *testing.T) {
+	dir := t.TempDir()
+	store, state, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Snapshot.Positions) != 0 || state.Discarded != 0 {
+		t.Fatalf("expected empty state, got %+v", state)
+	}
+
+	if err := store.SaveResolved(Resolved{Key: "OTSO", Vessels: []models.VesselMetadata{{Name: "OTSO", MMSI: "230252000"}}, At: time.Unix(1699999000, 0)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSnapshot(testSnapshot()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SavePosition(models.IcebreakerPosition{Name: "OTSO", MMSI: "230252000", Latitude: 65.1, Longitude: 25.3, Timestamp: 1700000060}); err != nil {
+		t.Fatal(err)
+	}
+	// Positions of vessels not in the snapshot only extend the track.
+	if err := store.SavePosition(models.IcebreakerPosition{MMSI: "230289000", Timestamp: 1700000060}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	_, state, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Resolved.Key != "OTSO" || len(state.Resolved.Vessels) != 1 {
+		t.Errorf("unexpected resolved %+v", state.Resolved)
+	}
+	if len(state.Snapshot.Positions) != 1 || state.Snapshot.Positions[0].Latitude != 65.1 {
+		t.Errorf("expected the live position to replace the snapshot one, got %+v", state.Snapshot.Positions)
+	}
+	if got := state.Tracks["230252000"]; len(got) != 2 || got[1].Timestamp != 1700000060 {
+		t.Errorf("unexpected track %+v", got)
+	}
+	if len(state.Tracks["230289000"]) != 1 {
+		t.Errorf("expected a track for the untracked vessel, got %+v", state.Tracks)
+	}
+}
+
+func TestStoreTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	store, _, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveSnapshot(testSnapshot()); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Simulate a crash in the middle of the next record.
+	rec, err := encode(record{Kind: kindSnapshot, Snapshot: &models.Snapshot{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, logName)
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.Write(rec[:len(rec)-5])
+	f.Close()
+
+	store, state, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Discarded != int64(len(rec)-5) || len(state.Snapshot.Positions) != 1 {
+		t.Fatalf("expected the torn record to be discarded, got %+v", state)
+	}
+	if err := store.SavePosition(models.IcebreakerPosition{Name: "OTSO", MMSI: "230252000", Timestamp: 1700000120}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	_, state, err = Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Discarded != 0 || state.Snapshot.Positions[0].Timestamp != 1700000120 {
+		t.Errorf("expected appends after recovery to be readable, got %+v", state)
+	}
+}
+
+func TestStoreCorruptRecord(t *testing.T) {
+	dir := t.TempDir()
+	store, _, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.SaveSnapshot(testSnapshot())
+	_ = store.SaveSnapshot(models.Snapshot{})
+	store.Close()
+
+	path := filepath.Join(dir, logName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-2] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, state, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Discarded == 0 || len(state.Snapshot.Positions) != 1 {
+		t.Errorf("expected the corrupt record to be dropped, got %+v", state)
+	}
+}
+
+func TestStoreCompact(t *testing.T) {
+	dir := t.TempDir()
+	store, _, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 50 {
+		_ = store.SaveSnapshot(testSnapshot())
+	}
+	before, _ := os.Stat(filepath.Join(dir, logName))
+
+	err = store.Compact(func() State {
+		return State{
+			Snapshot: testSnapshot(),
+			Tracks:   map[string][]models.TrackPoint{"230252000": {{Timestamp: 1699990000}, {Timestamp: 1700000000}}},
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(filepath.Join(dir, logName))
+	if after.Size() >= before.Size() {
+		t.Errorf("expected compaction to shrink the log, %d >= %d", after.Size(), before.Size())
+	}
+	if store.NeedsCompaction() {
+		t.Error("expected no compaction right after compacting")
+	}
+	if err := store.SavePosition(models.IcebreakerPosition{MMSI: "230252000", Timestamp: 1700000060}); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// An interrupted compaction leaves a temporary file behind.
+	if err := os.WriteFile(filepath.Join(dir, tmpName), []byte("partial"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, state, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, tmpName)); !os.IsNotExist(err) {
+		t.Error("expected the temporary file to be removed")
+	}
+	if got := state.Tracks["230252000"]; len(got) != 4 || got[0].Timestamp != 1699990000 || got[3].Timestamp != 1700000060 {
+		t.Errorf("unexpected track after compaction %+v", got)
+	}
+}
+
+func TestStoreCompactKeepsConcurrentPositions(t *testing.T) {
+	dir := t.TempDir()
+	store, _, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A position saved while the state is taken is not part of it, so it
+	// has to end up in the new log.
+	saved := make(chan error, 1)
+	err = store.Compact(func() State {
+		go func() {
+			saved <- store.SavePosition(models.IcebreakerPosition{Name: "OTSO", MMSI: "230252000", Latitude: 65.1, Longitude: 25.3, Timestamp: 1700000060})
+		}()
+		time.Sleep(20 * time.Millisecond)
+		return State{Snapshot: testSnapshot()}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-saved; err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	_, state, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := state.Snapshot.Positions; len(got) != 1 || got[0].Timestamp != 1700000060 {
+		t.Errorf("expected the concurrently saved position, got %+v", got)
+	}
+}
@@ -0,0 +1,286 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDialUpgradeRoundTrip(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, "echo")
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			op, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(op, msg); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := Dial(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), []string{"echo"}, nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	tests := []struct {
+		name string
+		op   Opcode
+		data []byte
+	}{
+		{name: "short text", op: OpText, data: []byte("hello")},
+		{name: "16-bit length", op: OpBinary, data: bytes.Repeat([]byte{0xAB}, 300)},
+		{name: "64-bit length", op: OpBinary, data: bytes.Repeat([]byte{0x01}, 70000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := conn.WriteMessage(tt.op, tt.data); err != nil {
+				t.Fatalf("WriteMessage() error = %v", err)
+			}
+			op, got, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("ReadMessage() error = %v", err)
+			}
+			if op != tt.op || !bytes.Equal(got, tt.data) {
+				t.Errorf("echo mismatch: op=%d len=%d, want op=%d len=%d", op, len(got), tt.op, len(tt.data))
+			}
+		})
+	}
+}
+
+func TestUpgradeRejectsPlainRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	rr := httptest.NewRecorder()
+	if _, err := Upgrade(rr, req, ""); err == nil {
+		t.Fatal("expected error for non-upgrade request")
+	}
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %d", rr.Code)
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// Example from RFC 6455 section 1.3.
+	if got := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("acceptKey() = %s", got)
+	}
+}
+
+// fakeConn records what a Conn writes.
+type fakeConn struct {
+	net.Conn // nil; only Write and Close are used
+	written  bytes.Buffer
+}
+
+func (c *fakeConn) Write(p []byte) (int, error) { return c.written.Write(p) }
+func (c *fakeConn) Close() error                { return nil }
+
+// newTestConn returns a Conn that reads the given frames.
+func newTestConn(isClient bool, frames ...[]byte) (*Conn, *fakeConn) {
+	fc := &fakeConn{}
+	r := bufio.NewReader(bytes.NewReader(bytes.Join(frames, nil)))
+	return &Conn{conn: fc, br: r, isClient: isClient}, fc
+}
+
+// newTestConnMessage reads one message from the given frames.
+func newTestConnMessage(isClient bool, frames ...[]byte) (Opcode, []byte, error) {
+	conn, _ := newTestConn(isClient, frames...)
+	return conn.ReadMessage()
+}
+
+var testMask = [4]byte{0x37, 0xFA, 0x21, 0x3D}
+
+// frame encodes a frame, masked as a client sends it if mask is set.
+func frame(fin bool, op Opcode, mask bool, payload []byte) []byte {
+	b := []byte{byte(op)}
+	if fin {
+		b[0] |= 0x80
+	}
+	maskBit := byte(0)
+	if mask {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, maskBit|byte(n))
+	case n <= 0xFFFF:
+		b = append(b, maskBit|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, maskBit|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	if !mask {
+		return append(b, payload...)
+	}
+	b = append(b, testMask[:]...)
+	for i, c := range payload {
+		b = append(b, c^testMask[i%4])
+	}
+	return b
+}
+
+func TestReadMessageFragmented(t *testing.T) {
+	// A ping may arrive between the fragments of a message.
+	conn, fc := newTestConn(false,
+		frame(false, OpText, true, []byte("hel")),
+		frame(true, OpPing, true, []byte("!")),
+		frame(false, OpContinuation, true, nil),
+		frame(true, OpContinuation, true, []byte("lo")),
+	)
+	op, msg, err := conn.ReadMessage()
+	if err != nil || op != OpText || string(msg) != "hello" {
+		t.Fatalf("ReadMessage() = %d, %q, %v; want text \"hello\"", op, msg, err)
+	}
+	if want := frame(true, OpPong, false, []byte("!")); !bytes.Equal(fc.written.Bytes(), want) {
+		t.Errorf("expected pong % x, got % x", want, fc.written.Bytes())
+	}
+}
+
+func TestReadMessageProtocolErrors(t *testing.T) {
+	reserved := frame(true, OpText, true, []byte("x"))
+	reserved[0] |= 0x40
+	tests := []struct {
+		name   string
+		frames [][]byte
+	}{
+		{"continuation without message", [][]byte{frame(true, OpContinuation, true, []byte("x"))}},
+		{"message during fragmented message", [][]byte{frame(false, OpText, true, []byte("a")), frame(true, OpText, true, []byte("b"))}},
+		{"fragmented ping", [][]byte{frame(false, OpPing, true, nil)}},
+		{"oversized ping", [][]byte{frame(true, OpPing, true, bytes.Repeat([]byte{1}, 126))}},
+		{"reserved bits", [][]byte{reserved}},
+		{"unknown opcode", [][]byte{frame(true, Opcode(0x3), true, nil)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// A valid message follows, so that ignoring the bad frame shows.
+			frames := append(tt.frames, frame(true, OpText, true, []byte("ok")))
+			if _, _, err := newTestConnMessage(false, frames...); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestMasking(t *testing.T) {
+	if _, _, err := newTestConnMessage(false, frame(true, OpText, false, []byte("x"))); err == nil {
+		t.Error("expected the server to reject an unmasked frame")
+	}
+	if _, _, err := newTestConnMessage(true, frame(true, OpText, true, []byte("x"))); err == nil {
+		t.Error("expected the client to reject a masked frame")
+	}
+
+	payload := []byte("masked payload")
+	client, fc := newTestConn(true)
+	if err := client.WriteMessage(OpBinary, payload); err != nil {
+		t.Fatal(err)
+	}
+	b := fc.written.Bytes()
+	if b[0] != 0x80|byte(OpBinary) || b[1] != 0x80|byte(len(payload)) {
+		t.Fatalf("unexpected client frame header % x", b[:2])
+	}
+	mask, got := b[2:6], slices.Clone(b[6:])
+	for i := range got {
+		got[i] ^= mask[i%4]
+	}
+	if !bytes.Equal(got, payload) {
+		t.Errorf("unmasked payload %q, want %q", got, payload)
+	}
+	server, _ := newTestConn(false, b)
+	if _, msg, err := server.ReadMessage(); err != nil || !bytes.Equal(msg, payload) {
+		t.Errorf("server read %q, %v", msg, err)
+	}
+
+	server, fc = newTestConn(false)
+	if err := server.WriteMessage(OpBinary, payload); err != nil {
+		t.Fatal(err)
+	}
+	if want := frame(true, OpBinary, false, payload); !bytes.Equal(fc.written.Bytes(), want) {
+		t.Errorf("expected unmasked server frame % x, got % x", want, fc.written.Bytes())
+	}
+}
+
+func TestReadMessageOversized(t *testing.T) {
+	// Only the header is sent: the payload must not be read or allocated.
+	header := []byte{0x80 | byte(OpBinary), 0x80 | 127}
+	header = binary.BigEndian.AppendUint64(header, maxMessageSize+1)
+	if _, _, err := newTestConnMessage(false, header); err == nil {
+		t.Error("expected an error for an oversized frame")
+	}
+	header = []byte{0x80 | byte(OpBinary), 0x80 | 127}
+	header = binary.BigEndian.AppendUint64(header, 1<<63)
+	if _, _, err := newTestConnMessage(false, header); err == nil {
+		t.Error("expected an error for a 64-bit length with the top bit set")
+	}
+
+	// Fragments within the limit that add up to more than it.
+	half := bytes.Repeat([]byte{1}, maxMessageSize/2+1)
+	if _, _, err := newTestConnMessage(false, frame(false, OpBinary, true, half), frame(true, OpContinuation, true, half)); err == nil {
+		t.Error("expected an error for an oversized fragmented message")
+	}
+}
+
+func TestReadMessageClose(t *testing.T) {
+	closing := []byte{0x03, 0xE9} // 1001 going away
+	conn, fc := newTestConn(false, frame(true, OpClose, true, closing))
+	if _, _, err := conn.ReadMessage(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if want := frame(true, OpClose, false, closing); !bytes.Equal(fc.written.Bytes(), want) {
+		t.Errorf("expected the close frame to be echoed, got % x", fc.written.Bytes())
+	}
+
+	// RFC 6455 section 5.5.1: no frame may follow the close frame.
+	fc.written.Reset()
+	if err := conn.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := conn.WriteMessage(OpText, []byte("late")); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after the close frame, got %v", err)
+	}
+	if fc.written.Len() != 0 {
+		t.Errorf("expected nothing written after the echoed close frame, got % x", fc.written.Bytes())
+	}
+}
+
+func TestReadMessageInvalidUTF8(t *testing.T) {
+	conn, fc := newTestConn(false,
+		frame(false, OpText, true, []byte{'a', 0xE2}),
+		frame(true, OpContinuation, true, []byte{0x82, 0xAC}), // "€" split across frames
+		frame(true, OpText, true, []byte{0xFF}),
+	)
+	if op, msg, err := conn.ReadMessage(); err != nil || op != OpText || string(msg) != "a€" {
+		t.Fatalf("ReadMessage() = %d, %q, %v; want text \"a€\"", op, msg, err)
+	}
+	if _, _, err := conn.ReadMessage(); err == nil {
+		t.Fatal("expected an error for invalid UTF-8")
+	}
+	if want := frame(true, OpClose, false, []byte{0x03, 0xEF}); !bytes.Equal(fc.written.Bytes(), want) {
+		t.Errorf("expected a 1007 close frame, got % x", fc.written.Bytes())
+	}
+
+	// Binary messages carry arbitrary bytes.
+	if _, _, err := newTestConnMessage(false, frame(true, OpBinary, true, []byte{0xFF})); err != nil {
+		t.Errorf("binary message rejected: %v", err)
+	}
+}